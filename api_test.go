@@ -2,14 +2,27 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"encoding/csv"
 	"encoding/json"
 	"fmt"
+	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"products-api/controllers"
 	"products-api/database"
+	"products-api/middleware"
+	"products-api/migrations"
 	"products-api/models"
+	"products-api/problem"
+	"products-api/repository"
+	"products-api/routes"
+	"strings"
 	"testing"
+	"time"
 )
 
 // Define structs to match the responses
@@ -19,15 +32,23 @@ type CreateUpdateProductResponse struct {
 }
 
 type GetProductsResponse struct {
-	Data  []models.Product `json:"data"`
-	Total int              `json:"total"`
-	Page  int              `json:"page"`
-	Limit int              `json:"limit"`
+	Data       []models.Product `json:"data"`
+	Total      int              `json:"total"`
+	Page       int              `json:"page"`
+	Limit      int              `json:"limit"`
+	NextCursor *string          `json:"next_cursor"`
+	PrevCursor *string          `json:"prev_cursor"`
 }
 
 type ErrorResponse struct {
-	Error   string `json:"error"`
-	Details string `json:"details"`
+	Type      string               `json:"type"`
+	Title     string               `json:"title"`
+	Status    int                  `json:"status"`
+	Code      string               `json:"code"`
+	Detail    string               `json:"detail"`
+	Instance  string               `json:"instance"`
+	RequestID string               `json:"request_id"`
+	Errors    []problem.FieldError `json:"errors"`
 }
 
 func TestCreateProduct(t *testing.T) {
@@ -55,7 +76,7 @@ func TestCreateProduct(t *testing.T) {
 				Price:       19.99,
 			},
 			expectedStatus: http.StatusBadRequest,
-			expectedError:  "Key: 'Product.Name' Error:Field validation for 'Name' failed on the 'required' tag",
+			expectedError:  "name is required",
 		},
 		{
 			name: "Negative Price",
@@ -65,7 +86,7 @@ func TestCreateProduct(t *testing.T) {
 				Price:       -10.99,
 			},
 			expectedStatus: http.StatusBadRequest,
-			expectedError:  "Key: 'Product.Price' Error:Field validation for 'Price' failed on the 'gte' tag",
+			expectedError:  "price must be greater than or equal to 0",
 		},
 		{
 			name: "Missing Required Field",
@@ -73,7 +94,7 @@ func TestCreateProduct(t *testing.T) {
 				"description": "This is a test product",
 			},
 			expectedStatus: http.StatusBadRequest,
-			expectedError:  "Key: 'Product.Name' Error:Field validation for 'Name' failed on the 'required' tag",
+			expectedError:  "name is required",
 		},
 		{
 			name: "Invalid Price Type",
@@ -83,7 +104,7 @@ func TestCreateProduct(t *testing.T) {
 				"price":       "not a number",
 			},
 			expectedStatus: http.StatusBadRequest,
-			expectedError:  "json: cannot unmarshal string into Go struct field Product.price of type float64",
+			expectedError:  "price must be a number",
 		},
 	}
 
@@ -119,8 +140,8 @@ func TestCreateProduct(t *testing.T) {
 				var errorResponse ErrorResponse
 				err := json.Unmarshal(w.Body.Bytes(), &errorResponse)
 				assert.NoError(t, err)
-				assert.Equal(t, "Invalid input", errorResponse.Error)
-				assert.Contains(t, errorResponse.Details, tc.expectedError)
+				assert.Equal(t, problem.CodeValidationFailed, errorResponse.Code)
+				assert.Contains(t, fieldErrorMessages(errorResponse.Errors), tc.expectedError)
 			}
 		})
 	}
@@ -226,6 +247,401 @@ func TestGetProductsPagination(t *testing.T) {
 	cleanupProducts(t)
 }
 
+func TestGetProductsFiltering(t *testing.T) {
+	testProducts := []models.Product{
+		{Name: "Red Shirt", Description: "Cotton shirt", Price: 15.00},
+		{Name: "Blue Shirt", Description: "Linen shirt", Price: 25.00},
+		{Name: "Red Hat", Description: "Wool hat, 100% wool", Price: 35.00},
+		{Name: "Green_Scarf", Description: "Silk scarf", Price: 45.00},
+	}
+
+	createTestProducts(t, testProducts)
+
+	past := url.QueryEscape(time.Now().Add(-time.Hour).Format(time.RFC3339))
+	future := url.QueryEscape(time.Now().Add(time.Hour).Format(time.RFC3339))
+	pastEast := url.QueryEscape(time.Now().Add(-time.Hour).In(time.FixedZone("", 5*3600)).Format(time.RFC3339))
+	futureWest := url.QueryEscape(time.Now().Add(time.Hour).In(time.FixedZone("", -5*3600)).Format(time.RFC3339))
+
+	testCases := []struct {
+		name          string
+		query         string
+		expectedNames []string
+	}{
+		{"No filters", "", []string{"Red Shirt", "Blue Shirt", "Red Hat", "Green_Scarf"}},
+		{"Name substring is case-insensitive", "name=red", []string{"Red Shirt", "Red Hat"}},
+		{"Description substring", "description=SHIRT", []string{"Red Shirt", "Blue Shirt"}},
+		{"Wildcards are matched literally", "description=100%25", []string{"Red Hat"}},
+		{"Underscore is matched literally", "name=n_s", []string{"Green_Scarf"}},
+		{"Minimum price is inclusive", "min_price=25", []string{"Blue Shirt", "Red Hat", "Green_Scarf"}},
+		{"Maximum price is inclusive", "max_price=25", []string{"Red Shirt", "Blue Shirt"}},
+		{"Price range", "min_price=20&max_price=40", []string{"Blue Shirt", "Red Hat"}},
+		{"Combined filters", "name=shirt&min_price=20", []string{"Blue Shirt"}},
+		{"Created after", "created_after=" + past, []string{"Red Shirt", "Blue Shirt", "Red Hat", "Green_Scarf"}},
+		{"Created after in the future", "created_after=" + future, []string{}},
+		{"Created before", "created_before=" + past, []string{}},
+		{"Timestamps with offsets", "created_after=" + pastEast + "&created_before=" + futureWest, []string{"Red Shirt", "Blue Shirt", "Red Hat", "Green_Scarf"}},
+		{"Updated since", "updated_since=" + past, []string{"Red Shirt", "Blue Shirt", "Red Hat", "Green_Scarf"}},
+		{"No matches", "name=trousers", []string{}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", "/products?"+tc.query, nil)
+			w := httptest.NewRecorder()
+			testRouter.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusOK, w.Code)
+
+			var response GetProductsResponse
+			err := json.Unmarshal(w.Body.Bytes(), &response)
+			assert.NoError(t, err)
+
+			names := []string{}
+			for _, product := range response.Data {
+				names = append(names, product.Name)
+			}
+			assert.Equal(t, tc.expectedNames, names)
+			assert.Equal(t, len(tc.expectedNames), response.Total, "Total should reflect the filters")
+		})
+	}
+
+	invalidCases := []struct {
+		name          string
+		query         string
+		expectedError string
+	}{
+		{"Invalid minimum price", "min_price=abc", "Invalid min_price, must be a non-negative number"},
+		{"Negative maximum price", "max_price=-1", "Invalid max_price, must be a non-negative number"},
+		{"Inverted price range", "min_price=10&max_price=5", "Invalid price range, min_price must not be greater than max_price"},
+		{"Invalid created after", "created_after=yesterday", "Invalid created_after, must be an RFC3339 timestamp"},
+		{"Invalid created before", "created_before=2024-01-01", "Invalid created_before, must be an RFC3339 timestamp"},
+		{"Invalid updated since", "updated_since=1700000000", "Invalid updated_since, must be an RFC3339 timestamp"},
+	}
+
+	for _, tc := range invalidCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", "/products?"+tc.query, nil)
+			w := httptest.NewRecorder()
+			testRouter.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+
+			var errorResponse ErrorResponse
+			err := json.Unmarshal(w.Body.Bytes(), &errorResponse)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedError, errorResponse.Detail)
+		})
+	}
+
+	cleanupProducts(t)
+}
+
+func TestGetProductsSorting(t *testing.T) {
+	testProducts := []models.Product{
+		{Name: "Banana", Price: 20.00},
+		{Name: "Apple", Price: 10.00},
+		{Name: "Cherry", Price: 20.00},
+		{Name: "Apple", Price: 30.00},
+	}
+
+	createTestProducts(t, testProducts)
+
+	testCases := []struct {
+		name        string
+		sort        string
+		expectedIDs []uint
+	}{
+		{"Default order is by id", "", []uint{1, 2, 3, 4}},
+		{"Ascending price with id tiebreaker", "price", []uint{2, 1, 3, 4}},
+		{"Descending price with id tiebreaker", "-price", []uint{4, 1, 3, 2}},
+		{"Descending price then name", "-price,name", []uint{4, 1, 3, 2}},
+		{"Name then descending price", "name,-price", []uint{4, 2, 1, 3}},
+		{"Descending id", "-id", []uint{4, 3, 2, 1}},
+		{"Explicit id tiebreaker overrides the default", "price,-id", []uint{2, 3, 1, 4}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", "/products?sort="+url.QueryEscape(tc.sort), nil)
+			w := httptest.NewRecorder()
+			testRouter.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusOK, w.Code)
+
+			var response GetProductsResponse
+			err := json.Unmarshal(w.Body.Bytes(), &response)
+			assert.NoError(t, err)
+
+			ids := []uint{}
+			for _, product := range response.Data {
+				ids = append(ids, product.ID)
+			}
+			assert.Equal(t, tc.expectedIDs, ids)
+		})
+	}
+
+	// Sorting is applied before pagination
+	req, _ := http.NewRequest("GET", "/products?sort=-price&page=2&limit=2", nil)
+	w := httptest.NewRecorder()
+	testRouter.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	var response GetProductsResponse
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	assert.Len(t, response.Data, 2)
+	assert.Equal(t, uint(3), response.Data[0].ID)
+	assert.Equal(t, uint(2), response.Data[1].ID)
+
+	invalidCases := []struct {
+		name          string
+		sort          string
+		expectedError string
+	}{
+		{"Unknown field", "description", `Invalid sort, unknown sort field "description", must be one of id, name, price, created_at, updated_at`},
+		{"Empty field", "name,", `Invalid sort, unknown sort field "", must be one of id, name, price, created_at, updated_at`},
+		{"Duplicate field", "name,-name", `Invalid sort, duplicate sort field "name"`},
+	}
+
+	for _, tc := range invalidCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", "/products?sort="+url.QueryEscape(tc.sort), nil)
+			w := httptest.NewRecorder()
+			testRouter.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+
+			var errorResponse ErrorResponse
+			err := json.Unmarshal(w.Body.Bytes(), &errorResponse)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedError, errorResponse.Detail)
+		})
+	}
+
+	cleanupProducts(t)
+}
+
+func TestGetProductsCursorPagination(t *testing.T) {
+	var testProducts []models.Product
+	for i := 1; i <= 25; i++ {
+		testProducts = append(testProducts, models.Product{
+			Name:  fmt.Sprintf("Test Product %d", i),
+			Price: float64(i%5) * 10.0,
+		})
+	}
+
+	createTestProducts(t, testProducts)
+
+	getPage := func(t *testing.T, query string) GetProductsResponse {
+		req, _ := http.NewRequest("GET", "/products?"+query, nil)
+		w := httptest.NewRecorder()
+		testRouter.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		var response GetProductsResponse
+		err := json.Unmarshal(w.Body.Bytes(), &response)
+		assert.NoError(t, err)
+		return response
+	}
+
+	pageIDs := func(response GetProductsResponse) []uint {
+		ids := []uint{}
+		for _, product := range response.Data {
+			ids = append(ids, product.ID)
+		}
+		return ids
+	}
+
+	for _, sortExpr := range []string{"", "-price", "price,-name", "-updated_at"} {
+		t.Run("Sort "+sortExpr, func(t *testing.T) {
+			// The offset pages are the reference for the cursor pages
+			var expectedPages [][]uint
+			for page := 1; page <= 3; page++ {
+				response := getPage(t, fmt.Sprintf("sort=%s&page=%d&limit=10", sortExpr, page))
+				expectedPages = append(expectedPages, pageIDs(response))
+			}
+
+			// Walk forward following next_cursor
+			response := getPage(t, "sort="+sortExpr+"&limit=10")
+			assert.Nil(t, response.PrevCursor, "The first page should not have a previous page")
+			forwardPages := [][]uint{pageIDs(response)}
+			for response.NextCursor != nil {
+				response = getPage(t, "sort="+sortExpr+"&limit=10&cursor="+*response.NextCursor)
+				assert.Equal(t, 25, response.Total)
+				assert.Zero(t, response.Page, "Cursor pages should not report a page number")
+				forwardPages = append(forwardPages, pageIDs(response))
+			}
+			assert.Equal(t, expectedPages, forwardPages)
+
+			// Walk backward following prev_cursor from the last page
+			backwardPages := [][]uint{pageIDs(response)}
+			for response.PrevCursor != nil {
+				response = getPage(t, "sort="+sortExpr+"&limit=10&cursor="+*response.PrevCursor)
+				backwardPages = append([][]uint{pageIDs(response)}, backwardPages...)
+			}
+			assert.Equal(t, expectedPages, backwardPages)
+			assert.NotNil(t, response.NextCursor)
+		})
+	}
+
+	// Offset pages link to the following page through a cursor
+	response := getPage(t, "page=2&limit=10")
+	assert.NotNil(t, response.NextCursor)
+	assert.NotNil(t, response.PrevCursor)
+	response = getPage(t, "page=3&limit=10")
+	assert.Nil(t, response.NextCursor)
+
+	// Products created or deleted before the cursor do not shift the next page
+	first := getPage(t, "limit=10")
+	err := testRepo.Delete(context.Background(), uint64(first.Data[0].ID), 0)
+	assert.NoError(t, err)
+	createTestProducts(t, []models.Product{{Name: "Late Product", Price: 1}})
+	second := getPage(t, "limit=10&cursor="+*first.NextCursor)
+	assert.Equal(t, uint(11), second.Data[0].ID)
+
+	invalidCases := []struct {
+		name          string
+		query         string
+		expectedError string
+	}{
+		{"Malformed cursor", "cursor=abc", "Invalid cursor"},
+		{"Tampered cursor", "cursor=x" + *first.NextCursor, "Invalid cursor"},
+		{"Cursor for another sort order", "sort=-price&cursor=" + *first.NextCursor, "Invalid cursor, it was issued for a different sort order"},
+		{"Cursor combined with page", "page=2&cursor=" + *first.NextCursor, "Invalid pagination, page and cursor cannot be used together"},
+	}
+
+	for _, tc := range invalidCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", "/products?"+tc.query, nil)
+			w := httptest.NewRecorder()
+			testRouter.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+
+			var errorResponse ErrorResponse
+			err := json.Unmarshal(w.Body.Bytes(), &errorResponse)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedError, errorResponse.Detail)
+		})
+	}
+
+	cleanupProducts(t)
+}
+
+type SearchProductsResponse struct {
+	Query string `json:"query"`
+	Total int    `json:"total"`
+	Page  int    `json:"page"`
+	Limit int    `json:"limit"`
+	Data  []struct {
+		Product    models.Product `json:"product"`
+		Rank       float64        `json:"rank"`
+		Highlights struct {
+			Name        string `json:"name"`
+			Description string `json:"description"`
+		} `json:"highlights"`
+	} `json:"data"`
+}
+
+func TestSearchProducts(t *testing.T) {
+	testProducts := []models.Product{
+		{Name: "Wireless Keyboard", Description: "Compact keyboard with a rechargeable battery", Price: 49.99},
+		{Name: "Mechanical Keyboard", Description: "Clicky switches", Price: 89.99},
+		{Name: "Wireless Mouse", Description: "Ergonomic mouse for the keyboard and mouse combo", Price: 29.99},
+		{Name: "USB Cable", Description: "Braided cable", Price: 9.99},
+	}
+
+	createdProductIDs := createTestProducts(t, testProducts)
+
+	search := func(t *testing.T, query string) SearchProductsResponse {
+		req, _ := http.NewRequest("GET", "/products/search?"+query, nil)
+		w := httptest.NewRecorder()
+		testRouter.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+		var response SearchProductsResponse
+		err := json.Unmarshal(w.Body.Bytes(), &response)
+		assert.NoError(t, err)
+		return response
+	}
+
+	resultIDs := func(response SearchProductsResponse) []uint {
+		ids := []uint{}
+		for _, result := range response.Data {
+			ids = append(ids, result.Product.ID)
+		}
+		return ids
+	}
+
+	// Matches in the name rank above matches in the description only
+	response := search(t, "q=keyboard")
+	assert.Equal(t, "keyboard", response.Query)
+	assert.Equal(t, 3, response.Total)
+	assert.ElementsMatch(t, createdProductIDs[:3], resultIDs(response))
+	assert.Equal(t, createdProductIDs[2], response.Data[2].Product.ID)
+	assert.GreaterOrEqual(t, response.Data[0].Rank, response.Data[1].Rank)
+	assert.Greater(t, response.Data[1].Rank, response.Data[2].Rank)
+
+	// Matched words are highlighted
+	for _, result := range response.Data {
+		assert.Contains(t, strings.ToLower(result.Highlights.Name+result.Highlights.Description), "<mark>keyboard</mark>")
+	}
+
+	// Every word must match and the last one can be a prefix for type-ahead
+	response = search(t, "q=wireless+mou")
+	assert.Equal(t, []uint{createdProductIDs[2]}, resultIDs(response))
+	assert.Equal(t, "<mark>Wireless</mark> <mark>Mouse</mark>", response.Data[0].Highlights.Name)
+
+	// Search is case-insensitive and ignores punctuation
+	response = search(t, "q=CABLE!")
+	assert.Equal(t, []uint{createdProductIDs[3]}, resultIDs(response))
+
+	// Highlights are HTML, so the product text is escaped around the markers
+	charger := createTestProducts(t, []models.Product{{Name: "<img src=x onerror=alert(1)> Charger", Description: `Fits "all" phones & tablets`, Price: 19.99}})
+	response = search(t, "q=charger+tablets")
+	assert.Equal(t, charger, resultIDs(response))
+	assert.Equal(t, "&lt;img src=x onerror=alert(1)&gt; <mark>Charger</mark>", response.Data[0].Highlights.Name)
+	assert.Equal(t, "Fits &#34;all&#34; phones &amp; <mark>tablets</mark>", response.Data[0].Highlights.Description)
+
+	// No matches
+	response = search(t, "q=monitor")
+	assert.Equal(t, 0, response.Total)
+	assert.Empty(t, response.Data)
+
+	// Results are paginated
+	response = search(t, "q=keyboard&page=2&limit=2")
+	assert.Equal(t, 3, response.Total)
+	assert.Equal(t, 2, response.Page)
+	assert.Len(t, response.Data, 1)
+
+	invalidCases := []struct {
+		name          string
+		query         string
+		expectedError string
+	}{
+		{"Missing query", "", "Invalid search query, q must contain at least one word"},
+		{"Only punctuation", "q=%21%3F", "Invalid search query, q must contain at least one word"},
+		{"Invalid page", "q=keyboard&page=0", "Invalid page number, must be a positive integer"},
+	}
+
+	for _, tc := range invalidCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req, _ := http.NewRequest("GET", "/products/search?"+tc.query, nil)
+			w := httptest.NewRecorder()
+			testRouter.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+
+			var errorResponse ErrorResponse
+			err := json.Unmarshal(w.Body.Bytes(), &errorResponse)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedError, errorResponse.Detail)
+		})
+	}
+
+	cleanupProducts(t)
+}
+
 func TestDeleteProduct(t *testing.T) {
 	// Create a test product
 	testProduct := models.Product{
@@ -251,11 +667,9 @@ func TestDeleteProduct(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, "Product deleted successfully", response["message"])
 
-	// Verify product is deleted from database
-	var deletedProduct models.Product
-	result := database.DB.First(&deletedProduct, productID)
-	assert.Error(t, result.Error)
-	assert.Equal(t, "record not found", result.Error.Error())
+	// Verify product is deleted from the store
+	_, err = testRepo.Get(context.Background(), uint64(productID))
+	assert.ErrorIs(t, err, repository.ErrProductNotFound)
 
 	// Try to delete the same product again (should return not found)
 	req, _ = http.NewRequest("DELETE", url, nil)
@@ -264,9 +678,11 @@ func TestDeleteProduct(t *testing.T) {
 
 	// Check response is 404
 	assert.Equal(t, http.StatusNotFound, w.Code)
-	err = json.Unmarshal(w.Body.Bytes(), &response)
+	var errorResponse ErrorResponse
+	err = json.Unmarshal(w.Body.Bytes(), &errorResponse)
 	assert.NoError(t, err)
-	assert.Equal(t, "Product not found", response["error"])
+	assert.Equal(t, problem.CodeProductNotFound, errorResponse.Code)
+	assert.Equal(t, "Product not found", errorResponse.Detail)
 
 	cleanupProducts(t)
 }
@@ -311,10 +727,10 @@ func TestGetProductById(t *testing.T) {
 
 	// Check response is 404
 	assert.Equal(t, http.StatusNotFound, w.Code)
-	var errorResponse map[string]string
+	var errorResponse ErrorResponse
 	err = json.Unmarshal(w.Body.Bytes(), &errorResponse)
 	assert.NoError(t, err)
-	assert.Equal(t, "Product not found", errorResponse["error"])
+	assert.Equal(t, "Product not found", errorResponse.Detail)
 
 	cleanupProducts(t)
 }
@@ -357,7 +773,7 @@ func TestUpdateProduct(t *testing.T) {
 				Price:       39.99,
 			},
 			expectedStatus: http.StatusBadRequest,
-			expectedError:  "Name cannot be empty",
+			expectedError:  "name is required",
 		},
 		{
 			name: "Negative Price",
@@ -367,7 +783,7 @@ func TestUpdateProduct(t *testing.T) {
 				Price:       -10.99,
 			},
 			expectedStatus: http.StatusBadRequest,
-			expectedError:  "Key: 'Price' Error:Field validation for 'Price' failed on the 'gte' tag",
+			expectedError:  "price must be greater than or equal to 0",
 		},
 		{
 			name: "Invalid Price Type",
@@ -375,7 +791,7 @@ func TestUpdateProduct(t *testing.T) {
 				"price": "not a number",
 			},
 			expectedStatus: http.StatusBadRequest,
-			expectedError:  "json: cannot unmarshal string into Go struct field .price of type float64",
+			expectedError:  "price must be a number",
 		},
 	}
 
@@ -408,8 +824,8 @@ func TestUpdateProduct(t *testing.T) {
 				var errorResponse ErrorResponse
 				err := json.Unmarshal(w.Body.Bytes(), &errorResponse)
 				assert.NoError(t, err)
-				assert.Equal(t, "Invalid input", errorResponse.Error)
-				assert.Contains(t, errorResponse.Details, tc.expectedError)
+				assert.Equal(t, problem.CodeValidationFailed, errorResponse.Code)
+				assert.Contains(t, fieldErrorMessages(errorResponse.Errors), tc.expectedError)
 			}
 		})
 	}
@@ -422,10 +838,10 @@ func TestUpdateProduct(t *testing.T) {
 
 	// Check response is 404
 	assert.Equal(t, http.StatusNotFound, w.Code)
-	var errorResponse map[string]string
+	var errorResponse ErrorResponse
 	err := json.Unmarshal(w.Body.Bytes(), &errorResponse)
 	assert.NoError(t, err)
-	assert.Equal(t, "Product not found", errorResponse["error"])
+	assert.Equal(t, "Product not found", errorResponse.Detail)
 
 	// Test partial update
 	partialUpdateData := map[string]float64{
@@ -449,21 +865,2250 @@ func TestUpdateProduct(t *testing.T) {
 	assert.Equal(t, productID, response.Product.ID)
 	assert.Equal(t, partialUpdateData["price"], response.Product.Price)
 
+	// Test partial update without a price
+	jsonValue, _ = json.Marshal(map[string]string{"name": "Renamed Product"})
+	req, _ = http.NewRequest("PATCH", url, bytes.NewBuffer(jsonValue))
+	w = httptest.NewRecorder()
+	testRouter.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	err = json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	assert.Equal(t, "Renamed Product", response.Product.Name)
+	assert.Equal(t, partialUpdateData["price"], response.Product.Price)
+
+	cleanupProducts(t)
+}
+
+func TestProductOptimisticConcurrency(t *testing.T) {
+	createdProductIDs := createTestProducts(t, []models.Product{
+		{Name: "Versioned Product", Description: "Edited concurrently", Price: 10.00},
+	})
+	url := fmt.Sprintf("/products/%d", createdProductIDs[0])
+
+	send := func(router http.Handler, method, ifMatch string, body interface{}) *httptest.ResponseRecorder {
+		var reader *bytes.Buffer
+		if body != nil {
+			jsonValue, _ := json.Marshal(body)
+			reader = bytes.NewBuffer(jsonValue)
+		} else {
+			reader = bytes.NewBuffer(nil)
+		}
+		req, _ := http.NewRequest(method, url, reader)
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// New products start at version 1 and GET exposes it as the ETag
+	w := send(testRouter, "GET", "", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `"1"`, w.Header().Get("ETag"))
+	var product models.Product
+	err := json.Unmarshal(w.Body.Bytes(), &product)
+	assert.NoError(t, err)
+	assert.Equal(t, uint(1), product.Version)
+
+	// An update with the current ETag succeeds and bumps the version
+	w = send(testRouter, "PATCH", `"1"`, map[string]interface{}{"price": 12.50})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `"2"`, w.Header().Get("ETag"))
+	var response CreateUpdateProductResponse
+	err = json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	assert.Equal(t, uint(2), response.Product.Version)
+
+	// A second editor still holding the old ETag is rejected and gets the current one
+	w = send(testRouter, "PATCH", `"1"`, map[string]interface{}{"price": 15.00})
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+	assert.Equal(t, `"2"`, w.Header().Get("ETag"))
+	var errorResponse ErrorResponse
+	err = json.Unmarshal(w.Body.Bytes(), &errorResponse)
+	assert.NoError(t, err)
+	assert.Equal(t, "Precondition failed, the product has been modified", errorResponse.Detail)
+
+	// The rejected update was not applied
+	stored, err := testRepo.Get(context.Background(), uint64(createdProductIDs[0]))
+	assert.NoError(t, err)
+	assert.Equal(t, 12.50, stored.Price)
+
+	// Weak tags never match If-Match, while lists and the wildcard do
+	w = send(testRouter, "PATCH", `W/"2"`, map[string]interface{}{"price": 15.00})
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+	w = send(testRouter, "PATCH", `"1", "2"`, map[string]interface{}{"price": 15.00})
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = send(testRouter, "PATCH", "*", map[string]interface{}{"price": 17.00})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `"4"`, w.Header().Get("ETag"))
+
+	// Writing a version that changed since it was read is a conflict
+	stale := *stored
+	err = testRepo.Update(context.Background(), &stale)
+	assert.ErrorIs(t, err, repository.ErrVersionConflict)
+
+	// When If-Match is required, requests without it are rejected
+	strictRouter := gin.New()
+	routes.SetupRoutes(strictRouter, testRepos, controllers.Config{RequireIfMatch: true})
+	w = send(strictRouter, "PATCH", "", map[string]interface{}{"price": 20.00})
+	assert.Equal(t, http.StatusPreconditionRequired, w.Code)
+	w = send(strictRouter, "DELETE", "", nil)
+	assert.Equal(t, http.StatusPreconditionRequired, w.Code)
+
+	// Deletes honor If-Match as well
+	w = send(strictRouter, "DELETE", `"3"`, nil)
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+	w = send(strictRouter, "DELETE", `"4"`, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `"4"`, w.Header().Get("ETag"))
+
+	cleanupProducts(t)
+}
+
+func TestConditionalGet(t *testing.T) {
+	createdProductIDs := createTestProducts(t, []models.Product{
+		{Name: "Cached Product 1", Price: 10.00},
+		{Name: "Cached Product 2", Price: 20.00},
+	})
+	productURL := fmt.Sprintf("/products/%d", createdProductIDs[0])
+
+	get := func(url string, headers map[string]string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", url, nil)
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+		w := httptest.NewRecorder()
+		testRouter.ServeHTTP(w, req)
+		return w
+	}
+
+	for _, url := range []string{productURL, "/products?limit=10"} {
+		t.Run(url, func(t *testing.T) {
+			// The first response carries the validators
+			w := get(url, nil)
+			assert.Equal(t, http.StatusOK, w.Code)
+			etag := w.Header().Get("ETag")
+			lastModified := w.Header().Get("Last-Modified")
+			assert.NotEmpty(t, etag)
+			assert.NotEmpty(t, lastModified)
+
+			// Revalidating with the entity tag returns 304 without a body
+			w = get(url, map[string]string{"If-None-Match": etag})
+			assert.Equal(t, http.StatusNotModified, w.Code)
+			assert.Empty(t, w.Body.String())
+			assert.Equal(t, etag, w.Header().Get("ETag"))
+
+			// Weak comparison is used for If-None-Match
+			w = get(url, map[string]string{"If-None-Match": `"other", W/` + strings.TrimPrefix(etag, "W/")})
+			assert.Equal(t, http.StatusNotModified, w.Code)
+			w = get(url, map[string]string{"If-None-Match": `"other"`})
+			assert.Equal(t, http.StatusOK, w.Code)
+
+			// Revalidating with the modification date returns 304 as well
+			w = get(url, map[string]string{"If-Modified-Since": lastModified})
+			assert.Equal(t, http.StatusNotModified, w.Code)
+			w = get(url, map[string]string{"If-Modified-Since": time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat)})
+			assert.Equal(t, http.StatusOK, w.Code)
+
+			// If-None-Match takes precedence over If-Modified-Since
+			w = get(url, map[string]string{"If-None-Match": `"other"`, "If-Modified-Since": lastModified})
+			assert.Equal(t, http.StatusOK, w.Code)
+		})
+	}
+
+	// Changing a product changes the validators of the product and of the lists containing it
+	productETag := get(productURL, nil).Header().Get("ETag")
+	listETag := get("/products?limit=10", nil).Header().Get("ETag")
+
+	jsonValue, _ := json.Marshal(map[string]interface{}{"price": 15.00})
+	req, _ := http.NewRequest("PATCH", productURL, bytes.NewBuffer(jsonValue))
+	w := httptest.NewRecorder()
+	testRouter.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = get(productURL, map[string]string{"If-None-Match": productETag})
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = get("/products?limit=10", map[string]string{"If-None-Match": listETag})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// Deleting a product changes the list validator even though no remaining product was updated
+	listETag = w.Header().Get("ETag")
+	err := testRepo.Delete(context.Background(), uint64(createdProductIDs[1]), 0)
+	assert.NoError(t, err)
+	w = get("/products?limit=10", map[string]string{"If-None-Match": listETag})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	cleanupProducts(t)
+}
+
+type BulkResponse struct {
+	Message string `json:"message"`
+	Created int    `json:"created"`
+	Failed  int    `json:"failed"`
+	Results []struct {
+		Index   int             `json:"index"`
+		Status  int             `json:"status"`
+		Product *models.Product `json:"product"`
+		Error   string          `json:"error"`
+		Details string          `json:"details"`
+	} `json:"results"`
+}
+
+func TestBulkCreateProducts(t *testing.T) {
+	bulkCreate := func(router http.Handler, query string, body interface{}) (*httptest.ResponseRecorder, BulkResponse) {
+		jsonValue, _ := json.Marshal(body)
+		req, _ := http.NewRequest("POST", "/products/bulk"+query, bytes.NewBuffer(jsonValue))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+
+		var response BulkResponse
+		_ = json.Unmarshal(w.Body.Bytes(), &response)
+		return w, response
+	}
+
+	countProducts := func() int64 {
+		total, err := testRepo.Count(context.Background(), repository.ProductFilter{})
+		assert.NoError(t, err)
+		return total
+	}
+
+	validProducts := []interface{}{
+		models.Product{Name: "Bulk Product 1", Price: 10.00},
+		models.Product{Name: "Bulk Product 2", Description: "Second", Price: 20.00},
+	}
+	mixedProducts := []interface{}{
+		models.Product{Name: "Bulk Product 3", Price: 30.00},
+		map[string]interface{}{"description": "Missing name", "price": 5.00},
+		map[string]interface{}{"name": "Bad Price", "price": "free"},
+		models.Product{Name: "Bulk Product 4", Price: 40.00},
+	}
+
+	// All valid products are created in atomic mode, the default
+	w, response := bulkCreate(testRouter, "", validProducts)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, 2, response.Created)
+	assert.Equal(t, 0, response.Failed)
+	assert.Len(t, response.Results, 2)
+	for i, result := range response.Results {
+		assert.Equal(t, i, result.Index)
+		assert.Equal(t, http.StatusCreated, result.Status)
+		assert.NotZero(t, result.Product.ID)
+		assert.Equal(t, validProducts[i].(models.Product).Name, result.Product.Name)
+		assert.Equal(t, uint(1), result.Product.Version)
+	}
+	assert.Equal(t, int64(2), countProducts())
+
+	// In atomic mode a single invalid product prevents every insert
+	w, response = bulkCreate(testRouter, "?mode=atomic", mixedProducts)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, 0, response.Created)
+	assert.Equal(t, 4, response.Failed)
+	assert.Equal(t, http.StatusFailedDependency, response.Results[0].Status)
+	assert.Equal(t, http.StatusBadRequest, response.Results[1].Status)
+	assert.Equal(t, "name is required", response.Results[1].Details)
+	assert.Equal(t, http.StatusBadRequest, response.Results[2].Status)
+	assert.Equal(t, "price must be a number", response.Results[2].Details)
+	assert.Equal(t, http.StatusFailedDependency, response.Results[3].Status)
+	assert.Equal(t, int64(2), countProducts())
+
+	// In best-effort mode the valid products are created and the invalid ones reported
+	w, response = bulkCreate(testRouter, "?mode=best_effort", mixedProducts)
+	assert.Equal(t, http.StatusMultiStatus, w.Code)
+	assert.Equal(t, 2, response.Created)
+	assert.Equal(t, 2, response.Failed)
+	assert.Equal(t, http.StatusCreated, response.Results[0].Status)
+	assert.Equal(t, "Bulk Product 3", response.Results[0].Product.Name)
+	assert.Equal(t, http.StatusBadRequest, response.Results[1].Status)
+	assert.Nil(t, response.Results[1].Product)
+	assert.Equal(t, http.StatusBadRequest, response.Results[2].Status)
+	assert.Equal(t, http.StatusCreated, response.Results[3].Status)
+	assert.Equal(t, int64(4), countProducts())
+
+	// Requests are limited in size
+	limitedRouter := gin.New()
+	routes.SetupRoutes(limitedRouter, testRepos, controllers.Config{BulkMaxItems: 1})
+	w, _ = bulkCreate(limitedRouter, "", validProducts)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "At most 1 products can be sent in a single request")
+
+	invalidCases := []struct {
+		name         string
+		query        string
+		body         interface{}
+		expectedCode string
+	}{
+		{"Empty array", "", []interface{}{}, problem.CodeInvalidBody},
+		{"Not an array", "", validProducts[0], problem.CodeInvalidJSON},
+		{"Unknown mode", "?mode=sometimes", validProducts, problem.CodeInvalidParameter},
+	}
+
+	for _, tc := range invalidCases {
+		t.Run(tc.name, func(t *testing.T) {
+			w, _ := bulkCreate(testRouter, tc.query, tc.body)
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+
+			var errorResponse ErrorResponse
+			err := json.Unmarshal(w.Body.Bytes(), &errorResponse)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedCode, errorResponse.Code)
+		})
+	}
+	assert.Equal(t, int64(4), countProducts())
+
 	cleanupProducts(t)
 }
 
+type BulkChangeResponse struct {
+	Message string `json:"message"`
+	DryRun  bool   `json:"dry_run"`
+	Matched int    `json:"matched"`
+	Updated int    `json:"updated"`
+	Deleted int    `json:"deleted"`
+	IDs     []uint `json:"ids"`
+}
+
+func TestBulkUpdateAndDeleteProducts(t *testing.T) {
+	createdProductIDs := createTestProducts(t, []models.Product{
+		{Name: "Summer Shirt", Price: 20.00},
+		{Name: "Summer Hat", Price: 15.00},
+		{Name: "Winter Coat", Price: 120.00},
+		{Name: "Winter Boots", Price: 90.00},
+	})
+
+	send := func(method, query string, body interface{}) (*httptest.ResponseRecorder, BulkChangeResponse) {
+		var reader *bytes.Buffer
+		if body != nil {
+			jsonValue, _ := json.Marshal(body)
+			reader = bytes.NewBuffer(jsonValue)
+		} else {
+			reader = bytes.NewBuffer(nil)
+		}
+		req, _ := http.NewRequest(method, "/products/bulk"+query, reader)
+		w := httptest.NewRecorder()
+		testRouter.ServeHTTP(w, req)
+
+		var response BulkChangeResponse
+		_ = json.Unmarshal(w.Body.Bytes(), &response)
+		return w, response
+	}
+
+	getProduct := func(id uint) *models.Product {
+		product, err := testRepo.Get(context.Background(), uint64(id))
+		assert.NoError(t, err)
+		return product
+	}
+
+	// A dry run reports the affected products without changing them
+	w, response := send("PATCH", "?name=summer&dry_run=true", map[string]interface{}{"changes": map[string]interface{}{"price": 15.00}})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.True(t, response.DryRun)
+	assert.Equal(t, 2, response.Matched)
+	assert.Equal(t, 1, response.Updated)
+	assert.Equal(t, []uint{createdProductIDs[0]}, response.IDs)
+	assert.Equal(t, 20.00, getProduct(createdProductIDs[0]).Price)
+
+	// Reprice by filter
+	w, response = send("PATCH", "?name=summer", map[string]interface{}{"changes": map[string]interface{}{"price": 15.00}})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.False(t, response.DryRun)
+	assert.Equal(t, 2, response.Matched)
+	assert.Equal(t, 1, response.Updated)
+	assert.Equal(t, 15.00, getProduct(createdProductIDs[0]).Price)
+	assert.Equal(t, uint(2), getProduct(createdProductIDs[0]).Version)
+	assert.Equal(t, uint(1), getProduct(createdProductIDs[1]).Version, "Unchanged products keep their version")
+
+	// Update by ids
+	w, response = send("PATCH", "", map[string]interface{}{
+		"ids":     []uint{createdProductIDs[2], createdProductIDs[3], createdProductIDs[2]},
+		"changes": map[string]interface{}{"description": "Clearance"},
+	})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 2, response.Matched)
+	assert.Equal(t, 2, response.Updated)
+	assert.Equal(t, "Clearance", getProduct(createdProductIDs[2]).Description)
+	assert.Equal(t, "Clearance", getProduct(createdProductIDs[3]).Description)
+
+	// Unknown ids fail the whole request
+	w, _ = send("PATCH", "", map[string]interface{}{
+		"ids":     []uint{createdProductIDs[0], 9999},
+		"changes": map[string]interface{}{"price": 1.00},
+	})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Contains(t, w.Body.String(), `"ids":[9999]`)
+	assert.Equal(t, 15.00, getProduct(createdProductIDs[0]).Price)
+
+	invalidUpdates := []struct {
+		name            string
+		query           string
+		body            interface{}
+		expectedDetails string
+	}{
+		{"No selection", "", map[string]interface{}{"changes": map[string]interface{}{"price": 1.00}}, "Products must be selected by ids or by at least one filter"},
+		{"Ids and filters", "?name=summer", map[string]interface{}{"ids": []uint{1}, "changes": map[string]interface{}{"price": 1.00}}, "Products must be selected either by ids or by filters, not both"},
+		{"No changes", "?name=summer", map[string]interface{}{"changes": map[string]interface{}{}}, "At least one change is required"},
+		{"Empty name", "?name=summer", map[string]interface{}{"changes": map[string]interface{}{"name": ""}}, "name is required"},
+		{"Negative price", "?name=summer", map[string]interface{}{"changes": map[string]interface{}{"price": -1.00}}, "price must be greater than or equal to 0"},
+	}
+
+	for _, tc := range invalidUpdates {
+		t.Run(tc.name, func(t *testing.T) {
+			w, _ := send("PATCH", tc.query, tc.body)
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+
+			assert.Equal(t, problem.ContentType, w.Header().Get("Content-Type"))
+			assert.Contains(t, w.Body.String(), tc.expectedDetails)
+		})
+	}
+
+	// Delete dry run
+	w, response = send("DELETE", "?min_price=100&dry_run=true", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 1, response.Matched)
+	assert.Equal(t, 0, response.Deleted)
+	assert.Equal(t, []uint{createdProductIDs[2]}, response.IDs)
+	getProduct(createdProductIDs[2])
+
+	// Delete by filter
+	w, response = send("DELETE", "?min_price=100", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 1, response.Deleted)
+	_, err := testRepo.Get(context.Background(), uint64(createdProductIDs[2]))
+	assert.ErrorIs(t, err, repository.ErrProductNotFound)
+
+	// Delete by ids is all or nothing
+	w, _ = send("DELETE", "", map[string]interface{}{"ids": []uint{createdProductIDs[0], createdProductIDs[2]}})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	getProduct(createdProductIDs[0])
+
+	w, response = send("DELETE", "", map[string]interface{}{"ids": []uint{createdProductIDs[0], createdProductIDs[1]}})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, 2, response.Deleted)
+	total, err := testRepo.Count(context.Background(), repository.ProductFilter{})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), total)
+
+	// Filters matching more products than allowed are rejected
+	limitedRouter := gin.New()
+	routes.SetupRoutes(limitedRouter, testRepos, controllers.Config{BulkMaxItems: 1})
+	createTestProducts(t, []models.Product{{Name: "Extra", Price: 5.00}})
+	req, _ := http.NewRequest("DELETE", "/products/bulk?max_price=1000", nil)
+	w = httptest.NewRecorder()
+	limitedRouter.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "The filters match 2 products, at most 1 can be changed in a single request")
+
+	cleanupProducts(t)
+}
+
+func TestIdempotencyKey(t *testing.T) {
+	send := func(method, url, key string, body interface{}) *httptest.ResponseRecorder {
+		jsonValue, _ := json.Marshal(body)
+		req, _ := http.NewRequest(method, url, bytes.NewBuffer(jsonValue))
+		req.Header.Set("Content-Type", "application/json")
+		if key != "" {
+			req.Header.Set("Idempotency-Key", key)
+		}
+		w := httptest.NewRecorder()
+		testRouter.ServeHTTP(w, req)
+		return w
+	}
+
+	countProducts := func() int64 {
+		total, err := testRepo.Count(context.Background(), repository.ProductFilter{})
+		assert.NoError(t, err)
+		return total
+	}
+
+	product := models.Product{Name: "Retried Product", Description: "Created once", Price: 12.50}
+
+	// The first request is processed normally
+	first := send("POST", "/products", "create-1", product)
+	assert.Equal(t, http.StatusCreated, first.Code)
+	assert.Empty(t, first.Header().Get("Idempotent-Replayed"))
+
+	// Retries replay the stored response without creating another product
+	retry := send("POST", "/products", "create-1", product)
+	assert.Equal(t, http.StatusCreated, retry.Code)
+	assert.Equal(t, "true", retry.Header().Get("Idempotent-Replayed"))
+	assert.Equal(t, first.Body.String(), retry.Body.String())
+	assert.Equal(t, first.Header().Get("ETag"), retry.Header().Get("ETag"))
+	assert.Equal(t, int64(1), countProducts())
+
+	// Reusing the key for a different body is rejected
+	changed := product
+	changed.Price = 13.00
+	w := send("POST", "/products", "create-1", changed)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Contains(t, w.Body.String(), "Idempotency-Key was already used for a different request")
+	assert.Equal(t, int64(1), countProducts())
+
+	// Requests without a key are not deduplicated
+	w = send("POST", "/products", "", product)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, int64(2), countProducts())
+
+	// Client errors are replayed as well
+	w = send("POST", "/products", "create-invalid", map[string]interface{}{"name": ""})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = send("POST", "/products", "create-invalid", map[string]interface{}{"name": ""})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, "true", w.Header().Get("Idempotent-Replayed"))
+
+	// PATCH retries do not apply the change twice
+	var created CreateUpdateProductResponse
+	err := json.Unmarshal(first.Body.Bytes(), &created)
+	assert.NoError(t, err)
+	productURL := fmt.Sprintf("/products/%d", created.Product.ID)
+
+	w = send("PATCH", productURL, "update-1", map[string]interface{}{"price": 15.00})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `"2"`, w.Header().Get("ETag"))
+	w = send("PATCH", productURL, "update-1", map[string]interface{}{"price": 15.00})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "true", w.Header().Get("Idempotent-Replayed"))
+	stored, err := testRepo.Get(context.Background(), uint64(created.Product.ID))
+	assert.NoError(t, err)
+	assert.Equal(t, uint(2), stored.Version)
+
+	// The same key on another endpoint is a different request
+	w = send("PATCH", fmt.Sprintf("/products/%d", created.Product.ID+100), "update-1", map[string]interface{}{"price": 15.00})
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+
+	// Keys are scoped to the actor, another client choosing the same key is not served the stored response
+	jsonValue, _ := json.Marshal(product)
+	req, _ := http.NewRequest("POST", "/products", bytes.NewBuffer(jsonValue))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Idempotency-Key", "create-1")
+	req.Header.Set("X-Actor", "bob")
+	w = httptest.NewRecorder()
+	testRouter.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Empty(t, w.Header().Get("Idempotent-Replayed"))
+	assert.NotEqual(t, first.Body.String(), w.Body.String())
+	assert.Equal(t, int64(3), countProducts())
+
+	// Keys are limited in length
+	w = send("POST", "/products", strings.Repeat("k", 256), product)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, int64(3), countProducts())
+
+	// Expired keys can be reused
+	deleted, err := testRepos.Idempotency.DeleteExpired(context.Background(), time.Now().Add(48*time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(4), deleted)
+	w = send("POST", "/products", "create-1", changed)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, int64(4), countProducts())
+
+	// Bodies read to fingerprint the request are limited in size
+	w = send("POST", "/products", "create-large", strings.Repeat("x", 10<<20))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, w.Code)
+	assert.Contains(t, w.Body.String(), `"code":"body_too_large"`)
+
+	// Streamed imports are replayed as well
+	importCSV := func() *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("POST", "/products/import", strings.NewReader("name,description,price\nKeyed Lamp,Brass,30\n"))
+		req.Header.Set("Content-Type", "text/csv")
+		req.Header.Set("Idempotency-Key", "import-1")
+		w := httptest.NewRecorder()
+		testRouter.ServeHTTP(w, req)
+		return w
+	}
+	w = importCSV()
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = importCSV()
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "true", w.Header().Get("Idempotent-Replayed"))
+	assert.Equal(t, int64(5), countProducts())
+
+	cleanupProducts(t)
+}
+
+func TestIdempotencyKeyCanceledRequest(t *testing.T) {
+	// The outcome must be stored by the database repository even when the client disconnects
+	db, err := database.Open(database.Config{Driver: database.DriverSQLite, Path: database.SQLiteInMemory})
+	assert.NoError(t, err)
+	migrator, err := migrations.New(db)
+	assert.NoError(t, err)
+	assert.NoError(t, migrator.Up(context.Background()))
+
+	calls := 0
+	disconnect := func() {}
+	router := gin.New()
+	router.Use(middleware.Audit(), middleware.Idempotency(repository.NewGormIdempotencyRepository(db), time.Hour))
+	router.POST("/orders", func(c *gin.Context) {
+		calls++
+		disconnect()
+		c.JSON(http.StatusCreated, gin.H{"call": calls})
+	})
+
+	send := func(ctx context.Context) *httptest.ResponseRecorder {
+		req, _ := http.NewRequestWithContext(ctx, "POST", "/orders", strings.NewReader(`{"item": 1}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Idempotency-Key", "order-1")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// The client disconnects while the handler runs
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	disconnect = cancel
+	w := send(ctx)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Error(t, ctx.Err())
+
+	// The retry gets the stored response instead of finding the key in use
+	w = send(context.Background())
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "true", w.Header().Get("Idempotent-Replayed"))
+	assert.JSONEq(t, `{"call": 1}`, w.Body.String())
+	assert.Equal(t, 1, calls)
+}
+
+func TestImportProducts(t *testing.T) {
+	createTestProducts(t, []models.Product{
+		{Name: "Existing Lamp", Description: "Desk lamp", Price: 30.00},
+		{Name: "Unchanged Chair", Description: "Wooden chair", Price: 45.00},
+		{Name: "Twin", Price: 1.00},
+		{Name: "Twin", Price: 2.00},
+	})
+
+	type ImportResponse struct {
+		Message   string `json:"message"`
+		Created   int    `json:"created"`
+		Updated   int    `json:"updated"`
+		Unchanged int    `json:"unchanged"`
+		Rejected  int    `json:"rejected"`
+		Errors    []struct {
+			Line    int    `json:"line"`
+			Error   string `json:"error"`
+			Details string `json:"details"`
+		} `json:"errors"`
+	}
+
+	send := func(query, contentType, body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("POST", "/products/import"+query, strings.NewReader(body))
+		req.Header.Set("Content-Type", contentType)
+		w := httptest.NewRecorder()
+		testRouter.ServeHTTP(w, req)
+		return w
+	}
+
+	findProducts := func(name string) []models.Product {
+		products, err := testRepo.List(context.Background(), repository.ListOptions{
+			Filter: repository.ProductFilter{Names: []string{name}},
+		})
+		assert.NoError(t, err)
+		return products
+	}
+
+	csvFile := "\ufeffName,Price,Description,ID\n" +
+		"New Table,120.50,Oak table,\n" +
+		"Existing Lamp,35,Desk lamp,1\n" +
+		"Unchanged Chair,45,Wooden chair,2\n" +
+		"Broken Price,abc,,\n" +
+		",10,No name,\n" +
+		"Too,Many,Fields,Here,Again\n" +
+		"Twin,3,,\n" +
+		"New Table,99,\"Oak table, revised\",\n"
+
+	w := send("", "text/csv", csvFile)
+	assert.Equal(t, http.StatusMultiStatus, w.Code)
+
+	var response ImportResponse
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	assert.Equal(t, "Some rows could not be imported", response.Message)
+	assert.Equal(t, 1, response.Created)
+	assert.Equal(t, 2, response.Updated)
+	assert.Equal(t, 1, response.Unchanged)
+	assert.Equal(t, 4, response.Rejected)
+	if assert.Len(t, response.Errors, 4) {
+		assert.Equal(t, 5, response.Errors[0].Line)
+		assert.Equal(t, "price must be a number", response.Errors[0].Details)
+		assert.Equal(t, 6, response.Errors[1].Line)
+		assert.Equal(t, "name is required", response.Errors[1].Details)
+		assert.Equal(t, 7, response.Errors[2].Line)
+		assert.Equal(t, "Invalid CSV row", response.Errors[2].Error)
+		assert.Equal(t, 8, response.Errors[3].Line)
+		assert.Equal(t, "Ambiguous product name", response.Errors[3].Error)
+	}
+
+	// Rows are upserted by name, later rows updating the products of earlier ones
+	tables := findProducts("New Table")
+	if assert.Len(t, tables, 1) {
+		assert.Equal(t, 99.00, tables[0].Price)
+		assert.Equal(t, "Oak table, revised", tables[0].Description)
+		assert.Equal(t, uint(2), tables[0].Version)
+	}
+	lamps := findProducts("Existing Lamp")
+	if assert.Len(t, lamps, 1) {
+		assert.Equal(t, 35.00, lamps[0].Price)
+		assert.Equal(t, uint(2), lamps[0].Version)
+	}
+	chairs := findProducts("Unchanged Chair")
+	if assert.Len(t, chairs, 1) {
+		assert.Equal(t, uint(1), chairs[0].Version)
+	}
+
+	// Columns missing from the file are left unchanged
+	w = send("", "text/csv", "name,price\nExisting Lamp,40\n")
+	assert.Equal(t, http.StatusOK, w.Code)
+	response = ImportResponse{}
+	err = json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	assert.Equal(t, "Products imported successfully", response.Message)
+	assert.Equal(t, 1, response.Updated)
+	assert.Empty(t, response.Errors)
+	lamps = findProducts("Existing Lamp")
+	if assert.Len(t, lamps, 1) {
+		assert.Equal(t, 40.00, lamps[0].Price)
+		assert.Equal(t, "Desk lamp", lamps[0].Description)
+	}
+
+	// The rejected rows can be downloaded as CSV
+	w = send("?report=csv", "text/csv", "name,price\nGood,5\nBad,-1\nTwin,4\nShort\n")
+	assert.Equal(t, http.StatusMultiStatus, w.Code)
+	assert.Equal(t, "text/csv; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Equal(t, `attachment; filename="products-import-report.csv"`, w.Header().Get("Content-Disposition"))
+	report, err := csv.NewReader(strings.NewReader(w.Body.String())).ReadAll()
+	assert.NoError(t, err)
+	if assert.Len(t, report, 4) {
+		assert.Equal(t, []string{"line", "error", "details", "name", "price"}, report[0])
+		assert.Equal(t, []string{"3", "Invalid input", "Bad", "-1"}, []string{report[1][0], report[1][1], report[1][3], report[1][4]})
+		assert.Equal(t, []string{"4", "Ambiguous product name", "Twin", "4"}, []string{report[2][0], report[2][1], report[2][3], report[2][4]})
+		assert.Equal(t, []string{"5", "Invalid CSV row", "Short", ""}, []string{report[3][0], report[3][1], report[3][3], report[3][4]})
+	}
+	assert.Len(t, findProducts("Good"), 1)
+
+	// Files can be uploaded as a form
+	var form bytes.Buffer
+	writer := multipart.NewWriter(&form)
+	part, _ := writer.CreateFormFile("file", "products.csv")
+	part.Write([]byte("name,price\nUploaded,7.25\n"))
+	writer.Close()
+	w = send("", writer.FormDataContentType(), form.String())
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Len(t, findProducts("Uploaded"), 1)
+
+	// Invalid files are rejected as a whole
+	invalidImports := []struct {
+		name            string
+		query           string
+		contentType     string
+		body            string
+		expectedCode    int
+		expectedMessage string
+	}{
+		{"Unsupported content type", "", "application/json", `[]`, http.StatusUnsupportedMediaType, "Unsupported content type"},
+		{"Empty file", "", "text/csv", "", http.StatusBadRequest, "The CSV file is empty"},
+		{"Header only", "", "text/csv", "name,price\n", http.StatusBadRequest, "The CSV file contains no products"},
+		{"Unknown column", "", "text/csv", "name,price,colour\nRed,1\n", http.StatusBadRequest, `Unknown column \"colour\"`},
+		{"Missing price column", "", "text/csv", "name\nRed\n", http.StatusBadRequest, "The name and price columns are required"},
+		{"Duplicate column", "", "text/csv", "name,price,Name\nRed,1,Blue\n", http.StatusBadRequest, `Duplicate column \"name\"`},
+		{"Invalid report", "?report=xml", "text/csv", "name,price\nRed,1\n", http.StatusBadRequest, "Invalid report, must be json or csv"},
+	}
+
+	for _, tc := range invalidImports {
+		t.Run(tc.name, func(t *testing.T) {
+			w := send(tc.query, tc.contentType, tc.body)
+			assert.Equal(t, tc.expectedCode, w.Code)
+			assert.Contains(t, w.Body.String(), tc.expectedMessage)
+		})
+	}
+	assert.Empty(t, findProducts("Red"))
+
+	cleanupProducts(t)
+}
+
+func TestExportProducts(t *testing.T) {
+	createdProductIDs := createTestProducts(t, []models.Product{
+		{Name: "Garden Chair", Description: "Folding, green", Price: 25.00, Tags: []string{"outdoor", "sale"}, Type: "chair",
+			Attributes: map[string]interface{}{"color": "green", "foldable": true}},
+		{Name: "Garden Table", Description: "Teak", Price: 150.00},
+		{Name: "Kitchen Stool", Description: "Says \"hi\"", Price: 40.50},
+	})
+
+	export := func(query string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", "/products/export"+query, nil)
+		w := httptest.NewRecorder()
+		testRouter.ServeHTTP(w, req)
+		return w
+	}
+
+	// CSV is the default format and honors the list filters and sort
+	w := export("?name=garden&sort=-price")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "text/csv; charset=utf-8", w.Header().Get("Content-Type"))
+	assert.Equal(t, `attachment; filename="products.csv"`, w.Header().Get("Content-Disposition"))
+
+	records, err := csv.NewReader(w.Body).ReadAll()
+	assert.NoError(t, err)
+	if assert.Len(t, records, 3) {
+		assert.Equal(t, []string{"id", "name", "description", "price", "version", "created_at", "updated_at", "tags", "type", "attributes"}, records[0])
+		assert.Equal(t, []string{fmt.Sprint(createdProductIDs[1]), "Garden Table", "Teak", "150", "1"}, records[1][:5])
+		assert.Equal(t, []string{"", "", "{}"}, records[1][7:])
+		assert.Equal(t, []string{fmt.Sprint(createdProductIDs[0]), "Garden Chair", "Folding, green", "25", "1"}, records[2][:5])
+		assert.Equal(t, []string{"outdoor,sale", "chair", `{"color":"green","foldable":true}`}, records[2][7:])
+		_, err := time.Parse(time.RFC3339Nano, records[1][5])
+		assert.NoError(t, err)
+	}
+
+	// NDJSON writes one product per line
+	w = export("?format=ndjson&sort=name")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/x-ndjson", w.Header().Get("Content-Type"))
+	assert.Equal(t, `attachment; filename="products.ndjson"`, w.Header().Get("Content-Disposition"))
+	lines := strings.Split(strings.TrimSuffix(w.Body.String(), "\n"), "\n")
+	if assert.Len(t, lines, 3) {
+		var product models.Product
+		err := json.Unmarshal([]byte(lines[2]), &product)
+		assert.NoError(t, err)
+		assert.Equal(t, "Kitchen Stool", product.Name)
+		assert.Equal(t, `Says "hi"`, product.Description)
+	}
+
+	// JSON writes a single array
+	w = export("?format=json&min_price=30")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/json; charset=utf-8", w.Header().Get("Content-Type"))
+	var products []models.Product
+	err = json.Unmarshal(w.Body.Bytes(), &products)
+	assert.NoError(t, err)
+	if assert.Len(t, products, 2) {
+		assert.Equal(t, createdProductIDs[1], products[0].ID)
+		assert.Equal(t, createdProductIDs[2], products[1].ID)
+	}
+
+	// Empty exports are still valid files
+	w = export("?format=json&name=missing")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "[]\n", w.Body.String())
+	w = export("?name=missing")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "id,name,description,price,version,created_at,updated_at,tags,type,attributes\n", w.Body.String())
+
+	// Exported CSV files can be imported again without changes
+	csvExport := export("").Body.String()
+	req, _ := http.NewRequest("POST", "/products/import", strings.NewReader(csvExport))
+	req.Header.Set("Content-Type", "text/csv")
+	w = httptest.NewRecorder()
+	testRouter.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"unchanged":3`)
+
+	// Invalid parameters are rejected before anything is written
+	invalidExports := []struct {
+		name            string
+		query           string
+		expectedMessage string
+	}{
+		{"Invalid format", "?format=xlsx", "Invalid format, must be csv, ndjson or json"},
+		{"Invalid filter", "?min_price=abc", "Invalid min_price, must be a non-negative number"},
+		{"Invalid sort", "?sort=colour", "Invalid sort"},
+	}
+
+	for _, tc := range invalidExports {
+		t.Run(tc.name, func(t *testing.T) {
+			w := export(tc.query)
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			assert.Empty(t, w.Header().Get("Content-Disposition"))
+			assert.Contains(t, w.Body.String(), tc.expectedMessage)
+		})
+	}
+
+	cleanupProducts(t)
+}
+
+func TestSoftDeleteProducts(t *testing.T) {
+	createdProductIDs := createTestProducts(t, []models.Product{
+		{Name: "Trashed Lamp", Description: "Bright lamp", Price: 20.00},
+		{Name: "Purged Lamp", Description: "Dim lamp", Price: 15.00},
+		{Name: "Kept Lamp", Description: "Warm lamp", Price: 25.00},
+	})
+
+	send := func(method, url string, header map[string]string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, url, nil)
+		for name, value := range header {
+			req.Header.Set(name, value)
+		}
+		w := httptest.NewRecorder()
+		testRouter.ServeHTTP(w, req)
+		return w
+	}
+
+	list := func(url string) GetProductsResponse {
+		w := send("GET", url, nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var response GetProductsResponse
+		err := json.Unmarshal(w.Body.Bytes(), &response)
+		assert.NoError(t, err)
+		return response
+	}
+
+	trashedURL := fmt.Sprintf("/products/%d", createdProductIDs[0])
+	purgedURL := fmt.Sprintf("/products/%d", createdProductIDs[1])
+	keptURL := fmt.Sprintf("/products/%d", createdProductIDs[2])
+
+	// Deleting moves the product to the trash
+	w := send("DELETE", trashedURL, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "Product deleted successfully")
+
+	assert.Equal(t, http.StatusNotFound, send("GET", trashedURL, nil).Code)
+	assert.Equal(t, http.StatusNotFound, send("PATCH", trashedURL, nil).Code)
+	assert.Equal(t, http.StatusNotFound, send("DELETE", trashedURL, nil).Code)
+	assert.Equal(t, 2, list("/products").Total)
+	assert.NotContains(t, send("GET", "/products/search?q=bright", nil).Body.String(), "Trashed Lamp")
+
+	trash := list("/products/trash")
+	assert.Equal(t, 1, trash.Total)
+	if assert.Len(t, trash.Data, 1) {
+		assert.Equal(t, createdProductIDs[0], trash.Data[0].ID)
+		assert.True(t, trash.Data[0].DeletedAt.Valid)
+	}
+	assert.Equal(t, 0, list("/products/trash?name=kept").Total)
+
+	// Restoring takes the product out of the trash as a new version
+	w = send("POST", trashedURL+"/restore", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `"2"`, w.Header().Get("ETag"))
+	var restored CreateUpdateProductResponse
+	err := json.Unmarshal(w.Body.Bytes(), &restored)
+	assert.NoError(t, err)
+	assert.Equal(t, "Product restored successfully", restored.Message)
+	assert.Equal(t, uint(2), restored.Product.Version)
+	assert.False(t, restored.Product.DeletedAt.Valid)
+
+	assert.Equal(t, http.StatusOK, send("GET", trashedURL, nil).Code)
+	assert.Equal(t, 0, list("/products/trash").Total)
+
+	w = send("POST", trashedURL+"/restore", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Contains(t, w.Body.String(), "Product not found in trash")
+
+	// Purging removes live products permanently
+	w = send("DELETE", purgedURL+"?purge=true", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "Product permanently deleted")
+	assert.Equal(t, http.StatusNotFound, send("GET", purgedURL, nil).Code)
+	assert.Equal(t, 0, list("/products/trash").Total)
+
+	// Purging removes trashed products as well, honoring If-Match
+	assert.Equal(t, http.StatusOK, send("DELETE", keptURL, nil).Code)
+	assert.Equal(t, http.StatusPreconditionFailed, send("DELETE", keptURL+"?purge=true", map[string]string{"If-Match": `"5"`}).Code)
+	assert.Equal(t, http.StatusOK, send("DELETE", keptURL+"?purge=true", map[string]string{"If-Match": `"1"`}).Code)
+	assert.Equal(t, http.StatusNotFound, send("POST", keptURL+"/restore", nil).Code)
+	assert.Equal(t, http.StatusNotFound, send("DELETE", keptURL+"?purge=true", nil).Code)
+
+	w = send("DELETE", trashedURL+"?purge=maybe", nil)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "Invalid purge, must be a boolean")
+
+	// Products are purged from the trash once the retention window has passed
+	assert.Equal(t, http.StatusOK, send("DELETE", trashedURL, nil).Code)
+	purged, err := testRepo.PurgeDeleted(context.Background(), time.Now().Add(-time.Hour))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), purged)
+	purged, err = testRepo.PurgeDeleted(context.Background(), time.Now().Add(time.Minute))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), purged)
+	assert.Equal(t, 0, list("/products/trash").Total)
+	assert.Equal(t, 0, list("/products").Total)
+
+	cleanupProducts(t)
+}
+
+func TestAuditLog(t *testing.T) {
+	type AuditResponse struct {
+		ProductID uint                 `json:"product_id"`
+		Total     int                  `json:"total"`
+		Data      []models.AuditRecord `json:"data"`
+	}
+
+	send := func(method, url, actor, requestID string, body interface{}) *httptest.ResponseRecorder {
+		var reader *bytes.Buffer
+		if body != nil {
+			jsonValue, _ := json.Marshal(body)
+			reader = bytes.NewBuffer(jsonValue)
+		} else {
+			reader = bytes.NewBuffer(nil)
+		}
+		req, _ := http.NewRequest(method, url, reader)
+		req.Header.Set("Content-Type", "application/json")
+		if actor != "" {
+			req.Header.Set("X-Actor", actor)
+		}
+		if requestID != "" {
+			req.Header.Set("X-Request-ID", requestID)
+		}
+		w := httptest.NewRecorder()
+		testRouter.ServeHTTP(w, req)
+		return w
+	}
+
+	audit := func(url string) AuditResponse {
+		w := send("GET", url, "", "", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var response AuditResponse
+		err := json.Unmarshal(w.Body.Bytes(), &response)
+		assert.NoError(t, err)
+		return response
+	}
+
+	// Every change is recorded with its actor and request ID
+	w := send("POST", "/products", "alice", "req-create", models.Product{Name: "Audited Kettle", Description: "Steel", Price: 10.00})
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "req-create", w.Header().Get("X-Request-ID"))
+	var created CreateUpdateProductResponse
+	err := json.Unmarshal(w.Body.Bytes(), &created)
+	assert.NoError(t, err)
+	productURL := fmt.Sprintf("/products/%d", created.Product.ID)
+
+	w = send("PATCH", productURL, "bob", "", map[string]interface{}{"price": 12.00})
+	assert.Equal(t, http.StatusOK, w.Code)
+	generatedRequestID := w.Header().Get("X-Request-ID")
+	assert.Len(t, generatedRequestID, 32)
+
+	// Requests that change nothing, or fail, are not recorded
+	assert.Equal(t, http.StatusOK, send("PATCH", productURL, "bob", "", map[string]interface{}{"price": 12.00}).Code)
+	req, _ := http.NewRequest("PATCH", productURL, strings.NewReader(`{"price": 15.00}`))
+	req.Header.Set("If-Match", `"1"`)
+	w = httptest.NewRecorder()
+	testRouter.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusPreconditionFailed, w.Code)
+
+	assert.Equal(t, http.StatusOK, send("DELETE", productURL, "carol", "req-delete", nil).Code)
+	assert.Equal(t, http.StatusOK, send("POST", productURL+"/restore", "", "", nil).Code)
+
+	history := audit(productURL + "/history")
+	assert.Equal(t, created.Product.ID, history.ProductID)
+	assert.Equal(t, 4, history.Total)
+	if assert.Len(t, history.Data, 4) {
+		create, update, deletion, restore := history.Data[0], history.Data[1], history.Data[2], history.Data[3]
+
+		assert.Equal(t, models.AuditActionCreate, create.Action)
+		assert.Equal(t, "alice", create.Actor)
+		assert.Equal(t, "req-create", create.RequestID)
+		assert.Equal(t, uint(1), create.Version)
+		assert.Equal(t, models.AuditChanges{
+			"name":        {Before: nil, After: "Audited Kettle"},
+			"description": {Before: nil, After: "Steel"},
+			"price":       {Before: nil, After: 10.00},
+		}, create.Changes)
+
+		assert.Equal(t, models.AuditActionUpdate, update.Action)
+		assert.Equal(t, "bob", update.Actor)
+		assert.Equal(t, generatedRequestID, update.RequestID)
+		assert.Equal(t, uint(2), update.Version)
+		assert.Equal(t, models.AuditChanges{"price": {Before: 10.00, After: 12.00}}, update.Changes)
+
+		assert.Equal(t, models.AuditActionDelete, deletion.Action)
+		assert.Equal(t, "carol", deletion.Actor)
+		if assert.Contains(t, deletion.Changes, "deleted_at") {
+			assert.Nil(t, deletion.Changes["deleted_at"].Before)
+			assert.NotNil(t, deletion.Changes["deleted_at"].After)
+		}
+
+		assert.Equal(t, models.AuditActionRestore, restore.Action)
+		assert.Equal(t, "anonymous", restore.Actor)
+		assert.Equal(t, uint(3), restore.Version)
+		assert.Len(t, restore.Changes, 1)
+	}
+
+	// Bulk changes and purges are recorded per product, and the history outlives purged products
+	w = send("POST", "/products/bulk", "dave", "", []models.Product{{Name: "Bulk Mug", Price: 4.00}, {Name: "Bulk Cup", Price: 3.00}})
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, http.StatusOK, send("DELETE", productURL+"?purge=true", "erin", "", nil).Code)
+
+	history = audit(productURL + "/history?page=2&limit=3")
+	assert.Equal(t, 5, history.Total)
+	if assert.Len(t, history.Data, 2) {
+		purge := history.Data[1]
+		assert.Equal(t, models.AuditActionPurge, purge.Action)
+		assert.Equal(t, "erin", purge.Actor)
+		assert.Equal(t, uint(3), purge.Version)
+		assert.Equal(t, models.AuditChange{Before: "Audited Kettle", After: nil}, purge.Changes["name"])
+	}
+
+	// Products unknown to the audit log and the store are not found
+	assert.Equal(t, http.StatusNotFound, send("GET", "/products/999999/history", "", "", nil).Code)
+
+	// The global log can be filtered by actor, action, product and time range
+	assert.Equal(t, 7, audit("/audit").Total)
+	assert.Equal(t, 2, audit("/audit?actor=dave").Total)
+	assert.Equal(t, 3, audit("/audit?action=create").Total)
+	assert.Equal(t, 1, audit("/audit?action=create&actor=alice").Total)
+	assert.Equal(t, 5, audit(fmt.Sprintf("/audit?product_id=%d", created.Product.ID)).Total)
+
+	since := url.QueryEscape(time.Now().Add(-time.Hour).Format(time.RFC3339))
+	until := url.QueryEscape(time.Now().Add(time.Hour).Format(time.RFC3339))
+	assert.Equal(t, 7, audit("/audit?from="+since+"&to="+until).Total)
+	assert.Equal(t, 0, audit("/audit?from="+until).Total)
+	assert.Equal(t, 0, audit("/audit?to="+since).Total)
+
+	page := audit("/audit?limit=2&page=2")
+	assert.Equal(t, 7, page.Total)
+	if assert.Len(t, page.Data, 2) {
+		assert.Equal(t, models.AuditActionDelete, page.Data[0].Action)
+	}
+
+	invalidQueries := []struct {
+		name            string
+		query           string
+		expectedMessage string
+	}{
+		{"Invalid action", "?action=rename", "Invalid action, must be one of create, update, delete, restore, purge"},
+		{"Invalid product ID", "?product_id=abc", "Invalid product_id, must be a positive integer"},
+		{"Invalid from", "?from=yesterday", "Invalid from, must be an RFC3339 timestamp"},
+		{"Invalid range", "?from=" + until + "&to=" + since, "Invalid time range, from must not be after to"},
+		{"Invalid page", "?page=0", "Invalid page number, must be a positive integer"},
+	}
+
+	for _, tc := range invalidQueries {
+		t.Run(tc.name, func(t *testing.T) {
+			w := send("GET", "/audit"+tc.query, "", "", nil)
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			assert.Contains(t, w.Body.String(), tc.expectedMessage)
+		})
+	}
+
+	cleanupProducts(t)
+}
+
+func TestProductVersions(t *testing.T) {
+	type VersionsResponse struct {
+		ProductID uint                    `json:"product_id"`
+		Total     int                     `json:"total"`
+		Data      []models.ProductVersion `json:"data"`
+	}
+	type DiffResponse struct {
+		From    uint                `json:"from"`
+		To      uint                `json:"to"`
+		Changes models.AuditChanges `json:"changes"`
+	}
+
+	send := func(method, url, ifMatch string, body interface{}) *httptest.ResponseRecorder {
+		jsonValue, _ := json.Marshal(body)
+		req, _ := http.NewRequest(method, url, bytes.NewBuffer(jsonValue))
+		req.Header.Set("Content-Type", "application/json")
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		w := httptest.NewRecorder()
+		testRouter.ServeHTTP(w, req)
+		return w
+	}
+
+	w := send("POST", "/products", "", models.Product{Name: "Versioned Lamp", Description: "Brass", Price: 40.00})
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var created CreateUpdateProductResponse
+	err := json.Unmarshal(w.Body.Bytes(), &created)
+	assert.NoError(t, err)
+	productURL := fmt.Sprintf("/products/%d", created.Product.ID)
+
+	// Every change that gives the product a new version is snapshotted
+	assert.Equal(t, http.StatusOK, send("PATCH", productURL, "", map[string]interface{}{"price": 55.00}).Code)
+	assert.Equal(t, http.StatusOK, send("PATCH", productURL, "", map[string]interface{}{"name": "Broken Lamp", "description": ""}).Code)
+
+	w = send("GET", productURL+"/versions", "", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var versions VersionsResponse
+	err = json.Unmarshal(w.Body.Bytes(), &versions)
+	assert.NoError(t, err)
+	assert.Equal(t, created.Product.ID, versions.ProductID)
+	assert.Equal(t, 3, versions.Total)
+	if assert.Len(t, versions.Data, 3) {
+		assert.Equal(t, uint(1), versions.Data[0].Version)
+		assert.Equal(t, "Versioned Lamp", versions.Data[0].Name)
+		assert.Equal(t, 55.00, versions.Data[1].Price)
+		assert.Equal(t, "Broken Lamp", versions.Data[2].Name)
+	}
+
+	// The diff previews what reverting from the current version to a past one would change
+	w = send("GET", productURL+"/versions/3/diff/1", "", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var diff DiffResponse
+	err = json.Unmarshal(w.Body.Bytes(), &diff)
+	assert.NoError(t, err)
+	assert.Equal(t, uint(3), diff.From)
+	assert.Equal(t, uint(1), diff.To)
+	assert.Equal(t, models.AuditChanges{
+		"name":        {Before: "Broken Lamp", After: "Versioned Lamp"},
+		"description": {Before: "", After: "Brass"},
+		"price":       {Before: 55.00, After: 40.00},
+	}, diff.Changes)
+
+	// Reverting requires the current version when If-Match is given
+	assert.Equal(t, http.StatusPreconditionFailed, send("POST", productURL+"/revert?version=1", `"2"`, nil).Code)
+
+	// Reverting restores the values of the past version as a new version, keeping the history
+	w = send("POST", productURL+"/revert?version=1", `"3"`, nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `"4"`, w.Header().Get("ETag"))
+	assert.Contains(t, w.Body.String(), "Product reverted to version 1")
+	var reverted CreateUpdateProductResponse
+	err = json.Unmarshal(w.Body.Bytes(), &reverted)
+	assert.NoError(t, err)
+	assert.Equal(t, "Versioned Lamp", reverted.Product.Name)
+	assert.Equal(t, "Brass", reverted.Product.Description)
+	assert.Equal(t, 40.00, reverted.Product.Price)
+	assert.Equal(t, uint(4), reverted.Product.Version)
+
+	w = send("GET", productURL+"/versions?page=2&limit=3", "", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	err = json.Unmarshal(w.Body.Bytes(), &versions)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, versions.Total)
+	if assert.Len(t, versions.Data, 1) {
+		assert.Equal(t, uint(4), versions.Data[0].Version)
+		assert.Equal(t, "Versioned Lamp", versions.Data[0].Name)
+	}
+
+	// Reverting to identical values does not create another version
+	w = send("POST", productURL+"/revert?version=1", "", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), "No changes detected, product revert not performed")
+	assert.Equal(t, `"4"`, w.Header().Get("ETag"))
+
+	errorTests := []struct {
+		name            string
+		method          string
+		url             string
+		expectedStatus  int
+		expectedMessage string
+	}{
+		{"Missing version", "POST", productURL + "/revert", http.StatusBadRequest, "Invalid version, must be a positive integer"},
+		{"Zero version", "POST", productURL + "/revert?version=0", http.StatusBadRequest, "Invalid version, must be a positive integer"},
+		{"Unknown version", "POST", productURL + "/revert?version=9", http.StatusNotFound, "Version not found"},
+		{"Unknown product", "POST", "/products/999999/revert?version=1", http.StatusNotFound, "Product not found"},
+		{"Invalid diff version", "GET", productURL + "/versions/1/diff/abc", http.StatusBadRequest, "Invalid version, must be a positive integer"},
+		{"Unknown diff version", "GET", productURL + "/versions/1/diff/9", http.StatusNotFound, "Version not found"},
+		{"Unknown product versions", "GET", "/products/999999/versions", http.StatusNotFound, "Product not found"},
+	}
+
+	for _, tc := range errorTests {
+		t.Run(tc.name, func(t *testing.T) {
+			w := send(tc.method, tc.url, "", nil)
+			assert.Equal(t, tc.expectedStatus, w.Code)
+			assert.Contains(t, w.Body.String(), tc.expectedMessage)
+		})
+	}
+
+	// Versions outlive purged products, which end the validity of the last one
+	assert.Equal(t, http.StatusOK, send("DELETE", productURL+"?purge=true", "", nil).Code)
+	w = send("GET", productURL+"/versions", "", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	err = json.Unmarshal(w.Body.Bytes(), &versions)
+	assert.NoError(t, err)
+	assert.Equal(t, 4, versions.Total)
+	if assert.Len(t, versions.Data, 4) {
+		assert.Equal(t, versions.Data[1].ValidFrom, *versions.Data[0].ValidTo)
+		assert.NotNil(t, versions.Data[3].ValidTo)
+	}
+
+	cleanupProducts(t)
+}
+
+func TestPointInTimeReads(t *testing.T) {
+	send := func(method, url string, body interface{}) *httptest.ResponseRecorder {
+		jsonValue, _ := json.Marshal(body)
+		req, _ := http.NewRequest(method, url, bytes.NewBuffer(jsonValue))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		testRouter.ServeHTTP(w, req)
+		return w
+	}
+
+	create := func(product models.Product) uint {
+		w := send("POST", "/products", product)
+		assert.Equal(t, http.StatusCreated, w.Code)
+		var response CreateUpdateProductResponse
+		err := json.Unmarshal(w.Body.Bytes(), &response)
+		assert.NoError(t, err)
+		return response.Product.ID
+	}
+
+	// mark returns an as_of value strictly between the changes made before and after it
+	mark := func() string {
+		time.Sleep(5 * time.Millisecond)
+		now := time.Now()
+		time.Sleep(5 * time.Millisecond)
+		return url.QueryEscape(now.Format(time.RFC3339Nano))
+	}
+
+	list := func(query string) GetProductsResponse {
+		w := send("GET", "/products?"+query, nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var response GetProductsResponse
+		err := json.Unmarshal(w.Body.Bytes(), &response)
+		assert.NoError(t, err)
+		return response
+	}
+
+	beforeAll := mark()
+	chairID := create(models.Product{Name: "Office Chair", Description: "Mesh", Price: 100.00})
+	afterChair := mark()
+	deskID := create(models.Product{Name: "Standing Desk", Price: 300.00})
+	afterDesk := mark()
+	assert.Equal(t, http.StatusOK, send("PATCH", fmt.Sprintf("/products/%d", chairID), map[string]interface{}{"price": 120.00}).Code)
+	assert.Equal(t, http.StatusOK, send("DELETE", fmt.Sprintf("/products/%d", deskID), nil).Code)
+	afterChanges := mark()
+
+	// Lists reconstruct the products that existed at the time, with the values they had then
+	assert.Equal(t, 0, list("as_of="+beforeAll).Total)
+
+	response := list("as_of=" + afterChair)
+	assert.Equal(t, 1, response.Total)
+	if assert.Len(t, response.Data, 1) {
+		assert.Equal(t, chairID, response.Data[0].ID)
+		assert.Equal(t, 100.00, response.Data[0].Price)
+		assert.Equal(t, uint(1), response.Data[0].Version)
+		assert.False(t, response.Data[0].DeletedAt.Valid)
+	}
+
+	response = list("as_of=" + afterDesk + "&sort=-price")
+	assert.Equal(t, 2, response.Total)
+	if assert.Len(t, response.Data, 2) {
+		assert.Equal(t, deskID, response.Data[0].ID)
+		assert.Equal(t, 100.00, response.Data[1].Price)
+	}
+
+	response = list("as_of=" + afterChanges)
+	assert.Equal(t, 1, response.Total)
+	if assert.Len(t, response.Data, 1) {
+		assert.Equal(t, 120.00, response.Data[0].Price)
+		assert.Equal(t, uint(2), response.Data[0].Version)
+	}
+
+	// Filters apply to the past values
+	assert.Equal(t, 0, list("as_of="+afterDesk+"&min_price=110&max_price=200").Total)
+	assert.Equal(t, 1, list("as_of="+afterChanges+"&min_price=110&max_price=200").Total)
+
+	// Single products are read the same way, including those deleted and purged since
+	assert.Equal(t, http.StatusOK, send("DELETE", fmt.Sprintf("/products/%d?purge=true", deskID), nil).Code)
+	assert.Equal(t, 2, list("as_of="+afterDesk).Total)
+
+	w := send("GET", fmt.Sprintf("/products/%d?as_of=%s", deskID, afterDesk), nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var desk models.Product
+	err := json.Unmarshal(w.Body.Bytes(), &desk)
+	assert.NoError(t, err)
+	assert.Equal(t, "Standing Desk", desk.Name)
+	assert.False(t, desk.DeletedAt.Valid)
+	assert.Equal(t, `"1"`, w.Header().Get("ETag"))
+
+	w = send("GET", fmt.Sprintf("/products/%d?as_of=%s", chairID, afterChair), nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var chair models.Product
+	err = json.Unmarshal(w.Body.Bytes(), &chair)
+	assert.NoError(t, err)
+	assert.Equal(t, 100.00, chair.Price)
+	assert.Equal(t, "Mesh", chair.Description)
+
+	errorTests := []struct {
+		name            string
+		url             string
+		expectedStatus  int
+		expectedMessage string
+	}{
+		{"Before creation", fmt.Sprintf("/products/%d?as_of=%s", chairID, beforeAll), http.StatusNotFound, "Product not found"},
+		{"After deletion", fmt.Sprintf("/products/%d?as_of=%s", deskID, afterChanges), http.StatusNotFound, "Product not found"},
+		{"Invalid product as_of", fmt.Sprintf("/products/%d?as_of=yesterday", chairID), http.StatusBadRequest, "Invalid as_of, must be an RFC3339 timestamp"},
+		{"Invalid list as_of", "/products?as_of=2024-01-31", http.StatusBadRequest, "Invalid as_of, must be an RFC3339 timestamp"},
+	}
+
+	for _, tc := range errorTests {
+		t.Run(tc.name, func(t *testing.T) {
+			w := send("GET", tc.url, nil)
+			assert.Equal(t, tc.expectedStatus, w.Code)
+			assert.Contains(t, w.Body.String(), tc.expectedMessage)
+		})
+	}
+
+	cleanupProducts(t)
+}
+
+func TestProblemResponses(t *testing.T) {
+	send := func(method, url, body string, headers map[string]string) (*httptest.ResponseRecorder, ErrorResponse) {
+		req, _ := http.NewRequest(method, url, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+		w := httptest.NewRecorder()
+		testRouter.ServeHTTP(w, req)
+
+		var response ErrorResponse
+		err := json.Unmarshal(w.Body.Bytes(), &response)
+		assert.NoError(t, err)
+		return w, response
+	}
+
+	// Every error is a problem document identifying the request
+	w, response := send("POST", "/products", `{"description": "No name", "price": -1}`, map[string]string{"X-Request-ID": "req-invalid"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, problem.ContentType, w.Header().Get("Content-Type"))
+	assert.Equal(t, "about:blank", response.Type)
+	assert.Equal(t, "Bad Request", response.Title)
+	assert.Equal(t, http.StatusBadRequest, response.Status)
+	assert.Equal(t, problem.CodeValidationFailed, response.Code)
+	assert.Equal(t, "/products", response.Instance)
+	assert.Equal(t, "req-invalid", response.RequestID)
+	assert.Equal(t, []problem.FieldError{
+		{Field: "name", Rule: "required", Message: "name is required"},
+		{Field: "price", Rule: "gte", Message: "price must be greater than or equal to 0"},
+	}, response.Errors)
+
+	// Field paths include the enclosing objects
+	_, response = send("PATCH", "/products/bulk", `{"ids": [1], "changes": {"price": "free"}}`, nil)
+	assert.Equal(t, []problem.FieldError{{Field: "changes.price", Rule: "type", Message: "changes.price must be a number"}}, response.Errors)
+
+	errorTests := []struct {
+		name           string
+		method         string
+		url            string
+		body           string
+		headers        map[string]string
+		expectedStatus int
+		expectedCode   string
+	}{
+		{"Malformed JSON", "POST", "/products", `{"name": `, nil, http.StatusBadRequest, problem.CodeInvalidJSON},
+		{"Empty body", "POST", "/products", "", nil, http.StatusBadRequest, problem.CodeInvalidJSON},
+		{"Invalid product ID", "GET", "/products/abc", "", nil, http.StatusBadRequest, problem.CodeInvalidParameter},
+		{"Invalid query parameter", "GET", "/products?limit=0", "", nil, http.StatusBadRequest, problem.CodeInvalidParameter},
+		{"Unknown product", "GET", "/products/999999", "", nil, http.StatusNotFound, problem.CodeProductNotFound},
+		{"Invalid header", "GET", "/products", "", map[string]string{"X-Actor": strings.Repeat("a", 256)}, http.StatusBadRequest, problem.CodeInvalidHeader},
+	}
+
+	for _, tc := range errorTests {
+		t.Run(tc.name, func(t *testing.T) {
+			w, response := send(tc.method, tc.url, tc.body, tc.headers)
+			assert.Equal(t, tc.expectedStatus, w.Code)
+			assert.Equal(t, problem.ContentType, w.Header().Get("Content-Type"))
+			assert.Equal(t, tc.expectedStatus, response.Status)
+			assert.Equal(t, tc.expectedCode, response.Code)
+			assert.NotEmpty(t, response.Detail)
+			assert.Equal(t, w.Header().Get("X-Request-ID"), response.RequestID)
+		})
+	}
+
+	// Problems carry extension members relevant to their code
+	w, response = send("GET", "/products/999999/versions/1/diff/2", "", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, problem.CodeVersionNotFound, response.Code)
+	assert.Contains(t, w.Body.String(), `"version":1`)
+	w, response = send("PATCH", "/products/bulk", `{"ids": [999998, 999999], "changes": {"price": 1}}`, nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, problem.CodeProductNotFound, response.Code)
+	assert.Contains(t, w.Body.String(), `"ids":[999998,999999]`)
+}
+
+func TestLocalizedValidationMessages(t *testing.T) {
+	send := func(method, url, acceptLanguage string, body interface{}) *httptest.ResponseRecorder {
+		jsonValue, _ := json.Marshal(body)
+		req, _ := http.NewRequest(method, url, bytes.NewBuffer(jsonValue))
+		req.Header.Set("Content-Type", "application/json")
+		if acceptLanguage != "" {
+			req.Header.Set("Accept-Language", acceptLanguage)
+		}
+		w := httptest.NewRecorder()
+		testRouter.ServeHTTP(w, req)
+		return w
+	}
+
+	invalidProduct := map[string]interface{}{"description": "No name", "price": -5}
+
+	testCases := []struct {
+		name             string
+		acceptLanguage   string
+		expectedLanguage string
+		expectedMessages []string
+	}{
+		{"Default", "", "en", []string{"name is required", "price must be greater than or equal to 0"}},
+		{"German", "de", "de", []string{"name ist erforderlich", "price muss größer oder gleich 0 sein"}},
+		{"French region", "fr-CH, en;q=0.5", "fr", []string{"name est obligatoire", "price doit être supérieur ou égal à 0"}},
+		{"Greek by quality", "ja, fr;q=0.4, el;q=0.8", "el", []string{"name: το πεδίο είναι υποχρεωτικό", "price: πρέπει να είναι μεγαλύτερο ή ίσο με 0"}},
+		{"Unsupported", "ja, zh;q=0.9", "en", []string{"name is required", "price must be greater than or equal to 0"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := send("POST", "/products", tc.acceptLanguage, invalidProduct)
+			assert.Equal(t, http.StatusBadRequest, w.Code)
+			assert.Equal(t, tc.expectedLanguage, w.Header().Get("Content-Language"))
+			assert.Equal(t, "Accept-Language", w.Header().Get("Vary"))
+
+			var response ErrorResponse
+			err := json.Unmarshal(w.Body.Bytes(), &response)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedMessages, fieldErrorMessages(response.Errors))
+			// Fields and rules are not translated, so clients can still match them
+			if assert.Len(t, response.Errors, 2) {
+				assert.Equal(t, "name", response.Errors[0].Field)
+				assert.Equal(t, "required", response.Errors[0].Rule)
+			}
+		})
+	}
+
+	// Updates, type errors and bulk items are translated too
+	productID := createTestProducts(t, []models.Product{{Name: "Lampe", Price: 20.00}})[0]
+	w := send("PATCH", fmt.Sprintf("/products/%d", productID), "fr", map[string]interface{}{"name": "", "price": "gratuit"})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	var response ErrorResponse
+	err := json.Unmarshal(w.Body.Bytes(), &response)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"price doit être un nombre"}, fieldErrorMessages(response.Errors))
+
+	w = send("PATCH", fmt.Sprintf("/products/%d", productID), "de", map[string]interface{}{"name": ""})
+	assert.Contains(t, w.Body.String(), "name ist erforderlich")
+
+	w = send("POST", "/products/bulk?mode=best_effort", "de", []interface{}{map[string]interface{}{"price": 1}, "Tisch"})
+	assert.Equal(t, http.StatusMultiStatus, w.Code)
+	assert.Contains(t, w.Body.String(), `"details":"name ist erforderlich"`)
+	assert.Contains(t, w.Body.String(), `"details":"der Wert muss ein Objekt sein"`)
+
+	cleanupProducts(t)
+}
+
+func TestCategories(t *testing.T) {
+	type CategoryResponse struct {
+		Message  string          `json:"message"`
+		Category models.Category `json:"category"`
+	}
+	type CategoriesResponse struct {
+		ProductID uint              `json:"product_id"`
+		Total     int               `json:"total"`
+		Data      []models.Category `json:"data"`
+	}
+
+	send := func(method, url string, body interface{}) *httptest.ResponseRecorder {
+		jsonValue, _ := json.Marshal(body)
+		req, _ := http.NewRequest(method, url, bytes.NewBuffer(jsonValue))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		testRouter.ServeHTTP(w, req)
+		return w
+	}
+	createCategory := func(name string, parentID *uint) models.Category {
+		w := send("POST", "/categories", map[string]interface{}{"name": name, "parent_id": parentID})
+		assert.Equal(t, http.StatusCreated, w.Code)
+		var response CategoryResponse
+		err := json.Unmarshal(w.Body.Bytes(), &response)
+		assert.NoError(t, err)
+		return response.Category
+	}
+	listCategories := func(url string) CategoriesResponse {
+		w := send("GET", url, nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var response CategoriesResponse
+		err := json.Unmarshal(w.Body.Bytes(), &response)
+		assert.NoError(t, err)
+		return response
+	}
+	listProducts := func(url string) GetProductsResponse {
+		w := send("GET", url, nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var response GetProductsResponse
+		err := json.Unmarshal(w.Body.Bytes(), &response)
+		assert.NoError(t, err)
+		return response
+	}
+	categoryIDs := func(categories []models.Category) []uint {
+		ids := []uint{}
+		for _, category := range categories {
+			ids = append(ids, category.ID)
+		}
+		return ids
+	}
+	productIDs := func(products []models.Product) []uint {
+		ids := []uint{}
+		for _, product := range products {
+			ids = append(ids, product.ID)
+		}
+		return ids
+	}
+
+	// Categories are nested below their parent, which their path reflects
+	furniture := createCategory("Furniture", nil)
+	chairs := createCategory("Chairs", &furniture.ID)
+	officeChairs := createCategory("Office Chairs", &chairs.ID)
+	lighting := createCategory("Lighting", nil)
+	assert.Equal(t, fmt.Sprintf("/%d/", furniture.ID), furniture.Path)
+	assert.Equal(t, fmt.Sprintf("/%d/%d/%d/", furniture.ID, chairs.ID, officeChairs.ID), officeChairs.Path)
+	assert.Equal(t, &chairs.ID, officeChairs.ParentID)
+
+	w := send("POST", "/categories", map[string]interface{}{"name": "Orphans", "parent_id": 999})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	var errorResponse ErrorResponse
+	err := json.Unmarshal(w.Body.Bytes(), &errorResponse)
+	assert.NoError(t, err)
+	assert.Equal(t, "validation_failed", errorResponse.Code)
+	assert.Equal(t, []string{"parent_id does not exist"}, fieldErrorMessages(errorResponse.Errors))
+
+	// The tree is listed depth first, or one level at a time
+	categories := listCategories("/categories")
+	assert.Equal(t, 4, categories.Total)
+	assert.Equal(t, []uint{furniture.ID, chairs.ID, officeChairs.ID, lighting.ID}, categoryIDs(categories.Data))
+	assert.Equal(t, []uint{chairs.ID}, categoryIDs(listCategories(fmt.Sprintf("/categories?parent_id=%d", furniture.ID)).Data))
+
+	// Products are linked to any number of categories
+	ids := createTestProducts(t, []models.Product{
+		{Name: "Stool", Price: 30.00},
+		{Name: "Desk Chair", Price: 150.00},
+		{Name: "Floor Lamp", Price: 80.00},
+		{Name: "Old Chair", Price: 10.00},
+	})
+	stool, deskChair, lamp, oldChair := ids[0], ids[1], ids[2], ids[3]
+	assert.NoError(t, testRepo.Delete(context.Background(), uint64(oldChair), 0))
+
+	w = send("POST", fmt.Sprintf("/categories/%d/products", chairs.ID), map[string]interface{}{"product_ids": []uint{stool, stool}})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"added":1`)
+	w = send("POST", fmt.Sprintf("/categories/%d/products", chairs.ID), map[string]interface{}{"product_ids": []uint{stool}})
+	assert.Contains(t, w.Body.String(), `"added":0`)
+	send("POST", fmt.Sprintf("/categories/%d/products", officeChairs.ID), map[string]interface{}{"product_ids": []uint{deskChair}})
+	send("POST", fmt.Sprintf("/categories/%d/products", lighting.ID), map[string]interface{}{"product_ids": []uint{lamp, deskChair}})
+
+	// Missing and trashed products cannot be added
+	w = send("POST", fmt.Sprintf("/categories/%d/products", chairs.ID), map[string]interface{}{"product_ids": []uint{lamp, oldChair, 999}})
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Contains(t, w.Body.String(), fmt.Sprintf(`"ids":[%d,999]`, oldChair))
+	assert.Equal(t, http.StatusBadRequest, send("POST", fmt.Sprintf("/categories/%d/products", chairs.ID), map[string]interface{}{"product_ids": []uint{}}).Code)
+
+	// The products of a category can include those of its subcategories, with the usual filters and pagination
+	assert.Equal(t, 0, listProducts(fmt.Sprintf("/categories/%d/products", furniture.ID)).Total)
+	page := listProducts(fmt.Sprintf("/categories/%d/products?include_descendants=true", furniture.ID))
+	assert.Equal(t, 2, page.Total)
+	assert.Equal(t, []uint{stool, deskChair}, productIDs(page.Data))
+	page = listProducts(fmt.Sprintf("/categories/%d/products?include_descendants=true&sort=-price&limit=1", chairs.ID))
+	assert.Equal(t, 2, page.Total)
+	assert.Equal(t, []uint{deskChair}, productIDs(page.Data))
+	assert.NotNil(t, page.NextCursor)
+	page = listProducts(fmt.Sprintf("/categories/%d/products?include_descendants=true&max_price=100", furniture.ID))
+	assert.Equal(t, []uint{stool}, productIDs(page.Data))
+	assert.Equal(t, http.StatusBadRequest, send("GET", fmt.Sprintf("/categories/%d/products?include_descendants=maybe", furniture.ID), nil).Code)
+
+	productCategories := listCategories(fmt.Sprintf("/products/%d/categories", deskChair))
+	assert.Equal(t, deskChair, productCategories.ProductID)
+	assert.ElementsMatch(t, []uint{officeChairs.ID, lighting.ID}, categoryIDs(productCategories.Data))
+
+	// Moving a category moves its descendants and their products along
+	w = send("PATCH", fmt.Sprintf("/categories/%d", chairs.ID), map[string]interface{}{"parent_id": lighting.ID})
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = send("GET", fmt.Sprintf("/categories/%d", officeChairs.ID), nil)
+	assert.Contains(t, w.Body.String(), fmt.Sprintf(`"path":"/%d/%d/%d/"`, lighting.ID, chairs.ID, officeChairs.ID))
+	assert.Equal(t, 0, listProducts(fmt.Sprintf("/categories/%d/products?include_descendants=true", furniture.ID)).Total)
+	assert.Equal(t, 3, listProducts(fmt.Sprintf("/categories/%d/products?include_descendants=true", lighting.ID)).Total)
+
+	// A category cannot be moved below itself
+	w = send("PATCH", fmt.Sprintf("/categories/%d", lighting.ID), map[string]interface{}{"parent_id": officeChairs.ID})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Contains(t, w.Body.String(), "parent_id must not be the category itself or one of its descendants")
+
+	// A null parent moves the category to the root, a missing one leaves it in place
+	w = send("PATCH", fmt.Sprintf("/categories/%d", chairs.ID), map[string]interface{}{"parent_id": nil, "name": "Seating"})
+	assert.Equal(t, http.StatusOK, w.Code)
+	var updated CategoryResponse
+	err = json.Unmarshal(w.Body.Bytes(), &updated)
+	assert.NoError(t, err)
+	assert.Nil(t, updated.Category.ParentID)
+	assert.Equal(t, "Seating", updated.Category.Name)
+	assert.Equal(t, fmt.Sprintf("/%d/", chairs.ID), updated.Category.Path)
+	w = send("PATCH", fmt.Sprintf("/categories/%d", chairs.ID), map[string]interface{}{"name": "Seating"})
+	assert.Contains(t, w.Body.String(), "No changes detected, category update not performed")
+	assert.Equal(t, http.StatusBadRequest, send("PATCH", fmt.Sprintf("/categories/%d", chairs.ID), map[string]interface{}{"name": ""}).Code)
+
+	// Categories with subcategories cannot be deleted, deleting a category only unlinks its products
+	w = send("DELETE", fmt.Sprintf("/categories/%d", chairs.ID), nil)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Contains(t, w.Body.String(), `"code":"category_not_empty"`)
+	assert.Equal(t, http.StatusOK, send("DELETE", fmt.Sprintf("/categories/%d", officeChairs.ID), nil).Code)
+	assert.Equal(t, []uint{lighting.ID}, categoryIDs(listCategories(fmt.Sprintf("/products/%d/categories", deskChair)).Data))
+
+	assert.Equal(t, http.StatusOK, send("DELETE", fmt.Sprintf("/categories/%d/products/%d", chairs.ID, stool), nil).Code)
+	assert.Equal(t, http.StatusNotFound, send("DELETE", fmt.Sprintf("/categories/%d/products/%d", chairs.ID, stool), nil).Code)
+	assert.Equal(t, http.StatusOK, send("DELETE", fmt.Sprintf("/categories/%d", chairs.ID), nil).Code)
+
+	// Purged products leave their categories
+	assert.NoError(t, testRepo.Purge(context.Background(), uint64(lamp), 0))
+	assert.Equal(t, []uint{deskChair}, productIDs(listProducts(fmt.Sprintf("/categories/%d/products", lighting.ID)).Data))
+
+	w = send("GET", fmt.Sprintf("/categories/%d", chairs.ID), nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Contains(t, w.Body.String(), `"code":"category_not_found"`)
+	assert.Equal(t, http.StatusNotFound, send("GET", fmt.Sprintf("/categories/%d/products", chairs.ID), nil).Code)
+	assert.Equal(t, http.StatusBadRequest, send("GET", "/categories/abc", nil).Code)
+
+	cleanupProducts(t)
+}
+
+func TestProductTags(t *testing.T) {
+	type TagsResponse struct {
+		Total int                   `json:"total"`
+		Data  []repository.TagCount `json:"data"`
+	}
+
+	send := func(method, url, ifMatch string, body interface{}) *httptest.ResponseRecorder {
+		jsonValue, _ := json.Marshal(body)
+		req, _ := http.NewRequest(method, url, bytes.NewBuffer(jsonValue))
+		req.Header.Set("Content-Type", "application/json")
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		w := httptest.NewRecorder()
+		testRouter.ServeHTTP(w, req)
+		return w
+	}
+	listProductIDs := func(query string) []uint {
+		w := send("GET", "/products?"+query, "", nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var response GetProductsResponse
+		err := json.Unmarshal(w.Body.Bytes(), &response)
+		assert.NoError(t, err)
+		ids := []uint{}
+		for _, product := range response.Data {
+			ids = append(ids, product.ID)
+		}
+		return ids
+	}
+
+	// Tags are stored lowercase, without repeated spaces or duplicates
+	w := send("POST", "/products", "", map[string]interface{}{"name": "Sandals", "price": 25.00, "tags": []string{" Summer ", "NEW", "summer"}})
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var created CreateUpdateProductResponse
+	err := json.Unmarshal(w.Body.Bytes(), &created)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"new", "summer"}, created.Product.Tags)
+	sandals := created.Product.ID
+
+	w = send("POST", "/products", "", map[string]interface{}{"name": "Sandals", "price": 25.00, "tags": []string{"red,blue"}})
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	var errorResponse ErrorResponse
+	err = json.Unmarshal(w.Body.Bytes(), &errorResponse)
+	assert.NoError(t, err)
+	if assert.Len(t, errorResponse.Errors, 1) {
+		assert.Equal(t, "tags[0]", errorResponse.Errors[0].Field)
+	}
+
+	ids := createTestProducts(t, []models.Product{
+		{Name: "Parasol", Price: 40.00, Tags: []string{"Clearance", "summer"}},
+		{Name: "Scarf", Price: 15.00},
+		{Name: "Old Hat", Price: 5.00, Tags: []string{"summer"}},
+	})
+	parasol, scarf, oldHat := ids[0], ids[1], ids[2]
+	assert.NoError(t, testRepo.Delete(context.Background(), uint64(oldHat), 0))
+
+	w = send("GET", fmt.Sprintf("/products/%d", scarf), "", nil)
+	assert.Contains(t, w.Body.String(), `"tags":[]`)
+
+	// Adding tags is a change of the product, which honours If-Match and increments the version
+	scarfTagsURL := fmt.Sprintf("/products/%d/tags", scarf)
+	assert.Equal(t, http.StatusPreconditionFailed, send("POST", scarfTagsURL, `"2"`, map[string]interface{}{"tags": []string{"clearance"}}).Code)
+	w = send("POST", scarfTagsURL, `"1"`, map[string]interface{}{"tags": []string{"CLEARANCE"}})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `"2"`, w.Header().Get("ETag"))
+	var tagged CreateUpdateProductResponse
+	err = json.Unmarshal(w.Body.Bytes(), &tagged)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"clearance"}, tagged.Product.Tags)
+
+	w = send("POST", scarfTagsURL, "", map[string]interface{}{"tags": []string{"clearance"}})
+	assert.Contains(t, w.Body.String(), "No changes detected, product tags not changed")
+	assert.Equal(t, http.StatusBadRequest, send("POST", scarfTagsURL, "", map[string]interface{}{"tags": []string{}}).Code)
+	tooMany := make([]string, models.MaxProductTags)
+	for i := range tooMany {
+		tooMany[i] = fmt.Sprintf("tag %d", i)
+	}
+	assert.Equal(t, http.StatusBadRequest, send("POST", scarfTagsURL, "", map[string]interface{}{"tags": tooMany}).Code)
+
+	w = send("GET", fmt.Sprintf("/products/%d/history", scarf), "", nil)
+	assert.Contains(t, w.Body.String(), `"tags":{"before":null,"after":["clearance"]}`)
+
+	// Products are filtered by any or all of the tags
+	assert.Equal(t, []uint{sandals, parasol}, listProductIDs("tags=summer"))
+	assert.Equal(t, []uint{sandals, parasol, scarf}, listProductIDs("tags=summer,clearance"))
+	assert.Equal(t, []uint{sandals, parasol, scarf}, listProductIDs("tags=summer,clearance&tag_mode=any"))
+	assert.Equal(t, []uint{parasol}, listProductIDs("tags=summer,clearance&tag_mode=all"))
+	assert.Equal(t, []uint{sandals}, listProductIDs("tags=SUMMER,new&tag_mode=all&max_price=30"))
+	assert.Equal(t, []uint{}, listProductIDs("tags=winter"))
+	assert.Equal(t, http.StatusBadRequest, send("GET", "/products?tags=,", "", nil).Code)
+	assert.Equal(t, http.StatusBadRequest, send("GET", "/products?tags=summer&tag_mode=some", "", nil).Code)
+
+	// Tags are counted over the live products, most used first
+	w = send("GET", "/tags", "", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var tags TagsResponse
+	err = json.Unmarshal(w.Body.Bytes(), &tags)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, tags.Total)
+	assert.Equal(t, []repository.TagCount{{Tag: "clearance", Count: 2}, {Tag: "summer", Count: 2}, {Tag: "new", Count: 1}}, tags.Data)
+
+	// Removing a tag matches it in any case
+	w = send("DELETE", fmt.Sprintf("/products/%d/tags/NEW", sandals), "", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"tags":["summer"]`)
+	w = send("DELETE", fmt.Sprintf("/products/%d/tags/new", sandals), "", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Contains(t, w.Body.String(), `"code":"tag_not_found"`)
+	assert.Equal(t, http.StatusNotFound, send("DELETE", "/products/999/tags/new", "", nil).Code)
+
+	w = send("GET", "/tags?limit=1&page=3", "", nil)
+	err = json.Unmarshal(w.Body.Bytes(), &tags)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, tags.Total)
+	assert.Empty(t, tags.Data)
+
+	// Versions snapshot the tags, so past reads and tag filters, diffs and reverts use the tags of the time
+	sandalsURL := fmt.Sprintf("/products/%d", sandals)
+	w = send("GET", sandalsURL+"/versions", "", nil)
+	var versions struct {
+		Data []models.ProductVersion `json:"data"`
+	}
+	err = json.Unmarshal(w.Body.Bytes(), &versions)
+	assert.NoError(t, err)
+	if assert.Len(t, versions.Data, 2) {
+		assert.Equal(t, []string{"new", "summer"}, versions.Data[0].Tags)
+		asOf := url.QueryEscape(versions.Data[0].ValidFrom.Format(time.RFC3339Nano))
+		assert.Equal(t, []uint{sandals}, listProductIDs("tags=new&as_of="+asOf))
+		assert.Equal(t, []uint{sandals}, listProductIDs("tags=summer,new&tag_mode=all&as_of="+asOf))
+		w = send("GET", sandalsURL+"?as_of="+asOf, "", nil)
+		assert.Contains(t, w.Body.String(), `"tags":["new","summer"]`)
+	}
+	w = send("GET", sandalsURL+"/versions/1/diff/2", "", nil)
+	assert.Contains(t, w.Body.String(), `"tags":{"before":["new","summer"],"after":["summer"]}`)
+	w = send("POST", sandalsURL+"/revert?version=1", "", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"tags":["new","summer"]`)
+
+	cleanupProducts(t)
+}
+
+func TestProductVariants(t *testing.T) {
+	type VariantResponse struct {
+		Message string         `json:"message"`
+		Variant models.Variant `json:"variant"`
+	}
+	type ProductWithVariants struct {
+		models.Product
+		Variants []models.Variant `json:"variants"`
+	}
+
+	send := func(method, url, ifMatch string, body interface{}) *httptest.ResponseRecorder {
+		jsonValue, _ := json.Marshal(body)
+		req, _ := http.NewRequest(method, url, bytes.NewBuffer(jsonValue))
+		req.Header.Set("Content-Type", "application/json")
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		w := httptest.NewRecorder()
+		testRouter.ServeHTTP(w, req)
+		return w
+	}
+	createVariant := func(url string, body interface{}) models.Variant {
+		w := send("POST", url, "", body)
+		assert.Equal(t, http.StatusCreated, w.Code)
+		var response VariantResponse
+		err := json.Unmarshal(w.Body.Bytes(), &response)
+		assert.NoError(t, err)
+		return response.Variant
+	}
+	assertFieldError := func(w *httptest.ResponseRecorder, field, rule string) {
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		var errorResponse ErrorResponse
+		err := json.Unmarshal(w.Body.Bytes(), &errorResponse)
+		assert.NoError(t, err)
+		if assert.Len(t, errorResponse.Errors, 1) {
+			assert.Equal(t, field, errorResponse.Errors[0].Field)
+			assert.Equal(t, rule, errorResponse.Errors[0].Rule)
+		}
+	}
+
+	ids := createTestProducts(t, []models.Product{{Name: "T-Shirt", Price: 20.00}, {Name: "Sweater", Price: 45.00}})
+	shirt, sweater := ids[0], ids[1]
+	variantsURL := fmt.Sprintf("/products/%d/variants", shirt)
+
+	// Options are normalized, the price override and attributes are optional
+	small := createVariant(variantsURL, map[string]interface{}{
+		"sku": "TS-S-RED", "options": map[string]string{" Size ": "S", "Color": " red "}, "price": 18.50,
+		"attributes": map[string]interface{}{"weight_g": 150},
+	})
+	assert.Equal(t, shirt, small.ProductID)
+	assert.Equal(t, map[string]string{"size": "S", "color": "red"}, small.Options)
+	if assert.NotNil(t, small.Price) {
+		assert.Equal(t, 18.50, *small.Price)
+	}
+	assert.Equal(t, map[string]interface{}{"weight_g": float64(150)}, small.Attributes)
+
+	// Every variant change increments the product version and honours If-Match
+	assert.Equal(t, http.StatusPreconditionFailed, send("POST", variantsURL, `"1"`, map[string]interface{}{
+		"sku": "TS-M-RED", "options": map[string]string{"size": "M", "color": "red"},
+	}).Code)
+	w := send("POST", variantsURL, `"2"`, map[string]interface{}{"sku": "TS-M-RED", "options": map[string]string{"size": "M", "color": "red"}})
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, `"3"`, w.Header().Get("ETag"))
+	var medium VariantResponse
+	err := json.Unmarshal(w.Body.Bytes(), &medium)
+	assert.NoError(t, err)
+	assert.Nil(t, medium.Variant.Price)
+	assert.Equal(t, map[string]interface{}{}, medium.Variant.Attributes)
+
+	// SKUs are unique across products, option combinations within a product, and all variants share the same axes
+	assertFieldError(send("POST", fmt.Sprintf("/products/%d/variants", sweater), "", map[string]interface{}{
+		"sku": "TS-S-RED", "options": map[string]string{"size": "S"},
+	}), "sku", "unique")
+	assertFieldError(send("POST", variantsURL, "", map[string]interface{}{
+		"sku": "TS-S-RED-2", "options": map[string]string{"SIZE": "S", "color": "red"},
+	}), "options", "unique")
+	assertFieldError(send("POST", variantsURL, "", map[string]interface{}{
+		"sku": "TS-S", "options": map[string]string{"size": "S"},
+	}), "options", "axes")
+	assertFieldError(send("POST", variantsURL, "", map[string]interface{}{"sku": "TS-L-RED", "options": map[string]string{}}), "options", "min")
+	assertFieldError(send("POST", variantsURL, "", map[string]interface{}{"options": map[string]string{"size": "L", "color": "red"}}), "sku", "required")
+	assertFieldError(send("POST", variantsURL, "", map[string]interface{}{
+		"sku": "TS-L-RED", "options": map[string]string{"size": "L", "Size": "XL", "color": "red"},
+	}), "options", "invalid")
+
+	// The product embeds its variants in creation order
+	w = send("GET", fmt.Sprintf("/products/%d", shirt), "", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `"3"`, w.Header().Get("ETag"))
+	var product ProductWithVariants
+	err = json.Unmarshal(w.Body.Bytes(), &product)
+	assert.NoError(t, err)
+	assert.Equal(t, "T-Shirt", product.Name)
+	if assert.Len(t, product.Variants, 2) {
+		assert.Equal(t, small.ID, product.Variants[0].ID)
+		assert.Equal(t, medium.Variant.ID, product.Variants[1].ID)
+	}
+	w = send("GET", fmt.Sprintf("/products/%d", sweater), "", nil)
+	assert.Contains(t, w.Body.String(), `"variants":[]`)
+
+	// Variants are not versioned, so past products are read without them
+	w = send("GET", fmt.Sprintf("/products/%d?as_of=%s", shirt, url.QueryEscape(time.Now().Format(time.RFC3339Nano))), "", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"name":"T-Shirt"`)
+	assert.NotContains(t, w.Body.String(), `"variants"`)
+
+	w = send("GET", variantsURL, "", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"sku":"TS-M-RED"`)
+
+	// Updates change the given fields only, a null price removes the override
+	smallURL := fmt.Sprintf("%s/%d", variantsURL, small.ID)
+	w = send("PATCH", smallURL, "", map[string]interface{}{"price": nil, "options": map[string]string{"size": "s", "color": "red"}})
+	assert.Equal(t, http.StatusOK, w.Code)
+	var updated VariantResponse
+	err = json.Unmarshal(w.Body.Bytes(), &updated)
+	assert.NoError(t, err)
+	assert.Equal(t, "TS-S-RED", updated.Variant.SKU)
+	assert.Equal(t, map[string]string{"size": "s", "color": "red"}, updated.Variant.Options)
+	assert.Nil(t, updated.Variant.Price)
+	assert.Equal(t, `"4"`, w.Header().Get("ETag"))
+
+	w = send("PATCH", smallURL, "", map[string]interface{}{"sku": "TS-S-RED"})
+	assert.Contains(t, w.Body.String(), "No changes detected, variant update not performed")
+	assertFieldError(send("PATCH", smallURL, "", map[string]interface{}{"options": map[string]string{"size": "M", "color": "red"}}), "options", "unique")
+	assertFieldError(send("PATCH", smallURL, "", map[string]interface{}{"sku": "TS-M-RED"}), "sku", "unique")
+
+	w = send("GET", smallURL, "", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"sku":"TS-S-RED"`)
+
+	// Variant changes are recorded as updates of the product
+	w = send("GET", fmt.Sprintf("/products/%d/history", shirt), "", nil)
+	var history struct {
+		Data []models.AuditRecord `json:"data"`
+	}
+	err = json.Unmarshal(w.Body.Bytes(), &history)
+	assert.NoError(t, err)
+	if assert.Len(t, history.Data, 4) {
+		assert.Equal(t, models.AuditActionUpdate, history.Data[1].Action)
+		assert.Equal(t, uint(2), history.Data[1].Version)
+		assert.Nil(t, history.Data[1].Changes["variants"].Before)
+		assert.Equal(t, "TS-S-RED", history.Data[1].Changes["variants"].After.(map[string]interface{})["sku"])
+	}
+
+	// Variants are only reachable through their product
+	assert.Equal(t, http.StatusNotFound, send("GET", fmt.Sprintf("/products/%d/variants/%d", sweater, small.ID), "", nil).Code)
+	w = send("DELETE", smallURL, "", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, `"5"`, w.Header().Get("ETag"))
+	w = send("DELETE", smallURL, "", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Contains(t, w.Body.String(), `"code":"variant_not_found"`)
+	assert.Equal(t, http.StatusBadRequest, send("GET", variantsURL+"/abc", "", nil).Code)
+
+	// Variants of trashed products cannot be reached, and are removed when the product is purged
+	assert.NoError(t, testRepo.Delete(context.Background(), uint64(shirt), 0))
+	assert.Equal(t, http.StatusNotFound, send("GET", variantsURL, "", nil).Code)
+	assert.NoError(t, testRepo.Purge(context.Background(), uint64(shirt), 0))
+	createVariant(fmt.Sprintf("/products/%d/variants", sweater), map[string]interface{}{
+		"sku": "TS-M-RED", "options": map[string]string{"size": "M"},
+	})
+
+	cleanupProducts(t)
+}
+
+func TestProductAttributes(t *testing.T) {
+	type SchemaResponse struct {
+		Message string                 `json:"message"`
+		Schema  models.AttributeSchema `json:"schema"`
+	}
+	type ProductResponse struct {
+		Message string         `json:"message"`
+		Product models.Product `json:"product"`
+	}
+
+	send := func(method, url string, body interface{}) *httptest.ResponseRecorder {
+		jsonValue, _ := json.Marshal(body)
+		req, _ := http.NewRequest(method, url, bytes.NewBuffer(jsonValue))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		testRouter.ServeHTTP(w, req)
+		return w
+	}
+	createSchema := func(body interface{}) models.AttributeSchema {
+		w := send("POST", "/attribute-schemas", body)
+		assert.Equal(t, http.StatusCreated, w.Code)
+		var response SchemaResponse
+		err := json.Unmarshal(w.Body.Bytes(), &response)
+		assert.NoError(t, err)
+		return response.Schema
+	}
+	createProduct := func(body interface{}) models.Product {
+		w := send("POST", "/products", body)
+		assert.Equal(t, http.StatusCreated, w.Code)
+		var response ProductResponse
+		err := json.Unmarshal(w.Body.Bytes(), &response)
+		assert.NoError(t, err)
+		return response.Product
+	}
+	assertFieldError := func(w *httptest.ResponseRecorder, field, rule string) {
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+		var errorResponse ErrorResponse
+		err := json.Unmarshal(w.Body.Bytes(), &errorResponse)
+		assert.NoError(t, err)
+		if assert.Len(t, errorResponse.Errors, 1) {
+			assert.Equal(t, field, errorResponse.Errors[0].Field)
+			assert.Equal(t, rule, errorResponse.Errors[0].Rule)
+		}
+	}
+	listProducts := func(query string) []uint {
+		w := send("GET", "/products?"+query, nil)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var response GetProductsResponse
+		err := json.Unmarshal(w.Body.Bytes(), &response)
+		assert.NoError(t, err)
+		ids := []uint{}
+		for _, product := range response.Data {
+			ids = append(ids, product.ID)
+		}
+		return ids
+	}
+	createCategory := func(name string, parentID *uint) models.Category {
+		w := send("POST", "/categories", map[string]interface{}{"name": name, "parent_id": parentID})
+		assert.Equal(t, http.StatusCreated, w.Code)
+		var response struct {
+			Category models.Category `json:"category"`
+		}
+		err := json.Unmarshal(w.Body.Bytes(), &response)
+		assert.NoError(t, err)
+		return response.Category
+	}
+
+	// Schemas apply to either a product type or a category, and define each attribute once
+	books := createSchema(map[string]interface{}{"product_type": "book", "attributes": []map[string]interface{}{
+		{"name": "isbn", "type": "string", "required": true},
+		{"name": "pages", "type": "integer", "min": 1},
+		{"name": "format", "type": "string", "values": []string{"hardcover", "paperback"}},
+	}})
+	if assert.NotNil(t, books.ProductType) {
+		assert.Equal(t, "book", *books.ProductType)
+	}
+	assert.Len(t, books.Attributes, 3)
+
+	furniture := createCategory("Furniture", nil)
+	chairs := createCategory("Chairs", &furniture.ID)
+	assertFieldError(send("POST", "/attribute-schemas", map[string]interface{}{"attributes": []interface{}{}}), "product_type", "required_without")
+	assertFieldError(send("POST", "/attribute-schemas", map[string]interface{}{
+		"product_type": "chair", "category_id": chairs.ID, "attributes": []interface{}{},
+	}), "category_id", "excluded_with")
+	assertFieldError(send("POST", "/attribute-schemas", map[string]interface{}{"product_type": "book", "attributes": []interface{}{}}), "product_type", "unique")
+	assertFieldError(send("POST", "/attribute-schemas", map[string]interface{}{"category_id": 999, "attributes": []interface{}{}}), "category_id", "exists")
+	assertFieldError(send("POST", "/attribute-schemas", map[string]interface{}{"product_type": "lamp", "attributes": []map[string]interface{}{
+		{"name": "Color", "type": "string"},
+	}}), "attributes[0].name", "invalid")
+	assertFieldError(send("POST", "/attribute-schemas", map[string]interface{}{"product_type": "lamp", "attributes": []map[string]interface{}{
+		{"name": "watts", "type": "number"}, {"name": "watts", "type": "integer"},
+	}}), "attributes[1].name", "unique")
+	assertFieldError(send("POST", "/attribute-schemas", map[string]interface{}{"product_type": "lamp", "attributes": []map[string]interface{}{
+		{"name": "watts", "type": "number", "values": []string{"40"}},
+	}}), "attributes[0].values", "invalid")
+	assertFieldError(send("POST", "/attribute-schemas", map[string]interface{}{"product_type": "lamp", "attributes": []map[string]interface{}{
+		{"name": "watts", "type": "float"},
+	}}), "attributes[0].type", "oneof")
+	createSchema(map[string]interface{}{"category_id": furniture.ID, "attributes": []map[string]interface{}{
+		{"name": "weight_kg", "type": "number", "required": true, "min": 0},
+		{"name": "color", "type": "string"},
+	}})
+
+	w := send("GET", "/attribute-schemas", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Contains(t, w.Body.String(), `"total":2`)
+	schemaURL := fmt.Sprintf("/attribute-schemas/%d", books.ID)
+	assert.Equal(t, http.StatusOK, send("GET", schemaURL, nil).Code)
+	w = send("GET", "/attribute-schemas/999", nil)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Contains(t, w.Body.String(), `"code":"attribute_schema_not_found"`)
+	assert.Equal(t, http.StatusBadRequest, send("GET", "/attribute-schemas/abc", nil).Code)
+
+	// Products of a type must match its schema, null attributes are left out
+	assertFieldError(send("POST", "/products", map[string]interface{}{
+		"name": "Go Book", "price": 30.00, "type": "book", "attributes": map[string]interface{}{"pages": 320},
+	}), "attributes[isbn]", "required")
+	assertFieldError(send("POST", "/products", map[string]interface{}{
+		"name": "Go Book", "price": 30.00, "type": "book", "attributes": map[string]interface{}{"isbn": "978-0134190440", "pages": 320.5},
+	}), "attributes[pages]", "type")
+	assertFieldError(send("POST", "/products", map[string]interface{}{
+		"name": "Go Book", "price": 30.00, "type": "book", "attributes": map[string]interface{}{"isbn": "978-0134190440", "format": "scroll"},
+	}), "attributes[format]", "oneof")
+	assertFieldError(send("POST", "/products", map[string]interface{}{
+		"name": "Lamp", "price": 30.00, "attributes": map[string]interface{}{"Color": "red"},
+	}), "attributes[Color]", "invalid")
+	book := createProduct(map[string]interface{}{
+		"name": "Go Book", "price": 30.00, "type": "book",
+		"attributes": map[string]interface{}{"isbn": "978-0134190440", "pages": 320, "format": "paperback", "signed": nil},
+	})
+	assert.Equal(t, "book", book.Type)
+	assert.Equal(t, map[string]interface{}{"isbn": "978-0134190440", "pages": float64(320), "format": "paperback"}, book.Attributes)
+
+	w = send("POST", "/products/bulk?mode=best_effort", []interface{}{
+		map[string]interface{}{"name": "Bad Book", "price": 10.00, "type": "book"},
+	})
+	assert.Equal(t, http.StatusMultiStatus, w.Code)
+	assert.Contains(t, w.Body.String(), "attributes[isbn] is required")
+
+	// Category schemas apply to the products of the category and of its subcategories when they are added or changed
+	chair := createProduct(map[string]interface{}{"name": "Chair", "price": 80.00, "attributes": map[string]interface{}{"color": "red", "weight_kg": 5}})
+	stool := createProduct(map[string]interface{}{"name": "Stool", "price": 25.00, "attributes": map[string]interface{}{"color": "blue", "weight_kg": 1.5}})
+	lamp := createProduct(map[string]interface{}{"name": "Lamp", "price": 40.00, "attributes": map[string]interface{}{"color": "red"}})
+	assertFieldError(send("POST", fmt.Sprintf("/categories/%d/products", chairs.ID), map[string]interface{}{"product_ids": []uint{chair.ID, lamp.ID}}),
+		"product_ids[1].attributes[weight_kg]", "required")
+	assert.Equal(t, http.StatusOK, send("POST", fmt.Sprintf("/categories/%d/products", chairs.ID), map[string]interface{}{"product_ids": []uint{chair.ID, stool.ID}}).Code)
+
+	// Moving a category checks the products of its subtree against the schemas of its new ancestors
+	lighting := createCategory("Lighting", nil)
+	deskLamps := createCategory("Desk Lamps", &lighting.ID)
+	assert.Equal(t, http.StatusOK, send("POST", fmt.Sprintf("/categories/%d/products", deskLamps.ID), map[string]interface{}{"product_ids": []uint{lamp.ID}}).Code)
+	lightingURL := fmt.Sprintf("/categories/%d", lighting.ID)
+	assertFieldError(send("PATCH", lightingURL, map[string]interface{}{"parent_id": furniture.ID}), fmt.Sprintf("products[%d].attributes[weight_kg]", lamp.ID), "required")
+	w = send("GET", lightingURL, nil)
+	assert.Contains(t, w.Body.String(), `"parent_id":null`)
+	outdoor := createCategory("Outdoor", nil)
+	assert.Equal(t, http.StatusOK, send("PATCH", fmt.Sprintf("/categories/%d", outdoor.ID), map[string]interface{}{"parent_id": furniture.ID}).Code)
+
+	stoolURL := fmt.Sprintf("/products/%d", stool.ID)
+	assertFieldError(send("PATCH", stoolURL, map[string]interface{}{"attributes": map[string]interface{}{"weight_kg": nil}}), "attributes[weight_kg]", "required")
+	assertFieldError(send("PATCH", stoolURL, map[string]interface{}{"attributes": map[string]interface{}{"weight_kg": -1}}), "attributes[weight_kg]", "gte")
+	w = send("PATCH", stoolURL, map[string]interface{}{"attributes": map[string]interface{}{"weight_kg": 2, "color": nil}})
+	assert.Equal(t, http.StatusOK, w.Code)
+	var updated ProductResponse
+	err := json.Unmarshal(w.Body.Bytes(), &updated)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"weight_kg": float64(2)}, updated.Product.Attributes)
+	w = send("PATCH", stoolURL, map[string]interface{}{"attributes": map[string]interface{}{"weight_kg": 2}})
+	assert.Contains(t, w.Body.String(), "No changes detected")
+	assertFieldError(send("PATCH", stoolURL, map[string]interface{}{"type": "book"}), "attributes[isbn]", "required")
+
+	// Attribute changes are audited
+	w = send("GET", stoolURL+"/history", nil)
+	var history struct {
+		Data []models.AuditRecord `json:"data"`
+	}
+	err = json.Unmarshal(w.Body.Bytes(), &history)
+	assert.NoError(t, err)
+	if assert.Len(t, history.Data, 2) {
+		assert.Equal(t, map[string]interface{}{"color": "blue", "weight_kg": 1.5}, history.Data[1].Changes["attributes"].Before)
+		assert.Equal(t, map[string]interface{}{"weight_kg": float64(2)}, history.Data[1].Changes["attributes"].After)
+	}
+
+	// Products are filtered on their type and on attribute values, numbers compare by value
+	assert.Equal(t, []uint{chair.ID, lamp.ID}, listProducts("attr.color=red"))
+	assert.Equal(t, []uint{chair.ID, stool.ID}, listProducts("attr.weight_kg[gte]=2"))
+	assert.Equal(t, []uint{chair.ID}, listProducts("attr.color=red&attr.weight_kg[gt]=2"))
+	assert.Equal(t, []uint{book.ID, stool.ID}, listProducts("attr.color[ne]=red"))
+	assert.Equal(t, []uint{book.ID}, listProducts("attr.pages=320.0"))
+	assert.Equal(t, []uint{book.ID}, listProducts("type=book"))
+	assert.Equal(t, []uint{}, listProducts("attr.isbn[lt]=5"))
+	assert.Equal(t, http.StatusBadRequest, send("GET", "/products?attr.weight_kg[gte]=heavy", nil).Code)
+	assert.Equal(t, http.StatusBadRequest, send("GET", "/products?attr.color[like]=red", nil).Code)
+	assert.Equal(t, http.StatusBadRequest, send("GET", "/products?attr.Color=red", nil).Code)
+
+	// Versions snapshot the type and attributes, so past reads, diffs and reverts include them
+	w = send("GET", stoolURL+"/versions", nil)
+	var versions struct {
+		Data []models.ProductVersion `json:"data"`
+	}
+	err = json.Unmarshal(w.Body.Bytes(), &versions)
+	assert.NoError(t, err)
+	if assert.Len(t, versions.Data, 2) {
+		assert.Equal(t, map[string]interface{}{"color": "blue", "weight_kg": 1.5}, versions.Data[0].Attributes)
+		w = send("GET", stoolURL+"?as_of="+url.QueryEscape(versions.Data[0].ValidFrom.Format(time.RFC3339Nano)), nil)
+		var past models.Product
+		err = json.Unmarshal(w.Body.Bytes(), &past)
+		assert.NoError(t, err)
+		assert.Equal(t, map[string]interface{}{"color": "blue", "weight_kg": 1.5}, past.Attributes)
+	}
+	w = send("GET", stoolURL+"/versions/1/diff/2", nil)
+	assert.Contains(t, w.Body.String(), `"attributes":{"before":{"color":"blue","weight_kg":1.5},"after":{"weight_kg":2}}`)
+	w = send("POST", stoolURL+"/revert?version=1", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	err = json.Unmarshal(w.Body.Bytes(), &updated)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{"color": "blue", "weight_kg": 1.5}, updated.Product.Attributes)
+
+	// Schemas are replaced as a whole, and removed with their category
+	w = send("PUT", schemaURL, map[string]interface{}{"product_type": "book", "attributes": []map[string]interface{}{{"name": "isbn", "type": "string"}}})
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, http.StatusNotFound, send("PUT", "/attribute-schemas/999", map[string]interface{}{"product_type": "cd", "attributes": []interface{}{}}).Code)
+	assert.Equal(t, http.StatusOK, send("PATCH", stoolURL, map[string]interface{}{"type": "book"}).Code)
+
+	assert.Equal(t, http.StatusOK, send("DELETE", fmt.Sprintf("/categories/%d", chairs.ID), nil).Code)
+	assert.Equal(t, http.StatusOK, send("DELETE", fmt.Sprintf("/categories/%d", outdoor.ID), nil).Code)
+	assert.Equal(t, http.StatusOK, send("DELETE", fmt.Sprintf("/categories/%d", furniture.ID), nil).Code)
+	w = send("GET", "/attribute-schemas", nil)
+	assert.Contains(t, w.Body.String(), `"total":1`)
+	assert.Equal(t, http.StatusOK, send("DELETE", schemaURL, nil).Code)
+	assert.Equal(t, http.StatusNotFound, send("DELETE", schemaURL, nil).Code)
+
+	cleanupProducts(t)
+}
+
+func fieldErrorMessages(fieldErrors []problem.FieldError) []string {
+	messages := make([]string, len(fieldErrors))
+	for i, fieldError := range fieldErrors {
+		messages[i] = fieldError.Message
+	}
+	return messages
+}
+
 func createTestProducts(t *testing.T, products []models.Product) []uint {
 	var createdIDs []uint
 
 	for _, p := range products {
-		result := database.DB.Unscoped().Create(&p)
-		assert.NoError(t, result.Error)
+		err := testRepo.Create(context.Background(), &p)
+		assert.NoError(t, err)
 		createdIDs = append(createdIDs, p.ID)
 	}
 	return createdIDs
 }
 
 func cleanupProducts(t *testing.T) {
-	result := database.DB.Exec("TRUNCATE TABLE products RESTART IDENTITY")
-	assert.NoError(t, result.Error, "Failed to truncate products table")
+	err := resetStore()
+	assert.NoError(t, err, "Failed to reset the products store")
 }
@@ -0,0 +1,312 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"maps"
+	"math"
+	"net/http"
+	"products-api/models"
+	"products-api/problem"
+	"products-api/repository"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// AttributeSchemaController handles the endpoints of the attribute schemas of product types and categories
+type AttributeSchemaController struct {
+	schemas repository.AttributeSchemaRepository
+}
+
+// NewAttributeSchemaController creates an AttributeSchemaController backed by the given repository
+func NewAttributeSchemaController(schemas repository.AttributeSchemaRepository) *AttributeSchemaController {
+	return &AttributeSchemaController{schemas: schemas}
+}
+
+// attributeSchemaInput holds the fields of a new or replaced attribute schema
+type attributeSchemaInput struct {
+	ProductType *string                      `json:"product_type" binding:"omitempty,min=1,max=50"`
+	CategoryID  *uint                        `json:"category_id"`
+	Attributes  []models.AttributeDefinition `json:"attributes" binding:"required,dive"`
+}
+
+// Utility function to check the rules of an attribute schema that binding tags cannot express
+func validateAttributeSchema(input attributeSchemaInput) error {
+	var fieldErrors problem.ValidationError
+	switch {
+	case input.ProductType == nil && input.CategoryID == nil:
+		fieldErrors = append(fieldErrors, problem.NewFieldError("product_type", "required_without", "category_id"))
+	case input.ProductType != nil && input.CategoryID != nil:
+		fieldErrors = append(fieldErrors, problem.NewFieldError("category_id", "excluded_with", "product_type"))
+	}
+
+	names := make(map[string]bool, len(input.Attributes))
+	for i, definition := range input.Attributes {
+		field := fmt.Sprintf("attributes[%d]", i)
+		numeric := definition.Type == models.AttributeTypeNumber || definition.Type == models.AttributeTypeInteger
+		switch {
+		case !models.ValidAttributeName(definition.Name):
+			fieldErrors = append(fieldErrors, problem.NewFieldError(field+".name", "invalid", ""))
+		case names[definition.Name]:
+			fieldErrors = append(fieldErrors, problem.NewFieldError(field+".name", "unique", ""))
+		case definition.Values != nil && definition.Type != models.AttributeTypeString:
+			fieldErrors = append(fieldErrors, problem.NewFieldError(field+".values", "invalid", ""))
+		case (definition.Min != nil || definition.Max != nil) && !numeric:
+			fieldErrors = append(fieldErrors, problem.NewFieldError(field+".min", "invalid", ""))
+		case definition.Min != nil && definition.Max != nil && *definition.Max < *definition.Min:
+			fieldErrors = append(fieldErrors, problem.NewFieldError(field+".max", "gte", strconv.FormatFloat(*definition.Min, 'f', -1, 64)))
+		}
+		names[definition.Name] = true
+	}
+
+	if fieldErrors != nil {
+		return fieldErrors
+	}
+	return nil
+}
+
+// Utility function to parse an attribute schema ID from the URL parameters
+func parseAttributeSchemaID(c *gin.Context) (uint64, error) {
+	schemaId, err := strconv.ParseUint(c.Param("id"), 10, 0)
+	if err != nil {
+		problem.Respond(c, http.StatusBadRequest, problem.CodeInvalidParameter, "Invalid attribute schema ID format")
+	}
+	return schemaId, err
+}
+
+// Utility function to respond to the failure of an attribute schema operation
+func handleAttributeSchemaError(c *gin.Context, err error, schema models.AttributeSchema, errorMessage string) {
+	switch {
+	case errors.Is(err, repository.ErrAttributeSchemaNotFound):
+		problem.Respond(c, http.StatusNotFound, problem.CodeAttributeSchemaNotFound, "Attribute schema not found")
+	case errors.Is(err, repository.ErrSchemaCategoryNotFound):
+		problem.Send(c, problem.FromBindError(problem.ValidationError{problem.NewFieldError("category_id", "exists", "")}))
+	case errors.Is(err, repository.ErrDuplicateAttributeSchema):
+		field := "product_type"
+		if schema.CategoryID != nil {
+			field = "category_id"
+		}
+		problem.Send(c, problem.FromBindError(problem.ValidationError{problem.NewFieldError(field, "unique", "")}))
+	default:
+		handleDBError(c, err, errorMessage)
+	}
+}
+
+// Utility function to bind and check the body of the attribute schema endpoints
+func bindAttributeSchema(c *gin.Context) (models.AttributeSchema, bool) {
+	var input attributeSchemaInput
+	if !bindJSON(c, &input) {
+		return models.AttributeSchema{}, false
+	}
+	if err := validateAttributeSchema(input); err != nil {
+		problem.Send(c, problem.FromBindError(err))
+		return models.AttributeSchema{}, false
+	}
+	return models.AttributeSchema{ProductType: input.ProductType, CategoryID: input.CategoryID, Attributes: input.Attributes}, true
+}
+
+func (sc *AttributeSchemaController) CreateAttributeSchema(c *gin.Context) {
+	schema, ok := bindAttributeSchema(c)
+	if !ok {
+		return
+	}
+
+	if err := sc.schemas.Create(c.Request.Context(), &schema); err != nil {
+		handleAttributeSchemaError(c, err, schema, "Failed to create attribute schema")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Attribute schema created successfully",
+		"schema":  schema,
+	})
+}
+
+func (sc *AttributeSchemaController) GetAttributeSchemas(c *gin.Context) {
+	// Parse the pagination query parameters
+	page, limit, ok := parsePagination(c)
+	if !ok {
+		return
+	}
+
+	schemas, total, err := sc.schemas.List(c.Request.Context(), (page-1)*limit, limit)
+	if err != nil {
+		handleDBError(c, err, "Could not retrieve attribute schemas")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"total": total,
+		"page":  page,
+		"limit": limit,
+		"data":  schemas,
+	})
+}
+
+func (sc *AttributeSchemaController) GetAttributeSchemaById(c *gin.Context) {
+	schemaId, err := parseAttributeSchemaID(c)
+	if err != nil {
+		return
+	}
+
+	schema, err := sc.schemas.Get(c.Request.Context(), schemaId)
+	if err != nil {
+		handleAttributeSchemaError(c, err, models.AttributeSchema{}, "Could not retrieve attribute schema")
+		return
+	}
+
+	c.JSON(http.StatusOK, schema)
+}
+
+func (sc *AttributeSchemaController) UpdateAttributeSchema(c *gin.Context) {
+	schemaId, err := parseAttributeSchemaID(c)
+	if err != nil {
+		return
+	}
+
+	schema, ok := bindAttributeSchema(c)
+	if !ok {
+		return
+	}
+
+	// The schema is replaced as a whole, existing products are only checked against it when they change
+	schema.ID = uint(schemaId)
+	if err := sc.schemas.Update(c.Request.Context(), &schema); err != nil {
+		handleAttributeSchemaError(c, err, schema, "Could not update attribute schema")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Attribute schema updated successfully",
+		"schema":  schema,
+	})
+}
+
+func (sc *AttributeSchemaController) DeleteAttributeSchema(c *gin.Context) {
+	schemaId, err := parseAttributeSchemaID(c)
+	if err != nil {
+		return
+	}
+
+	if err := sc.schemas.Delete(c.Request.Context(), schemaId); err != nil {
+		handleAttributeSchemaError(c, err, models.AttributeSchema{}, "Could not delete attribute schema")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Attribute schema deleted successfully"})
+}
+
+// Utility function to merge attribute changes into the attributes of a product, without modifying them,
+// where a nil value removes the attribute
+func mergeAttributes(attributes, changes map[string]interface{}) map[string]interface{} {
+	merged := maps.Clone(attributes)
+	if merged == nil {
+		merged = map[string]interface{}{}
+	}
+	for name, value := range changes {
+		if value == nil {
+			delete(merged, name)
+		} else {
+			merged[name] = value
+		}
+	}
+	return merged
+}
+
+// validateAttributes checks the attributes of a product against the schemas of its type and of its categories,
+// including their ancestors, returning a problem.ValidationError when some attributes are invalid
+func (pc *ProductController) validateAttributes(ctx context.Context, product *models.Product) error {
+	// New products are in no category yet
+	var categoryIDs []uint
+	if product.ID != 0 {
+		categories, err := pc.categories.ListByProduct(ctx, uint64(product.ID))
+		if err != nil {
+			return err
+		}
+		for _, category := range categories {
+			categoryIDs = append(categoryIDs, category.PathIDs()...)
+		}
+	}
+
+	schemas, err := pc.schemas.ListApplicable(ctx, product.Type, categoryIDs)
+	if err != nil {
+		return err
+	}
+	if fieldErrors := checkAttributes("", product.Attributes, schemas); fieldErrors != nil {
+		return fieldErrors
+	}
+	return nil
+}
+
+// Utility function to check attributes against the definitions of the schemas, the fields of the errors
+// are prefixed with the path of the product in the request body
+func checkAttributes(path string, attributes map[string]interface{}, schemas []models.AttributeSchema) problem.ValidationError {
+	var fieldErrors problem.ValidationError
+	for _, name := range slices.Sorted(maps.Keys(attributes)) {
+		if !models.ValidAttributeName(name) {
+			fieldErrors = append(fieldErrors, problem.NewFieldError(path+"attributes["+name+"]", "invalid", ""))
+		}
+	}
+	for _, schema := range schemas {
+		for _, definition := range schema.Attributes {
+			if rule, param := definition.Check(attributes[definition.Name]); rule != "" {
+				fieldErrors = append(fieldErrors, problem.NewFieldError(path+"attributes["+definition.Name+"]", rule, param))
+			}
+		}
+	}
+	return fieldErrors
+}
+
+// Utility function to respond to a product whose attributes could not be validated
+func handleAttributesError(c *gin.Context, err error) {
+	if problem.FieldErrors(err) != nil {
+		problem.Send(c, problem.FromBindError(err))
+		return
+	}
+	handleDBError(c, err, "Could not retrieve attribute schemas")
+}
+
+// Utility function to parse the attribute filters of the list endpoints, such as attr.color=red
+// or attr.weight_kg[gte]=2, in the order of their names
+func parseAttributeFilters(c *gin.Context) ([]repository.AttributeCondition, bool) {
+	var conditions []repository.AttributeCondition
+	query := c.Request.URL.Query()
+	for _, key := range slices.Sorted(maps.Keys(query)) {
+		param, ok := strings.CutPrefix(key, "attr.")
+		if !ok {
+			continue
+		}
+
+		name, operator := param, repository.AttributeEq
+		if before, after, found := strings.Cut(param, "["); found && strings.HasSuffix(after, "]") {
+			name, operator = before, strings.TrimSuffix(after, "]")
+		}
+		if !models.ValidAttributeName(name) {
+			problem.Respond(c, http.StatusBadRequest, problem.CodeInvalidParameter, "Invalid "+key+", attribute names must be lowercase letters, digits and underscores")
+			return nil, false
+		}
+
+		for _, value := range query[key] {
+			condition := repository.AttributeCondition{Name: name, Operator: operator, Value: value}
+			if number, err := strconv.ParseFloat(value, 64); err == nil && !math.IsNaN(number) && !math.IsInf(number, 0) {
+				condition.Number = &number
+			}
+			switch operator {
+			case repository.AttributeEq, repository.AttributeNe:
+			case repository.AttributeGt, repository.AttributeGte, repository.AttributeLt, repository.AttributeLte:
+				if condition.Number == nil {
+					problem.Respond(c, http.StatusBadRequest, problem.CodeInvalidParameter, "Invalid "+key+", must be a number")
+					return nil, false
+				}
+			default:
+				problem.Respond(c, http.StatusBadRequest, problem.CodeInvalidParameter, "Invalid "+key+", the operator must be one of eq, ne, gt, gte, lt or lte")
+				return nil, false
+			}
+			conditions = append(conditions, condition)
+		}
+	}
+	return conditions, true
+}
@@ -0,0 +1,156 @@
+package controllers
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"products-api/models"
+	"products-api/problem"
+	"products-api/repository"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AuditController handles the endpoints reading the audit log of product changes
+type AuditController struct {
+	audit    repository.AuditRepository
+	products repository.ProductRepository
+}
+
+// NewAuditController creates an AuditController backed by the given repositories
+func NewAuditController(audit repository.AuditRepository, products repository.ProductRepository) *AuditController {
+	return &AuditController{audit: audit, products: products}
+}
+
+// Utility function to parse the audit filter from the query parameters
+func parseAuditFilter(c *gin.Context) (repository.AuditFilter, bool) {
+	filter := repository.AuditFilter{
+		Actor:  c.Query("actor"),
+		Action: c.Query("action"),
+	}
+
+	if filter.Action != "" && !slices.Contains(models.AuditActions, filter.Action) {
+		problem.Respond(c, http.StatusBadRequest, problem.CodeInvalidParameter, "Invalid action, must be one of "+strings.Join(models.AuditActions, ", "))
+		return filter, false
+	}
+
+	if productIdStr := c.Query("product_id"); productIdStr != "" {
+		productId, err := strconv.ParseUint(productIdStr, 10, 0)
+		if err != nil {
+			problem.Respond(c, http.StatusBadRequest, problem.CodeInvalidParameter, "Invalid product_id, must be a positive integer")
+			return filter, false
+		}
+		id := uint(productId)
+		filter.ProductID = &id
+	}
+
+	// Parse the time range query parameters
+	timeParams := []struct {
+		name   string
+		target **time.Time
+	}{
+		{"from", &filter.From},
+		{"to", &filter.To},
+	}
+	for _, param := range timeParams {
+		if valueStr := c.Query(param.name); valueStr != "" {
+			value, err := time.Parse(time.RFC3339, valueStr)
+			if err != nil {
+				problem.Respond(c, http.StatusBadRequest, problem.CodeInvalidParameter, "Invalid "+param.name+", must be an RFC3339 timestamp")
+				return filter, false
+			}
+			// Compare in UTC whatever the offset, as SQLite compares the stored times as text
+			value = value.UTC()
+			*param.target = &value
+		}
+	}
+	if filter.From != nil && filter.To != nil && filter.From.After(*filter.To) {
+		problem.Respond(c, http.StatusBadRequest, problem.CodeInvalidParameter, "Invalid time range, from must not be after to")
+		return filter, false
+	}
+
+	return filter, true
+}
+
+func (ac *AuditController) GetProductHistory(c *gin.Context) {
+	productId, err := parseProductID(c)
+	if err != nil {
+		return
+	}
+
+	// Parse the pagination query parameters
+	page, limit, ok := parsePagination(c)
+	if !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	// The history outlives the product, so it is kept after the product is purged
+	id := uint(productId)
+	records, total, err := ac.audit.List(ctx, repository.AuditListOptions{
+		Filter: repository.AuditFilter{ProductID: &id},
+		Offset: (page - 1) * limit,
+		Limit:  limit,
+	})
+	if err != nil {
+		handleDBError(c, err, "Could not retrieve product history")
+		return
+	}
+
+	// Products created before the audit log existed have no history but still exist
+	if total == 0 {
+		count, err := ac.products.Count(ctx, repository.ProductFilter{IDs: []uint{id}})
+		if err == nil && count == 0 {
+			count, err = ac.products.Count(ctx, repository.ProductFilter{IDs: []uint{id}, Trashed: true})
+		}
+		if err != nil {
+			handleDBError(c, err, "Could not retrieve product")
+			return
+		}
+		if count == 0 {
+			problem.Respond(c, http.StatusNotFound, problem.CodeProductNotFound, "Product not found")
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"product_id": id,
+		"total":      total,
+		"page":       page,
+		"limit":      limit,
+		"data":       records,
+	})
+}
+
+func (ac *AuditController) GetAuditLog(c *gin.Context) {
+	// Parse the pagination query parameters
+	page, limit, ok := parsePagination(c)
+	if !ok {
+		return
+	}
+
+	// Parse the filtering query parameters
+	filter, ok := parseAuditFilter(c)
+	if !ok {
+		return
+	}
+
+	records, total, err := ac.audit.List(c.Request.Context(), repository.AuditListOptions{
+		Filter: filter,
+		Offset: (page - 1) * limit,
+		Limit:  limit,
+	})
+	if err != nil {
+		handleDBError(c, err, "Could not retrieve audit log")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"total": total,
+		"page":  page,
+		"limit": limit,
+		"data":  records,
+	})
+}
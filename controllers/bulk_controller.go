@@ -0,0 +1,407 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"net/http"
+	"products-api/models"
+	"products-api/problem"
+	"products-api/repository"
+	"slices"
+	"strconv"
+)
+
+// Bulk request modes
+const (
+	bulkModeAtomic     = "atomic"      // Apply every item or none of them
+	bulkModeBestEffort = "best_effort" // Apply the valid items and report the others
+)
+
+// bulkItemResult reports the outcome of a single item of a bulk request, with an HTTP-like status
+type bulkItemResult struct {
+	Index   int                  `json:"index"`
+	Status  int                  `json:"status"`
+	Product *models.Product      `json:"product,omitempty"`
+	Error   string               `json:"error,omitempty"`
+	Details string               `json:"details,omitempty"`
+	Errors  []problem.FieldError `json:"errors,omitempty"`
+}
+
+// Utility function to parse the mode query parameter of bulk requests
+func parseBulkMode(c *gin.Context) (string, bool) {
+	switch mode := c.DefaultQuery("mode", bulkModeAtomic); mode {
+	case bulkModeAtomic, bulkModeBestEffort:
+		return mode, true
+	default:
+		problem.Respond(c, http.StatusBadRequest, problem.CodeInvalidParameter, "Invalid mode, must be atomic or best_effort")
+		return "", false
+	}
+}
+
+// Utility function to bind a JSON array of bulk items, enforcing the size limit
+func (pc *ProductController) bindBulkItems(c *gin.Context) ([]json.RawMessage, bool) {
+	var items []json.RawMessage
+	if err := c.ShouldBindJSON(&items); err != nil {
+		problem.Send(c, problem.FromBindError(err))
+		return nil, false
+	}
+	if len(items) == 0 {
+		problem.Respond(c, http.StatusBadRequest, problem.CodeInvalidBody, "At least one product is required")
+		return nil, false
+	}
+	if len(items) > pc.bulkMaxItems {
+		problem.Respond(c, http.StatusBadRequest, problem.CodeTooManyItems,
+			fmt.Sprintf("At most %d products can be sent in a single request", pc.bulkMaxItems))
+		return nil, false
+	}
+	return items, true
+}
+
+func (pc *ProductController) BulkCreateProducts(c *gin.Context) {
+	mode, ok := parseBulkMode(c)
+	if !ok {
+		return
+	}
+
+	items, ok := pc.bindBulkItems(c)
+	if !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	// Decode and validate every item with the same rules as CreateProduct
+	language := problem.Language(c)
+	results := make([]bulkItemResult, len(items))
+	products := make([]models.Product, len(items))
+	var invalid int
+	for i, item := range items {
+		results[i].Index = i
+		err := json.Unmarshal(item, &products[i])
+		if err == nil {
+			err = binding.Validator.ValidateStruct(&products[i])
+		}
+		if err == nil {
+			products[i].Attributes = mergeAttributes(nil, products[i].Attributes)
+			err = pc.validateAttributes(ctx, &products[i])
+			if err != nil && problem.FieldErrors(err) == nil {
+				handleDBError(c, err, "Could not retrieve attribute schemas")
+				return
+			}
+		}
+		if err != nil {
+			results[i].Status = http.StatusBadRequest
+			results[i].Error = "Invalid input"
+			results[i].Details = problem.Message(err, language)
+			results[i].Errors = problem.Localize(problem.FieldErrors(err), language)
+			invalid++
+		}
+	}
+
+	if mode == bulkModeAtomic {
+		if invalid > 0 {
+			// Nothing is created, so the valid items failed because of the invalid ones
+			for i := range results {
+				if results[i].Status == 0 {
+					results[i].Status = http.StatusFailedDependency
+					results[i].Error = "Not created because other products are invalid"
+				}
+			}
+			c.JSON(http.StatusBadRequest, gin.H{
+				"message": "No products were created, some products are invalid",
+				"created": 0,
+				"failed":  len(items),
+				"results": results,
+			})
+			return
+		}
+
+		if err := pc.repo.CreateBatch(ctx, products); err != nil {
+			handleDBError(c, err, "Failed to create products")
+			return
+		}
+		for i := range results {
+			results[i].Status = http.StatusCreated
+			results[i].Product = &products[i]
+		}
+	} else {
+		// Create the valid items one by one so that a failure only affects its own item
+		for i := range results {
+			if results[i].Status != 0 {
+				continue
+			}
+			if err := pc.repo.Create(ctx, &products[i]); err != nil {
+				results[i].Status = http.StatusInternalServerError
+				results[i].Error = "Failed to create product"
+				invalid++
+				continue
+			}
+			results[i].Status = http.StatusCreated
+			results[i].Product = &products[i]
+		}
+	}
+
+	status, message := http.StatusCreated, "Products created successfully"
+	if invalid > 0 {
+		status, message = http.StatusMultiStatus, "Some products could not be created"
+	}
+	c.JSON(status, gin.H{
+		"message": message,
+		"created": len(items) - invalid,
+		"failed":  invalid,
+		"results": results,
+	})
+}
+
+// bulkSelection holds the explicit product IDs of bulk update and delete requests,
+// which select products by the list endpoint filters in the query string otherwise
+type bulkSelection struct {
+	IDs []uint `json:"ids"`
+}
+
+// bulkUpdate is the body of bulk update requests, applying the same changes to every selected product
+type bulkUpdate struct {
+	bulkSelection
+	Changes productChanges `json:"changes"`
+}
+
+// errBulkNotFound is returned inside bulk transactions when some of the requested products do not exist
+type errBulkNotFound struct {
+	ids []uint
+}
+
+func (e errBulkNotFound) Error() string {
+	return fmt.Sprintf("%d products not found", len(e.ids))
+}
+
+// errBulkTooMany is returned inside bulk transactions when the filters match more products than allowed
+type errBulkTooMany struct {
+	matched int
+}
+
+func (e errBulkTooMany) Error() string {
+	return fmt.Sprintf("%d products matched", e.matched)
+}
+
+// Utility function to bind the optional JSON body of bulk requests, which may be empty for deletes
+func bindOptionalJSON(c *gin.Context, obj interface{}) bool {
+	if c.Request.ContentLength == 0 {
+		return true
+	}
+	return bindJSON(c, obj)
+}
+
+// Utility function to build the filter selecting the products of a bulk request from the IDs or the query filters
+func (pc *ProductController) parseBulkSelection(c *gin.Context, ids []uint) (repository.ProductFilter, bool) {
+	filter, ok := parseProductFilter(c)
+	if !ok {
+		return filter, false
+	}
+
+	switch {
+	case ids != nil && !filter.IsEmpty():
+		problem.Respond(c, http.StatusBadRequest, problem.CodeInvalidBody, "Products must be selected either by ids or by filters, not both")
+		return filter, false
+	case ids == nil && filter.IsEmpty():
+		problem.Respond(c, http.StatusBadRequest, problem.CodeInvalidBody, "Products must be selected by ids or by at least one filter")
+		return filter, false
+	case len(ids) > pc.bulkMaxItems:
+		problem.Respond(c, http.StatusBadRequest, problem.CodeTooManyItems,
+			fmt.Sprintf("At most %d products can be sent in a single request", pc.bulkMaxItems))
+		return filter, false
+	}
+
+	if ids != nil {
+		// Ignore repeated IDs
+		filter.IDs = []uint{}
+		for _, id := range ids {
+			if !slices.Contains(filter.IDs, id) {
+				filter.IDs = append(filter.IDs, id)
+			}
+		}
+	}
+	return filter, true
+}
+
+// Utility function to parse the dry_run query parameter of bulk requests
+func parseDryRun(c *gin.Context) (bool, bool) {
+	dryRunStr := c.Query("dry_run")
+	if dryRunStr == "" {
+		return false, true
+	}
+	dryRun, err := strconv.ParseBool(dryRunStr)
+	if err != nil {
+		problem.Respond(c, http.StatusBadRequest, problem.CodeInvalidParameter, "Invalid dry_run, must be a boolean")
+		return false, false
+	}
+	return dryRun, true
+}
+
+// selectBulkProducts lists the products selected by the filter inside a bulk transaction,
+// failing when requested IDs are missing or when the filters match too many products
+func (pc *ProductController) selectBulkProducts(ctx context.Context, tx repository.ProductRepository, filter repository.ProductFilter) ([]models.Product, error) {
+	products, err := tx.List(ctx, repository.ListOptions{Filter: filter, Limit: pc.bulkMaxItems + 1})
+	if err != nil {
+		return nil, err
+	}
+
+	if filter.IDs != nil && len(products) < len(filter.IDs) {
+		missing := []uint{}
+		for _, id := range filter.IDs {
+			if !slices.ContainsFunc(products, func(product models.Product) bool { return product.ID == id }) {
+				missing = append(missing, id)
+			}
+		}
+		return nil, errBulkNotFound{ids: missing}
+	}
+	if len(products) > pc.bulkMaxItems {
+		count, err := tx.Count(ctx, filter)
+		if err != nil {
+			return nil, err
+		}
+		return nil, errBulkTooMany{matched: int(count)}
+	}
+	return products, nil
+}
+
+// Utility function to respond to the failure of a bulk transaction
+func (pc *ProductController) handleBulkError(c *gin.Context, err error, errorMessage string) {
+	var notFound errBulkNotFound
+	var tooMany errBulkTooMany
+	switch {
+	case errors.As(err, &notFound):
+		problem.Send(c, problem.New(http.StatusNotFound, problem.CodeProductNotFound, "Products not found").With("ids", notFound.ids))
+	case errors.As(err, &tooMany):
+		problem.Respond(c, http.StatusBadRequest, problem.CodeTooManyItems,
+			fmt.Sprintf("The filters match %d products, at most %d can be changed in a single request", tooMany.matched, pc.bulkMaxItems))
+	case errors.Is(err, repository.ErrVersionConflict), errors.Is(err, repository.ErrProductNotFound):
+		problem.Respond(c, http.StatusConflict, problem.CodeVersionConflict, "The products were modified concurrently, please retry")
+	default:
+		handleDBError(c, err, errorMessage)
+	}
+}
+
+func (pc *ProductController) BulkUpdateProducts(c *gin.Context) {
+	var input bulkUpdate
+	if !bindJSON(c, &input) {
+		return
+	}
+	if input.Changes.Name == nil && input.Changes.Price == nil && input.Changes.Description == nil {
+		problem.Respond(c, http.StatusBadRequest, problem.CodeInvalidBody, "At least one change is required")
+		return
+	}
+	if err := validateProductChanges(input.Changes); err != nil {
+		problem.Send(c, problem.FromBindError(err))
+		return
+	}
+
+	filter, ok := pc.parseBulkSelection(c, input.IDs)
+	if !ok {
+		return
+	}
+	dryRun, ok := parseDryRun(c)
+	if !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	// Update every selected product or none of them
+	var matched []models.Product
+	updated := []uint{}
+	err := pc.repo.Transaction(ctx, func(tx repository.ProductRepository) error {
+		products, err := pc.selectBulkProducts(ctx, tx, filter)
+		if err != nil {
+			return err
+		}
+		matched = products
+
+		for i := range products {
+			if !applyProductChanges(&products[i], input.Changes) {
+				continue
+			}
+			updated = append(updated, products[i].ID)
+			if dryRun {
+				continue
+			}
+			if err := tx.Update(ctx, &products[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		pc.handleBulkError(c, err, "Could not update products")
+		return
+	}
+
+	message := "Products updated successfully"
+	if dryRun {
+		message = "Dry run, no products were updated"
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": message,
+		"dry_run": dryRun,
+		"matched": len(matched),
+		"updated": len(updated),
+		"ids":     updated,
+	})
+}
+
+func (pc *ProductController) BulkDeleteProducts(c *gin.Context) {
+	var input bulkSelection
+	if !bindOptionalJSON(c, &input) {
+		return
+	}
+
+	filter, ok := pc.parseBulkSelection(c, input.IDs)
+	if !ok {
+		return
+	}
+	dryRun, ok := parseDryRun(c)
+	if !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	// Delete every selected product or none of them
+	var matched []models.Product
+	err := pc.repo.Transaction(ctx, func(tx repository.ProductRepository) error {
+		products, err := pc.selectBulkProducts(ctx, tx, filter)
+		if err != nil {
+			return err
+		}
+		matched = products
+
+		if dryRun {
+			return nil
+		}
+		for _, product := range products {
+			if err := tx.Delete(ctx, uint64(product.ID), product.Version); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		pc.handleBulkError(c, err, "Could not delete products")
+		return
+	}
+
+	message, deleted := "Products deleted successfully", len(matched)
+	if dryRun {
+		message, deleted = "Dry run, no products were deleted", 0
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": message,
+		"dry_run": dryRun,
+		"matched": len(matched),
+		"deleted": deleted,
+		"ids":     repository.ProductIDs(matched),
+	})
+}
@@ -0,0 +1,462 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"products-api/models"
+	"products-api/problem"
+	"products-api/repository"
+	"slices"
+	"strconv"
+)
+
+// CategoryController handles the endpoints of the category tree and of the products in each category
+type CategoryController struct {
+	categories repository.CategoryRepository
+	products   *ProductController // Lists the products of a category like the product endpoints
+}
+
+// NewCategoryController creates a CategoryController backed by the given repository,
+// using the product controller to read the products
+func NewCategoryController(categories repository.CategoryRepository, products *ProductController) *CategoryController {
+	return &CategoryController{categories: categories, products: products}
+}
+
+// categoryInput holds the fields of a new category
+type categoryInput struct {
+	Name        string `json:"name" binding:"required"`
+	Description string `json:"description"`
+	ParentID    *uint  `json:"parent_id"` // Creates a root category when nil
+}
+
+// categoryChanges holds the values of a partial category update, nil fields are left unchanged
+type categoryChanges struct {
+	Name        *string `json:"name"`
+	Description *string `json:"description"`
+	ParentID    *uint   `json:"parent_id"` // Moves the category, to the root when null
+
+	parentSet bool // Whether parent_id was given, since a null one decodes like a missing one
+}
+
+func (changes *categoryChanges) UnmarshalJSON(data []byte) error {
+	type fields categoryChanges
+	if err := json.Unmarshal(data, (*fields)(changes)); err != nil {
+		return err
+	}
+
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(data, &members); err != nil {
+		return err
+	}
+	_, changes.parentSet = members["parent_id"]
+	return nil
+}
+
+// categoryProducts holds the products to add to a category
+type categoryProducts struct {
+	ProductIDs []uint `json:"product_ids" binding:"required,min=1"`
+}
+
+// Utility function to parse a category ID from the URL parameters
+func parseCategoryID(c *gin.Context) (uint64, error) {
+	categoryId, err := strconv.ParseUint(c.Param("id"), 10, 0)
+	if err != nil {
+		problem.Respond(c, http.StatusBadRequest, problem.CodeInvalidParameter, "Invalid category ID format")
+	}
+	return categoryId, err
+}
+
+// Utility function to apply the provided changes to a category, reporting whether any value changed
+func applyCategoryChanges(category *models.Category, changes categoryChanges) bool {
+	var updated bool
+	if changes.Name != nil && *changes.Name != category.Name {
+		category.Name = *changes.Name
+		updated = true
+	}
+	if changes.Description != nil && *changes.Description != category.Description {
+		category.Description = *changes.Description
+		updated = true
+	}
+	if changes.parentSet && !sameCategory(changes.ParentID, category.ParentID) {
+		category.ParentID = changes.ParentID
+		updated = true
+	}
+	return updated
+}
+
+// Utility function to compare two optional category IDs
+func sameCategory(a, b *uint) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// Utility function to check the products of a moved category and of its descendants against the attribute schemas
+// that apply below its new parent, responding with the field errors of the invalid products
+func (cc *CategoryController) checkMovedProducts(c *gin.Context, category *models.Category) bool {
+	ctx := c.Request.Context()
+
+	var parent *models.Category
+	if category.ParentID != nil {
+		var err error
+		parent, err = cc.categories.Get(ctx, uint64(*category.ParentID))
+		if errors.Is(err, repository.ErrCategoryNotFound) {
+			err = repository.ErrParentCategoryNotFound
+		}
+		if err != nil {
+			handleCategoryError(c, err, "Could not retrieve parent category")
+			return false
+		}
+		// Moving a category below itself is rejected by the update
+		if parent.IsDescendantOf(*category) {
+			return true
+		}
+	}
+
+	moved := models.Category{Path: models.CategoryPath(parent, category.ID)}
+	schemas, err := cc.products.schemas.ListApplicable(ctx, "", moved.PathIDs())
+	if err != nil {
+		handleDBError(c, err, "Could not retrieve attribute schemas")
+		return false
+	}
+	if len(schemas) == 0 {
+		return true
+	}
+
+	categoryIDs, err := cc.categories.DescendantIDs(ctx, uint64(category.ID))
+	if err != nil {
+		handleCategoryError(c, err, "Could not retrieve category")
+		return false
+	}
+	var fieldErrors problem.ValidationError
+	err = cc.products.repo.Each(ctx, repository.ListOptions{Filter: repository.ProductFilter{CategoryIDs: categoryIDs}}, func(product models.Product) error {
+		fieldErrors = append(fieldErrors, checkAttributes(fmt.Sprintf("products[%d].", product.ID), product.Attributes, schemas)...)
+		return nil
+	})
+	if err != nil {
+		handleDBError(c, err, "Could not retrieve products")
+		return false
+	}
+	if fieldErrors != nil {
+		problem.Send(c, problem.FromBindError(fieldErrors))
+		return false
+	}
+	return true
+}
+
+// Utility function to respond to the failure of a category operation
+func handleCategoryError(c *gin.Context, err error, errorMessage string) {
+	switch {
+	case errors.Is(err, repository.ErrCategoryNotFound):
+		problem.Respond(c, http.StatusNotFound, problem.CodeCategoryNotFound, "Category not found")
+	case errors.Is(err, repository.ErrParentCategoryNotFound):
+		problem.Send(c, problem.FromBindError(problem.ValidationError{problem.NewFieldError("parent_id", "exists", "")}))
+	case errors.Is(err, repository.ErrCategoryCycle):
+		problem.Send(c, problem.FromBindError(problem.ValidationError{problem.NewFieldError("parent_id", "no_cycle", "")}))
+	case errors.Is(err, repository.ErrCategoryHasChildren):
+		problem.Respond(c, http.StatusConflict, problem.CodeCategoryNotEmpty, "Category has subcategories, delete or move them first")
+	default:
+		handleDBError(c, err, errorMessage)
+	}
+}
+
+func (cc *CategoryController) CreateCategory(c *gin.Context) {
+	var input categoryInput
+	if !bindJSON(c, &input) {
+		return
+	}
+
+	category := models.Category{Name: input.Name, Description: input.Description, ParentID: input.ParentID}
+	if err := cc.categories.Create(c.Request.Context(), &category); err != nil {
+		handleCategoryError(c, err, "Failed to create category")
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{
+		"message":  "Category created successfully",
+		"category": category,
+	})
+}
+
+func (cc *CategoryController) GetCategories(c *gin.Context) {
+	// Parse the pagination query parameters
+	page, limit, ok := parsePagination(c)
+	if !ok {
+		return
+	}
+
+	// Parse the parent_id query parameter, which lists the children of a category instead of the whole tree
+	var opts repository.CategoryListOptions
+	if parentIdStr := c.Query("parent_id"); parentIdStr != "" {
+		parentId, err := strconv.ParseUint(parentIdStr, 10, 0)
+		if err != nil {
+			problem.Respond(c, http.StatusBadRequest, problem.CodeInvalidParameter, "Invalid parent_id, must be a positive integer")
+			return
+		}
+		id := uint(parentId)
+		opts.ParentID = &id
+	}
+	opts.Offset = (page - 1) * limit
+	opts.Limit = limit
+
+	categories, total, err := cc.categories.List(c.Request.Context(), opts)
+	if err != nil {
+		handleDBError(c, err, "Could not retrieve categories")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"total": total,
+		"page":  page,
+		"limit": limit,
+		"data":  categories,
+	})
+}
+
+func (cc *CategoryController) GetCategoryById(c *gin.Context) {
+	categoryId, err := parseCategoryID(c)
+	if err != nil {
+		return
+	}
+
+	category, err := cc.categories.Get(c.Request.Context(), categoryId)
+	if err != nil {
+		handleCategoryError(c, err, "Could not retrieve category")
+		return
+	}
+
+	c.JSON(http.StatusOK, category)
+}
+
+func (cc *CategoryController) UpdateCategory(c *gin.Context) {
+	categoryId, err := parseCategoryID(c)
+	if err != nil {
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	// Find the existing category in the store
+	category, err := cc.categories.Get(ctx, categoryId)
+	if err != nil {
+		handleCategoryError(c, err, "Could not retrieve category")
+		return
+	}
+
+	var input categoryChanges
+	if !bindJSON(c, &input) {
+		return
+	}
+	if input.Name != nil && *input.Name == "" {
+		problem.Send(c, problem.FromBindError(problem.ValidationError{problem.NewFieldError("name", "required", "")}))
+		return
+	}
+
+	// Only save if there were changes made to the category
+	moved := input.parentSet && !sameCategory(input.ParentID, category.ParentID)
+	if !applyCategoryChanges(category, input) {
+		c.JSON(http.StatusOK, gin.H{
+			"message":  "No changes detected, category update not performed",
+			"category": category,
+		})
+		return
+	}
+
+	if moved && !cc.checkMovedProducts(c, category) {
+		return
+	}
+
+	if err := cc.categories.Update(ctx, category); err != nil {
+		handleCategoryError(c, err, "Could not update category")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "Category updated successfully",
+		"category": category,
+	})
+}
+
+func (cc *CategoryController) DeleteCategory(c *gin.Context) {
+	categoryId, err := parseCategoryID(c)
+	if err != nil {
+		return
+	}
+
+	// Products are only unlinked from the category, never deleted with it
+	if err := cc.categories.Delete(c.Request.Context(), categoryId); err != nil {
+		handleCategoryError(c, err, "Could not delete category")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Category deleted successfully"})
+}
+
+func (cc *CategoryController) GetCategoryProducts(c *gin.Context) {
+	categoryId, err := parseCategoryID(c)
+	if err != nil {
+		return
+	}
+
+	// Parse the include_descendants query parameter, which adds the products of every subcategory
+	var includeDescendants bool
+	if includeStr := c.Query("include_descendants"); includeStr != "" {
+		includeDescendants, err = strconv.ParseBool(includeStr)
+		if err != nil {
+			problem.Respond(c, http.StatusBadRequest, problem.CodeInvalidParameter, "Invalid include_descendants, must be a boolean")
+			return
+		}
+	}
+
+	// The category comes first, before its descendants
+	categoryIDs, err := cc.categories.DescendantIDs(c.Request.Context(), categoryId)
+	if err != nil {
+		handleCategoryError(c, err, "Could not retrieve category")
+		return
+	}
+	if !includeDescendants {
+		categoryIDs = categoryIDs[:1]
+	}
+
+	cc.products.listProducts(c, repository.ProductFilter{CategoryIDs: categoryIDs})
+}
+
+func (cc *CategoryController) AddCategoryProducts(c *gin.Context) {
+	categoryId, err := parseCategoryID(c)
+	if err != nil {
+		return
+	}
+
+	var input categoryProducts
+	if !bindJSON(c, &input) {
+		return
+	}
+
+	// Ignore repeated IDs
+	productIds := []uint{}
+	for _, id := range input.ProductIDs {
+		if !slices.Contains(productIds, id) {
+			productIds = append(productIds, id)
+		}
+	}
+	if len(productIds) > cc.products.bulkMaxItems {
+		problem.Respond(c, http.StatusBadRequest, problem.CodeTooManyItems,
+			fmt.Sprintf("At most %d products can be sent in a single request", cc.products.bulkMaxItems))
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	category, err := cc.categories.Get(ctx, categoryId)
+	if err != nil {
+		handleCategoryError(c, err, "Could not retrieve category")
+		return
+	}
+
+	// Only live products can be added
+	products, err := cc.products.repo.List(ctx, repository.ListOptions{Filter: repository.ProductFilter{IDs: productIds}})
+	if err != nil {
+		handleDBError(c, err, "Could not retrieve products")
+		return
+	}
+	if len(products) < len(productIds) {
+		missing := []uint{}
+		for _, id := range productIds {
+			if !slices.ContainsFunc(products, func(product models.Product) bool { return product.ID == id }) {
+				missing = append(missing, id)
+			}
+		}
+		problem.Send(c, problem.New(http.StatusNotFound, problem.CodeProductNotFound, "Products not found").With("ids", missing))
+		return
+	}
+
+	// The products must match the attribute schemas of the category and of its ancestors
+	schemas, err := cc.products.schemas.ListApplicable(ctx, "", category.PathIDs())
+	if err != nil {
+		handleDBError(c, err, "Could not retrieve attribute schemas")
+		return
+	}
+	var fieldErrors problem.ValidationError
+	for _, product := range products {
+		path := fmt.Sprintf("product_ids[%d].", slices.Index(input.ProductIDs, product.ID))
+		fieldErrors = append(fieldErrors, checkAttributes(path, product.Attributes, schemas)...)
+	}
+	if fieldErrors != nil {
+		problem.Send(c, problem.FromBindError(fieldErrors))
+		return
+	}
+
+	added, err := cc.categories.LinkProducts(ctx, categoryId, productIds)
+	if err != nil {
+		handleCategoryError(c, err, "Could not add products to category")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Products added to category",
+		"added":   added,
+	})
+}
+
+func (cc *CategoryController) RemoveCategoryProduct(c *gin.Context) {
+	categoryId, err := parseCategoryID(c)
+	if err != nil {
+		return
+	}
+	productId, err := strconv.ParseUint(c.Param("product_id"), 10, 0)
+	if err != nil {
+		problem.Respond(c, http.StatusBadRequest, problem.CodeInvalidParameter, "Invalid product ID format")
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	if _, err := cc.categories.Get(ctx, categoryId); err != nil {
+		handleCategoryError(c, err, "Could not retrieve category")
+		return
+	}
+
+	if err := cc.categories.UnlinkProduct(ctx, categoryId, productId); err != nil {
+		if errors.Is(err, repository.ErrProductNotInCategory) {
+			problem.Respond(c, http.StatusNotFound, problem.CodeProductNotFound, "Product not found in category")
+		} else {
+			handleDBError(c, err, "Could not remove product from category")
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Product removed from category"})
+}
+
+func (cc *CategoryController) GetProductCategories(c *gin.Context) {
+	productId, err := parseProductID(c)
+	if err != nil {
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	if _, err := cc.products.repo.Get(ctx, productId); err != nil {
+		if errors.Is(err, repository.ErrProductNotFound) {
+			problem.Respond(c, http.StatusNotFound, problem.CodeProductNotFound, "Product not found")
+		} else {
+			handleDBError(c, err, "Could not retrieve product")
+		}
+		return
+	}
+
+	categories, err := cc.categories.ListByProduct(ctx, productId)
+	if err != nil {
+		handleDBError(c, err, "Could not retrieve product categories")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"product_id": productId,
+		"data":       categories,
+	})
+}
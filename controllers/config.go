@@ -0,0 +1,61 @@
+package controllers
+
+import (
+	"os"
+	"strconv"
+	"time"
+)
+
+// Config holds the settings of the controllers
+type Config struct {
+	// CursorSecret signs pagination cursors, a random secret is used when empty
+	// so cursors do not survive restarts and are not shared between replicas
+	CursorSecret string
+	// RequireIfMatch rejects updates and deletes without an If-Match header with 428 Precondition Required
+	RequireIfMatch bool
+	// BulkMaxItems limits the number of products in a single bulk request, DefaultBulkMaxItems when not positive
+	BulkMaxItems int
+	// IdempotencyTTL is how long responses to requests with an Idempotency-Key are kept for replay,
+	// DefaultIdempotencyTTL when not positive
+	IdempotencyTTL time.Duration
+	// TrashRetention is how long deleted products stay in the trash before they are purged,
+	// DefaultTrashRetention when not positive
+	TrashRetention time.Duration
+}
+
+// Defaults used for the settings that are not configured
+const (
+	DefaultBulkMaxItems   = 1000
+	DefaultIdempotencyTTL = 24 * time.Hour
+	DefaultTrashRetention = 30 * 24 * time.Hour
+)
+
+// WithDefaults returns the configuration with the defaults applied to the settings that are not configured
+func (config Config) WithDefaults() Config {
+	if config.BulkMaxItems <= 0 {
+		config.BulkMaxItems = DefaultBulkMaxItems
+	}
+	if config.IdempotencyTTL <= 0 {
+		config.IdempotencyTTL = DefaultIdempotencyTTL
+	}
+	if config.TrashRetention <= 0 {
+		config.TrashRetention = DefaultTrashRetention
+	}
+	return config
+}
+
+// LoadConfig loads the controller configuration from environment variables
+func LoadConfig() Config {
+	requireIfMatch, _ := strconv.ParseBool(os.Getenv("REQUIRE_IF_MATCH"))
+	bulkMaxItems, _ := strconv.Atoi(os.Getenv("BULK_MAX_ITEMS"))
+	idempotencyTTL, _ := time.ParseDuration(os.Getenv("IDEMPOTENCY_TTL"))
+	trashRetention, _ := time.ParseDuration(os.Getenv("TRASH_RETENTION"))
+
+	return Config{
+		CursorSecret:   os.Getenv("CURSOR_SECRET"),
+		RequireIfMatch: requireIfMatch,
+		BulkMaxItems:   bulkMaxItems,
+		IdempotencyTTL: idempotencyTTL,
+		TrashRetention: trashRetention,
+	}
+}
@@ -0,0 +1,103 @@
+package controllers
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"products-api/models"
+	"products-api/problem"
+	"strings"
+	"time"
+)
+
+// productETag returns the entity tag of a product, which changes with every update
+func productETag(product *models.Product) string {
+	return fmt.Sprintf(`"%d"`, product.Version)
+}
+
+// etagListContains reports whether a comma-separated list of entity tags from an If-Match
+// or If-None-Match header contains the tag, or is the "*" wildcard
+func etagListContains(header, etag string, weak bool) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+		// Weak comparison ignores the weakness indicator, strong comparison never matches weak tags
+		if weak {
+			if strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+		} else if candidate == etag && !strings.HasPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
+
+// checkIfMatch enforces the If-Match header against the current product, responding with
+// 428 when the header is required but missing and 412 when it does not match
+func (pc *ProductController) checkIfMatch(c *gin.Context, product *models.Product) bool {
+	ifMatch := c.GetHeader("If-Match")
+	if ifMatch == "" {
+		if pc.requireIfMatch {
+			problem.Respond(c, http.StatusPreconditionRequired, problem.CodePreconditionRequired, "Precondition required, send the product ETag in the If-Match header")
+			return false
+		}
+		return true
+	}
+
+	if !etagListContains(ifMatch, productETag(product), false) {
+		c.Header("ETag", productETag(product))
+		problem.Respond(c, http.StatusPreconditionFailed, problem.CodePreconditionFailed, "Precondition failed, the product has been modified")
+		return false
+	}
+	return true
+}
+
+// handleVersionConflict responds to a product that changed between reading and writing it,
+// which is a failed precondition when the client sent If-Match and a conflict otherwise
+func handleVersionConflict(c *gin.Context) {
+	if c.GetHeader("If-Match") != "" {
+		problem.Respond(c, http.StatusPreconditionFailed, problem.CodePreconditionFailed, "Precondition failed, the product has been modified")
+		return
+	}
+	problem.Respond(c, http.StatusConflict, problem.CodeVersionConflict, "The product was modified concurrently, please retry")
+}
+
+// contentETag returns a weak entity tag derived from a response body
+func contentETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return fmt.Sprintf(`W/"%x"`, sum[:16])
+}
+
+// notModified reports whether the client copy validated by If-None-Match, or by If-Modified-Since
+// when no entity tags are sent, is still current
+func notModified(c *gin.Context, etag string, lastModified time.Time) bool {
+	if ifNoneMatch := c.GetHeader("If-None-Match"); ifNoneMatch != "" {
+		return etagListContains(ifNoneMatch, etag, true)
+	}
+
+	if ifModifiedSince := c.GetHeader("If-Modified-Since"); ifModifiedSince != "" && !lastModified.IsZero() {
+		since, err := http.ParseTime(ifModifiedSince)
+		// HTTP dates have a precision of one second
+		return err == nil && !lastModified.Truncate(time.Second).After(since)
+	}
+	return false
+}
+
+// respondConditionally sets the ETag and Last-Modified validators and writes the body as JSON,
+// or responds with 304 Not Modified when the client copy is still current
+func respondConditionally(c *gin.Context, etag string, lastModified time.Time, body []byte) {
+	c.Header("ETag", etag)
+	if !lastModified.IsZero() {
+		c.Header("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
+	}
+
+	if notModified(c, etag, lastModified) {
+		c.Status(http.StatusNotModified)
+		return
+	}
+	c.Data(http.StatusOK, "application/json; charset=utf-8", body)
+}
@@ -0,0 +1,179 @@
+package controllers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"io"
+	"log"
+	"net/http"
+	"products-api/models"
+	"products-api/problem"
+	"products-api/repository"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// exportFlushInterval is the number of products written between flushes of the response
+const exportFlushInterval = 100
+
+// exportColumns are the CSV columns of an export, which can be imported again as they are.
+// The tags are separated by commas and the attributes written as a JSON object
+var exportColumns = []string{"id", "name", "description", "price", "version", "created_at", "updated_at", "tags", "type", "attributes"}
+
+// productEncoder writes products to an export in one of the supported formats
+type productEncoder interface {
+	begin() error
+	encode(product models.Product) error
+	end() error
+}
+
+// exportFormat describes a supported export format
+type exportFormat struct {
+	contentType string
+	extension   string
+	newEncoder  func(w io.Writer) productEncoder
+}
+
+var exportFormats = map[string]exportFormat{
+	"csv":    {"text/csv; charset=utf-8", "csv", func(w io.Writer) productEncoder { return &csvProductEncoder{writer: csv.NewWriter(w)} }},
+	"ndjson": {"application/x-ndjson", "ndjson", func(w io.Writer) productEncoder { return &jsonProductEncoder{w: w} }},
+	"json":   {"application/json; charset=utf-8", "json", func(w io.Writer) productEncoder { return &jsonProductEncoder{w: w, array: true} }},
+}
+
+// csvProductEncoder writes a header row followed by one row per product
+type csvProductEncoder struct {
+	writer *csv.Writer
+}
+
+func (e *csvProductEncoder) begin() error {
+	return e.writer.Write(exportColumns)
+}
+
+func (e *csvProductEncoder) encode(product models.Product) error {
+	attributes, err := json.Marshal(product.Attributes)
+	if err != nil {
+		return err
+	}
+	return e.writer.Write([]string{
+		strconv.FormatUint(uint64(product.ID), 10),
+		product.Name,
+		product.Description,
+		strconv.FormatFloat(product.Price, 'f', -1, 64),
+		strconv.FormatUint(uint64(product.Version), 10),
+		product.CreatedAt.UTC().Format(time.RFC3339Nano),
+		product.UpdatedAt.UTC().Format(time.RFC3339Nano),
+		strings.Join(product.Tags, ","),
+		product.Type,
+		string(attributes),
+	})
+}
+
+func (e *csvProductEncoder) end() error {
+	e.writer.Flush()
+	return e.writer.Error()
+}
+
+// jsonProductEncoder writes one JSON object per line, or a JSON array when array is set
+type jsonProductEncoder struct {
+	w     io.Writer
+	array bool
+	count int
+}
+
+func (e *jsonProductEncoder) begin() error {
+	if !e.array {
+		return nil
+	}
+	_, err := io.WriteString(e.w, "[")
+	return err
+}
+
+func (e *jsonProductEncoder) encode(product models.Product) error {
+	data, err := json.Marshal(product)
+	if err != nil {
+		return err
+	}
+	if e.array && e.count > 0 {
+		data = append([]byte(","), data...)
+	}
+	if !e.array {
+		data = append(data, '\n')
+	}
+	e.count++
+	_, err = e.w.Write(data)
+	return err
+}
+
+func (e *jsonProductEncoder) end() error {
+	if !e.array {
+		return nil
+	}
+	_, err := io.WriteString(e.w, "]\n")
+	return err
+}
+
+func (pc *ProductController) ExportProducts(c *gin.Context) {
+	formatName := c.DefaultQuery("format", "csv")
+	format, ok := exportFormats[formatName]
+	if !ok {
+		problem.Respond(c, http.StatusBadRequest, problem.CodeInvalidParameter, "Invalid format, must be csv, ndjson or json")
+		return
+	}
+
+	// Parse the filtering query parameters
+	filter, ok := parseProductFilter(c)
+	if !ok {
+		return
+	}
+
+	// Parse the sort query parameter
+	sortFields, err := repository.ParseSort(c.Query("sort"))
+	if err != nil {
+		problem.Respond(c, http.StatusBadRequest, problem.CodeInvalidParameter, "Invalid sort, "+err.Error())
+		return
+	}
+
+	// The response is only started with the first product, so that failing queries still get an error status
+	encoder := format.newEncoder(c.Writer)
+	var written int
+	start := func() error {
+		c.Header("Content-Type", format.contentType)
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="products.%s"`, format.extension))
+		c.Status(http.StatusOK)
+		return encoder.begin()
+	}
+
+	err = pc.repo.Each(c.Request.Context(), repository.ListOptions{Filter: filter, Sort: sortFields}, func(product models.Product) error {
+		if written == 0 {
+			if err := start(); err != nil {
+				return err
+			}
+		}
+		if err := encoder.encode(product); err != nil {
+			return err
+		}
+		written++
+		if written%exportFlushInterval == 0 {
+			c.Writer.Flush()
+		}
+		return nil
+	})
+	if err == nil && written == 0 {
+		err = start()
+	}
+	if err == nil {
+		err = encoder.end()
+	}
+
+	if err != nil {
+		if written == 0 && !c.Writer.Written() {
+			handleDBError(c, err, "Could not export products")
+			return
+		}
+		// The status was already sent, so the truncated body is all the client can notice
+		log.Println(err.Error())
+	}
+}
@@ -0,0 +1,349 @@
+package controllers
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"io"
+	"math"
+	"net/http"
+	"products-api/models"
+	"products-api/problem"
+	"products-api/repository"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// importBatchSize is the number of CSV rows upserted per transaction, so that large files are never held in memory
+const importBatchSize = 500
+
+// Import report formats
+const (
+	importReportJSON = "json"
+	importReportCSV  = "csv"
+)
+
+// importColumns are the CSV columns mapped to product fields
+var importColumns = []string{"name", "description", "price"}
+
+// importIgnoredColumns are product fields that imports do not change, accepted so that exported files can be imported again
+var importIgnoredColumns = []string{"id", "version", "created_at", "updated_at", "tags", "type", "attributes"}
+
+// importRow is a validated CSV row waiting to be upserted
+type importRow struct {
+	line    int
+	changes productChanges
+	record  []string // Fields of the row as read, reported if the row is rejected
+}
+
+// importRejection reports a CSV row that was not imported
+type importRejection struct {
+	Line    int                  `json:"line"`
+	Error   string               `json:"error"`
+	Details string               `json:"details,omitempty"`
+	Errors  []problem.FieldError `json:"errors,omitempty"`
+	record  []string
+}
+
+// importResult counts the outcome of an import
+type importResult struct {
+	created   int
+	updated   int
+	unchanged int
+	rejected  []importRejection
+}
+
+// Utility function to open the CSV file of an import request, sent as the raw body or as the file field of a form
+func openImportFile(c *gin.Context) (io.Reader, bool) {
+	switch c.ContentType() {
+	case "text/csv", "application/csv":
+		return c.Request.Body, true
+	case "multipart/form-data":
+		// Read the form part by part instead of parsing it into memory
+		reader, err := c.Request.MultipartReader()
+		if err != nil {
+			problem.Respond(c, http.StatusBadRequest, problem.CodeInvalidBody, err.Error())
+			return nil, false
+		}
+		for {
+			part, err := reader.NextPart()
+			if err == io.EOF {
+				problem.Respond(c, http.StatusBadRequest, problem.CodeInvalidBody, "The form must contain a file field")
+				return nil, false
+			}
+			if err != nil {
+				problem.Respond(c, http.StatusBadRequest, problem.CodeInvalidBody, err.Error())
+				return nil, false
+			}
+			if part.FormName() == "file" {
+				return part, true
+			}
+		}
+	default:
+		problem.Respond(c, http.StatusUnsupportedMediaType, problem.CodeUnsupportedMediaType, "Unsupported content type, send text/csv or multipart/form-data with a file field")
+		return nil, false
+	}
+}
+
+// Utility function to map the CSV header to product fields, ignored columns are mapped to an empty string
+func parseImportHeader(header []string) ([]string, error) {
+	columns := make([]string, len(header))
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+
+		switch {
+		case slices.Contains(importColumns, name):
+			if slices.Contains(columns, name) {
+				return nil, fmt.Errorf("Duplicate column %q", name)
+			}
+			columns[i] = name
+		case slices.Contains(importIgnoredColumns, name):
+			columns[i] = ""
+		default:
+			return nil, fmt.Errorf("Unknown column %q, expected name, description or price", name)
+		}
+	}
+
+	if !slices.Contains(columns, "name") || !slices.Contains(columns, "price") {
+		return nil, errors.New("The name and price columns are required")
+	}
+	return columns, nil
+}
+
+// Utility function to validate a CSV row with the same rules as CreateProduct
+func parseImportRecord(columns []string, record []string) (productChanges, error) {
+	var changes productChanges
+	for i, column := range columns {
+		value := strings.TrimSpace(record[i])
+		switch column {
+		case "name":
+			changes.Name = &value
+		case "description":
+			changes.Description = &value
+		case "price":
+			// An empty price is left at zero and rejected by the binding rules below
+			var price float64
+			if value != "" {
+				parsed, err := strconv.ParseFloat(value, 64)
+				if err != nil || math.IsNaN(parsed) || math.IsInf(parsed, 0) {
+					return changes, problem.ValidationError{problem.NewFieldError("price", "type", "number")}
+				}
+				price = parsed
+			}
+			changes.Price = &price
+		}
+	}
+
+	product := newImportedProduct(changes)
+	return changes, binding.Validator.ValidateStruct(&product)
+}
+
+// newImportedProduct creates the product described by the changes of an imported row
+func newImportedProduct(changes productChanges) models.Product {
+	product := models.Product{Name: *changes.Name, Price: *changes.Price}
+	if changes.Description != nil {
+		product.Description = *changes.Description
+	}
+	return product
+}
+
+// importBatch upserts the rows by product name in a single transaction
+func (pc *ProductController) importBatch(ctx context.Context, rows []importRow, result *importResult) error {
+	names := []string{}
+	for _, row := range rows {
+		if !slices.Contains(names, *row.changes.Name) {
+			names = append(names, *row.changes.Name)
+		}
+	}
+
+	var batch importResult
+	err := pc.repo.Transaction(ctx, func(tx repository.ProductRepository) error {
+		existing, err := tx.List(ctx, repository.ListOptions{Filter: repository.ProductFilter{Names: names}})
+		if err != nil {
+			return err
+		}
+		byName := make(map[string][]*models.Product, len(existing))
+		for i := range existing {
+			byName[existing[i].Name] = append(byName[existing[i].Name], &existing[i])
+		}
+
+		for _, row := range rows {
+			matches := byName[*row.changes.Name]
+			switch len(matches) {
+			case 0:
+				product := newImportedProduct(row.changes)
+				if err := tx.Create(ctx, &product); err != nil {
+					return err
+				}
+				// Later rows with the same name update the product created here
+				byName[product.Name] = []*models.Product{&product}
+				batch.created++
+			case 1:
+				if !applyProductChanges(matches[0], row.changes) {
+					batch.unchanged++
+					continue
+				}
+				if err := tx.Update(ctx, matches[0]); err != nil {
+					return err
+				}
+				batch.updated++
+			default:
+				batch.rejected = append(batch.rejected, importRejection{
+					Line:    row.line,
+					Error:   "Ambiguous product name",
+					Details: fmt.Sprintf("%d products are named %q", len(matches), *row.changes.Name),
+					record:  row.record,
+				})
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	result.created += batch.created
+	result.updated += batch.updated
+	result.unchanged += batch.unchanged
+	result.rejected = append(result.rejected, batch.rejected...)
+	return nil
+}
+
+func (pc *ProductController) ImportProducts(c *gin.Context) {
+	reportFormat := c.DefaultQuery("report", importReportJSON)
+	if reportFormat != importReportJSON && reportFormat != importReportCSV {
+		problem.Respond(c, http.StatusBadRequest, problem.CodeInvalidParameter, "Invalid report, must be json or csv")
+		return
+	}
+
+	file, ok := openImportFile(c)
+	if !ok {
+		return
+	}
+
+	// Map the header to product fields, every row must then have the same number of fields
+	reader := csv.NewReader(file)
+	header, err := reader.Read()
+	if err == io.EOF {
+		problem.Respond(c, http.StatusBadRequest, problem.CodeInvalidCSV, "The CSV file is empty")
+		return
+	}
+	if err != nil {
+		problem.Respond(c, http.StatusBadRequest, problem.CodeInvalidCSV, err.Error())
+		return
+	}
+	// Spreadsheet applications often start UTF-8 files with a byte order mark
+	header[0] = strings.TrimPrefix(header[0], "\ufeff")
+	columns, err := parseImportHeader(header)
+	if err != nil {
+		problem.Respond(c, http.StatusBadRequest, problem.CodeInvalidCSV, err.Error())
+		return
+	}
+
+	ctx := c.Request.Context()
+	language := problem.Language(c)
+
+	// Stream the rows, upserting the valid ones batch by batch
+	result := importResult{rejected: []importRejection{}}
+	var rows int
+	batch := make([]importRow, 0, importBatchSize)
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		rows++
+
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			result.rejected = append(result.rejected, importRejection{
+				Line:    parseErr.StartLine,
+				Error:   "Invalid CSV row",
+				Details: parseErr.Err.Error(),
+				record:  record,
+			})
+			continue
+		}
+		if err != nil {
+			problem.Respond(c, http.StatusBadRequest, problem.CodeInvalidCSV, err.Error())
+			return
+		}
+
+		line, _ := reader.FieldPos(0)
+		changes, err := parseImportRecord(columns, record)
+		if err != nil {
+			result.rejected = append(result.rejected, importRejection{
+				Line:    line,
+				Error:   "Invalid input",
+				Details: problem.Message(err, language),
+				Errors:  problem.Localize(problem.FieldErrors(err), language),
+				record:  record,
+			})
+			continue
+		}
+
+		batch = append(batch, importRow{line: line, changes: changes, record: record})
+		if len(batch) == importBatchSize {
+			if err := pc.importBatch(ctx, batch, &result); err != nil {
+				pc.handleBulkError(c, err, "Could not import products")
+				return
+			}
+			batch = batch[:0]
+		}
+	}
+	if len(batch) > 0 {
+		if err := pc.importBatch(ctx, batch, &result); err != nil {
+			pc.handleBulkError(c, err, "Could not import products")
+			return
+		}
+	}
+
+	if rows == 0 {
+		problem.Respond(c, http.StatusBadRequest, problem.CodeInvalidCSV, "The CSV file contains no products")
+		return
+	}
+
+	// Rows rejected while upserting are reported after the ones rejected while parsing
+	sort.SliceStable(result.rejected, func(i, j int) bool { return result.rejected[i].Line < result.rejected[j].Line })
+
+	status, message := http.StatusOK, "Products imported successfully"
+	if len(result.rejected) > 0 {
+		status, message = http.StatusMultiStatus, "Some rows could not be imported"
+	}
+
+	if reportFormat == importReportCSV {
+		writeImportReport(c, status, header, result.rejected)
+		return
+	}
+	c.JSON(status, gin.H{
+		"message":   message,
+		"created":   result.created,
+		"updated":   result.updated,
+		"unchanged": result.unchanged,
+		"rejected":  len(result.rejected),
+		"errors":    result.rejected,
+	})
+}
+
+// writeImportReport responds with a downloadable CSV file of the rejected rows,
+// which can be corrected and imported again once the line, error and details columns are removed
+func writeImportReport(c *gin.Context, status int, header []string, rejected []importRejection) {
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", `attachment; filename="products-import-report.csv"`)
+	c.Status(status)
+
+	writer := csv.NewWriter(c.Writer)
+	writer.Write(append([]string{"line", "error", "details"}, header...))
+	for _, rejection := range rejected {
+		// Rows with the wrong number of fields are fitted to the header, so that every row of the report has the same fields
+		record := make([]string, len(header))
+		copy(record, rejection.record)
+		writer.Write(append([]string{strconv.Itoa(rejection.Line), rejection.Error, rejection.Details}, record...))
+	}
+	writer.Flush()
+}
@@ -1,23 +1,121 @@
 package controllers
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"github.com/gin-gonic/gin"
-	"gorm.io/gorm"
 	"log"
+	"math"
 	"net/http"
-	"products-api/database"
 	"products-api/models"
+	"products-api/pagination"
+	"products-api/problem"
+	"products-api/repository"
+	"reflect"
 	"strconv"
+	"strings"
+	"time"
 )
 
+// ProductController handles the product endpoints using the given repository
+type ProductController struct {
+	repo           repository.ProductRepository
+	variants       repository.VariantRepository
+	categories     repository.CategoryRepository        // Finds the categories whose attribute schemas apply to a product
+	schemas        repository.AttributeSchemaRepository // Checks the attributes of the products
+	cursors        *pagination.CursorCodec
+	requireIfMatch bool
+	bulkMaxItems   int
+}
+
+// NewProductController creates a ProductController backed by the given repositories
+func NewProductController(repos repository.Repositories, config Config) *ProductController {
+	config = config.WithDefaults()
+
+	return &ProductController{
+		repo:           repos.Products,
+		variants:       repos.Variants,
+		categories:     repos.Categories,
+		schemas:        repos.Schemas,
+		cursors:        pagination.NewCursorCodec([]byte(config.CursorSecret)),
+		requireIfMatch: config.RequireIfMatch,
+		bulkMaxItems:   config.BulkMaxItems,
+	}
+}
+
+// productChanges holds the values of a partial product update, nil fields are left unchanged
+type productChanges struct {
+	Name        *string  `json:"name"`
+	Price       *float64 `json:"price" binding:"omitempty,gte=0"`
+	Description *string  `json:"description"`
+}
+
+// productUpdate holds the values of a partial update of a single product, which can also change the type
+// and attributes of the product, unlike bulk updates and imports
+type productUpdate struct {
+	Name        *string                `json:"name"`
+	Price       *float64               `json:"price" binding:"omitempty,gte=0"`
+	Description *string                `json:"description"`
+	Type        *string                `json:"type" binding:"omitempty,max=50"`
+	Attributes  map[string]interface{} `json:"attributes"` // Merged into the attributes, null values remove them
+}
+
+// Utility function to extract the changes shared with bulk updates and imports
+func (update productUpdate) changes() productChanges {
+	return productChanges{Name: update.Name, Price: update.Price, Description: update.Description}
+}
+
+// Utility function to check the rules of product changes that binding tags cannot express
+func validateProductChanges(changes productChanges) error {
+	if changes.Name != nil && *changes.Name == "" {
+		return problem.ValidationError{problem.NewFieldError("name", "required", "")}
+	}
+	return nil
+}
+
+// Utility function to apply the provided changes to a product, reporting whether any value changed
+func applyProductChanges(product *models.Product, changes productChanges) bool {
+	var updated bool
+	if changes.Name != nil && *changes.Name != product.Name {
+		product.Name = *changes.Name
+		updated = true
+	}
+	if changes.Price != nil && *changes.Price != product.Price {
+		product.Price = *changes.Price
+		updated = true
+	}
+	if changes.Description != nil && *changes.Description != product.Description {
+		product.Description = *changes.Description
+		updated = true
+	}
+	return updated
+}
+
+// Utility function to apply the provided changes to a single product, including its type and attributes,
+// reporting whether any value changed
+func applyProductUpdate(product *models.Product, update productUpdate) bool {
+	updated := applyProductChanges(product, update.changes())
+	if update.Type != nil && *update.Type != product.Type {
+		product.Type = *update.Type
+		updated = true
+	}
+	if update.Attributes != nil {
+		if attributes := mergeAttributes(product.Attributes, update.Attributes); !reflect.DeepEqual(attributes, product.Attributes) {
+			product.Attributes = attributes
+			updated = true
+		}
+	}
+	return updated
+}
+
 // Utility function to parse a product ID from the URL parameters
 func parseProductID(c *gin.Context) (uint64, error) {
 	productIdStr := c.Param("id")
 	// Validate that the ID is an unsigned integer
 	productId, err := strconv.ParseUint(productIdStr, 10, 0) // set base:10 for decimal and bitSize:0 auto size
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID format"})
+		problem.Respond(c, http.StatusBadRequest, problem.CodeInvalidParameter, "Invalid product ID format")
 	}
 	return productId, err
 }
@@ -25,26 +123,160 @@ func parseProductID(c *gin.Context) (uint64, error) {
 // Utility function to bind JSON to a struct and handle errors
 func bindJSON(c *gin.Context, obj interface{}) bool {
 	if err := c.ShouldBindJSON(obj); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": err.Error()})
+		problem.Send(c, problem.FromBindError(err))
 		return false
 	}
 	return true
 }
 
+// Utility function to parse the page and limit query parameters
+func parsePagination(c *gin.Context) (int, int, bool) {
+	pageStr := c.Query("page")
+	limitStr := c.Query("limit")
+
+	// Set default values if not provided
+	page := 1   // Default to page 1
+	limit := 10 // Default to 10 items per page
+
+	// Parse the page query parameter
+	if pageStr != "" {
+		parsedPage, err := strconv.Atoi(pageStr)
+		if err != nil || parsedPage <= 0 {
+			problem.Respond(c, http.StatusBadRequest, problem.CodeInvalidParameter, "Invalid page number, must be a positive integer")
+			return 0, 0, false
+		}
+		page = parsedPage
+	}
+
+	// Parse the limit query parameter
+	if limitStr != "" {
+		parsedLimit, err := strconv.Atoi(limitStr)
+		if err != nil || parsedLimit <= 0 {
+			problem.Respond(c, http.StatusBadRequest, problem.CodeInvalidParameter, "Invalid limit, must be a positive integer")
+			return 0, 0, false
+		}
+		limit = parsedLimit
+	}
+
+	return page, limit, true
+}
+
+// Utility function to parse the product filter from the query parameters
+func parseProductFilter(c *gin.Context) (repository.ProductFilter, bool) {
+	filter := repository.ProductFilter{
+		Name:        c.Query("name"),
+		Description: c.Query("description"),
+	}
+
+	// Parse the price range query parameters
+	priceParams := []struct {
+		name   string
+		target **float64
+	}{
+		{"min_price", &filter.MinPrice},
+		{"max_price", &filter.MaxPrice},
+	}
+	for _, param := range priceParams {
+		if valueStr := c.Query(param.name); valueStr != "" {
+			value, err := strconv.ParseFloat(valueStr, 64)
+			if err != nil || value < 0 || math.IsNaN(value) || math.IsInf(value, 0) {
+				problem.Respond(c, http.StatusBadRequest, problem.CodeInvalidParameter, "Invalid "+param.name+", must be a non-negative number")
+				return filter, false
+			}
+			*param.target = &value
+		}
+	}
+	if filter.MinPrice != nil && filter.MaxPrice != nil && *filter.MinPrice > *filter.MaxPrice {
+		problem.Respond(c, http.StatusBadRequest, problem.CodeInvalidParameter, "Invalid price range, min_price must not be greater than max_price")
+		return filter, false
+	}
+
+	// Parse the timestamp query parameters
+	timeParams := []struct {
+		name   string
+		target **time.Time
+	}{
+		{"created_after", &filter.CreatedAfter},
+		{"created_before", &filter.CreatedBefore},
+		{"updated_since", &filter.UpdatedSince},
+	}
+	for _, param := range timeParams {
+		if valueStr := c.Query(param.name); valueStr != "" {
+			value, err := time.Parse(time.RFC3339, valueStr)
+			if err != nil {
+				problem.Respond(c, http.StatusBadRequest, problem.CodeInvalidParameter, "Invalid "+param.name+", must be an RFC3339 timestamp")
+				return filter, false
+			}
+			// Compare in UTC whatever the offset, as SQLite compares the stored times as text
+			value = value.UTC()
+			*param.target = &value
+		}
+	}
+
+	// Parse the type and attribute query parameters
+	filter.Type = c.Query("type")
+	attributes, ok := parseAttributeFilters(c)
+	if !ok {
+		return filter, false
+	}
+	filter.Attributes = attributes
+
+	// Parse the tags query parameters, matching products with any or all of the tags
+	if tagsStr, ok := c.GetQuery("tags"); ok {
+		filter.Tags = models.NormalizeTags(strings.Split(tagsStr, ","))
+		if len(filter.Tags) == 0 {
+			problem.Respond(c, http.StatusBadRequest, problem.CodeInvalidParameter, "Invalid tags, must be a comma-separated list of tags")
+			return filter, false
+		}
+	}
+	switch tagMode := c.DefaultQuery("tag_mode", "any"); tagMode {
+	case "any", "all":
+		filter.AllTags = tagMode == "all"
+	default:
+		problem.Respond(c, http.StatusBadRequest, problem.CodeInvalidParameter, "Invalid tag_mode, must be any or all")
+		return filter, false
+	}
+
+	return filter, true
+}
+
+// Utility function to parse the as_of query parameter, the time at which products are read, if any
+func parseAsOf(c *gin.Context) (*time.Time, bool) {
+	asOfStr := c.Query("as_of")
+	if asOfStr == "" {
+		return nil, true
+	}
+	asOf, err := time.Parse(time.RFC3339, asOfStr)
+	if err != nil {
+		problem.Respond(c, http.StatusBadRequest, problem.CodeInvalidParameter, "Invalid as_of, must be an RFC3339 timestamp")
+		return nil, false
+	}
+	asOf = asOf.UTC()
+	return &asOf, true
+}
+
 // Utility function to respond with an error when a database operation fails
 func handleDBError(c *gin.Context, err error, errorMessage string) {
-	c.JSON(http.StatusInternalServerError, gin.H{"error": errorMessage})
+	problem.Respond(c, http.StatusInternalServerError, problem.CodeInternalError, errorMessage)
 	log.Println(err.Error())
 }
 
-func CreateProduct(c *gin.Context) {
+func (pc *ProductController) CreateProduct(c *gin.Context) {
 	var product models.Product
 	if !bindJSON(c, &product) {
 		return
 	}
 
-	// Create product in the database
-	if err := database.DB.Create(&product).Error; err != nil {
+	// Check the attributes against the schema of the product type, null attributes are left out
+	ctx := c.Request.Context()
+	product.Attributes = mergeAttributes(nil, product.Attributes)
+	if err := pc.validateAttributes(ctx, &product); err != nil {
+		handleAttributesError(c, err)
+		return
+	}
+
+	// Create product in the store
+	if err := pc.repo.Create(ctx, &product); err != nil {
 		handleDBError(c, err, "Failed to create product")
 		return
 	}
@@ -56,17 +288,27 @@ func CreateProduct(c *gin.Context) {
 	})
 }
 
-func GetProductById(c *gin.Context) {
+func (pc *ProductController) GetProductById(c *gin.Context) {
 	productId, err := parseProductID(c)
 	if err != nil {
 		return
 	}
 
-	var product models.Product
-	// Attempt to find the product by ID
-	if err := database.DB.First(&product, productId).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+	asOf, ok := parseAsOf(c)
+	if !ok {
+		return
+	}
+
+	// Attempt to find the product by ID, as it is now or as it was at the requested time
+	var product *models.Product
+	if asOf != nil {
+		product, err = pc.getProductAsOf(c.Request.Context(), productId, *asOf)
+	} else {
+		product, err = pc.repo.Get(c.Request.Context(), productId)
+	}
+	if err != nil {
+		if errors.Is(err, repository.ErrProductNotFound) {
+			problem.Respond(c, http.StatusNotFound, problem.CodeProductNotFound, "Product not found")
 		} else {
 			// Handle other possible database errors
 			handleDBError(c, err, "Could not retrieve product")
@@ -74,144 +316,358 @@ func GetProductById(c *gin.Context) {
 		return
 	}
 
-	c.JSON(http.StatusOK, product)
+	// Embed the current variants, which are not versioned, so past products are returned without them
+	var body []byte
+	if asOf != nil {
+		body, err = json.Marshal(product)
+	} else {
+		var variants []models.Variant
+		variants, err = pc.variants.ListByProduct(c.Request.Context(), productId)
+		if err != nil {
+			handleDBError(c, err, "Could not retrieve variants")
+			return
+		}
+		body, err = json.Marshal(productWithVariants{Product: product, Variants: variants})
+	}
+	if err != nil {
+		handleDBError(c, err, "Could not encode product")
+		return
+	}
+	respondConditionally(c, productETag(product), product.UpdatedAt, body)
 }
 
-func GetProducts(c *gin.Context) {
-	var products []models.Product // Slice to hold the products array
+func (pc *ProductController) GetProducts(c *gin.Context) {
+	pc.listProducts(c, repository.ProductFilter{})
+}
 
-	// Get query parameters for pagination
-	pageStr := c.Query("page")
-	limitStr := c.Query("limit")
+func (pc *ProductController) GetTrash(c *gin.Context) {
+	pc.listProducts(c, repository.ProductFilter{Trashed: true})
+}
 
-	// Set default values if not provided
-	page := 1   // Default to page 1
-	limit := 10 // Default to 10 items per page
+// listProducts responds with a page of the products matching the query parameters within the given scope,
+// which selects the trash instead of the live products, or the products of some categories
+func (pc *ProductController) listProducts(c *gin.Context, scope repository.ProductFilter) {
+	// Parse the pagination query parameters
+	page, limit, ok := parsePagination(c)
+	if !ok {
+		return
+	}
 
-	// Parse the page query parameter
-	if pageStr != "" {
-		parsedPage, err := strconv.Atoi(pageStr)
-		if err != nil || parsedPage <= 0 {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid page number, must be a positive integer"})
+	// Parse the filtering query parameters
+	filter, ok := parseProductFilter(c)
+	if !ok {
+		return
+	}
+	filter.Trashed = scope.Trashed
+	filter.CategoryIDs = scope.CategoryIDs
+
+	// The trash only holds the current state of products, so only live products can be read in the past
+	if !filter.Trashed {
+		if filter.AsOf, ok = parseAsOf(c); !ok {
 			return
 		}
-		page = parsedPage
 	}
 
-	// Parse the limit query parameter
-	if limitStr != "" {
-		parsedLimit, err := strconv.Atoi(limitStr)
-		if err != nil || parsedLimit <= 0 {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit, must be a positive integer"})
+	// Parse the sort query parameter
+	sortFields, err := repository.ParseSort(c.Query("sort"))
+	if err != nil {
+		problem.Respond(c, http.StatusBadRequest, problem.CodeInvalidParameter, "Invalid sort, "+err.Error())
+		return
+	}
+
+	// Parse the cursor query parameter, which replaces the page
+	var keyset *repository.Keyset
+	if cursorStr := c.Query("cursor"); cursorStr != "" {
+		if c.Query("page") != "" {
+			problem.Respond(c, http.StatusBadRequest, problem.CodeInvalidParameter, "Invalid pagination, page and cursor cannot be used together")
 			return
 		}
-		limit = parsedLimit
+		cursor, err := pc.cursors.Decode(cursorStr)
+		if err != nil {
+			problem.Respond(c, http.StatusBadRequest, problem.CodeInvalidParameter, "Invalid cursor")
+			return
+		}
+		if cursor.Sort != repository.FormatSort(sortFields) {
+			problem.Respond(c, http.StatusBadRequest, problem.CodeInvalidParameter, "Invalid cursor, it was issued for a different sort order")
+			return
+		}
+		keyset = &repository.Keyset{Key: cursor.Key, Backward: cursor.Backward}
 	}
 
-	var totalProducts int64
-	// Get the total count of products for pagination
-	if err := database.DB.Model(&models.Product{}).Count(&totalProducts).Error; err != nil {
+	ctx := c.Request.Context()
+
+	// Get the total count of matching products for pagination
+	totalProducts, err := pc.repo.Count(ctx, filter)
+	if err != nil {
 		handleDBError(c, err, "Could not retrieve product count")
 		return
 	}
 
-	// Retrieve the products with offset and limit for pagination
-	if err := database.DB.Offset((page - 1) * limit).Limit(limit).Find(&products).Error; err != nil {
+	// Retrieve one product more than requested to know whether another page follows
+	products, err := pc.repo.List(ctx, repository.ListOptions{
+		Filter: filter,
+		Sort:   sortFields,
+		Keyset: keyset,
+		Offset: (page - 1) * limit,
+		Limit:  limit + 1,
+	})
+	if err != nil {
 		handleDBError(c, err, "Could not retrieve products")
 		return
 	}
 
+	backward := keyset != nil && keyset.Backward
+	hasMore := len(products) > limit
+	if hasMore {
+		// Backward pages end at the boundary, so the extra product is the first one
+		if backward {
+			products = products[1:]
+		} else {
+			products = products[:limit]
+		}
+	}
+
+	// Link to the neighbouring pages through cursors on the first and last products
+	var nextCursor, prevCursor *string
+	if len(products) > 0 {
+		sortExpr := repository.FormatSort(sortFields)
+		if hasMore || backward {
+			next := pc.cursors.Encode(pagination.Cursor{Sort: sortExpr, Key: products[len(products)-1]})
+			nextCursor = &next
+		}
+		if (backward && hasMore) || (!backward && (keyset != nil || page > 1)) {
+			prev := pc.cursors.Encode(pagination.Cursor{Sort: sortExpr, Backward: true, Key: products[0]})
+			prevCursor = &prev
+		}
+	}
+
+	response := gin.H{
+		"total":       totalProducts,
+		"limit":       limit,
+		"data":        products,
+		"next_cursor": nextCursor,
+		"prev_cursor": prevCursor,
+	}
+	if keyset == nil {
+		response["page"] = page
+	}
+
+	// The page is as recent as its most recently updated product
+	var lastModified time.Time
+	for _, product := range products {
+		if product.UpdatedAt.After(lastModified) {
+			lastModified = product.UpdatedAt
+		}
+	}
+
+	body, err := json.Marshal(response)
+	if err != nil {
+		handleDBError(c, err, "Could not encode products")
+		return
+	}
+	respondConditionally(c, contentETag(body), lastModified, body)
+}
+
+func (pc *ProductController) SearchProducts(c *gin.Context) {
+	query := c.Query("q")
+	terms := repository.ParseSearchTerms(query)
+	if len(terms) == 0 {
+		problem.Respond(c, http.StatusBadRequest, problem.CodeInvalidParameter, "Invalid search query, q must contain at least one word")
+		return
+	}
+
+	// Parse the pagination query parameters
+	page, limit, ok := parsePagination(c)
+	if !ok {
+		return
+	}
+
+	// Search the products, most relevant first
+	results, total, err := pc.repo.Search(c.Request.Context(), repository.SearchOptions{
+		Terms:  terms,
+		Offset: (page - 1) * limit,
+		Limit:  limit,
+	})
+	if err != nil {
+		handleDBError(c, err, "Could not search products")
+		return
+	}
+
 	c.JSON(http.StatusOK, gin.H{
-		"total": totalProducts,
+		"query": query,
+		"total": total,
 		"page":  page,
 		"limit": limit,
-		"data":  products,
+		"data":  results,
 	})
 }
 
-func DeleteProduct(c *gin.Context) {
+func (pc *ProductController) DeleteProduct(c *gin.Context) {
 	productId, err := parseProductID(c)
 	if err != nil {
 		return
 	}
 
-	// Attempt to delete the product from the database
-	result := database.DB.Delete(&models.Product{}, productId)
+	// Parse the purge query parameter, which removes the product permanently instead of moving it to the trash
+	var purge bool
+	if purgeStr := c.Query("purge"); purgeStr != "" {
+		purge, err = strconv.ParseBool(purgeStr)
+		if err != nil {
+			problem.Respond(c, http.StatusBadRequest, problem.CodeInvalidParameter, "Invalid purge, must be a boolean")
+			return
+		}
+	}
+
+	ctx := c.Request.Context()
 
-	// Check if the product was found and deleted
-	if result.Error != nil {
-		handleDBError(c, result.Error, "Could not delete product")
+	// Find the existing product to check the preconditions against, products in the trash can only be purged
+	product, err := pc.repo.Get(ctx, productId)
+	if purge && errors.Is(err, repository.ErrProductNotFound) {
+		product, err = pc.getTrashedProduct(ctx, productId)
+	}
+	if err != nil {
+		if errors.Is(err, repository.ErrProductNotFound) {
+			problem.Respond(c, http.StatusNotFound, problem.CodeProductNotFound, "Product not found")
+		} else {
+			handleDBError(c, err, "Could not retrieve product")
+		}
+		return
+	}
+
+	if !pc.checkIfMatch(c, product) {
 		return
 	}
 
-	if result.RowsAffected == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+	// Attempt to delete the product from the store, unless it changed in the meantime
+	message := "Product deleted successfully"
+	if purge {
+		err = pc.repo.Purge(ctx, productId, product.Version)
+		message = "Product permanently deleted"
+	} else {
+		err = pc.repo.Delete(ctx, productId, product.Version)
+	}
+	if err != nil {
+		if errors.Is(err, repository.ErrProductNotFound) {
+			problem.Respond(c, http.StatusNotFound, problem.CodeProductNotFound, "Product not found")
+		} else if errors.Is(err, repository.ErrVersionConflict) {
+			handleVersionConflict(c)
+		} else {
+			handleDBError(c, err, "Could not delete product")
+		}
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Product deleted successfully"})
+	c.Header("ETag", productETag(product))
+	c.JSON(http.StatusOK, gin.H{"message": message})
 }
 
-func UpdateProduct(c *gin.Context) {
+// getTrashedProduct returns the product with the given ID if it is in the trash, or ErrProductNotFound
+func (pc *ProductController) getTrashedProduct(ctx context.Context, id uint64) (*models.Product, error) {
+	return pc.findProduct(ctx, repository.ProductFilter{IDs: []uint{uint(id)}, Trashed: true})
+}
+
+// getProductAsOf returns the product with the given ID as it was at the given time, or ErrProductNotFound
+// if it did not exist then
+func (pc *ProductController) getProductAsOf(ctx context.Context, id uint64, asOf time.Time) (*models.Product, error) {
+	return pc.findProduct(ctx, repository.ProductFilter{IDs: []uint{uint(id)}, AsOf: &asOf})
+}
+
+// findProduct returns the first product matching the filter, or ErrProductNotFound
+func (pc *ProductController) findProduct(ctx context.Context, filter repository.ProductFilter) (*models.Product, error) {
+	products, err := pc.repo.List(ctx, repository.ListOptions{Filter: filter, Limit: 1})
+	if err != nil {
+		return nil, err
+	}
+	if len(products) == 0 {
+		return nil, repository.ErrProductNotFound
+	}
+	return &products[0], nil
+}
+
+func (pc *ProductController) RestoreProduct(c *gin.Context) {
 	productId, err := parseProductID(c)
 	if err != nil {
 		return
 	}
 
-	// Find the existing product in the database
-	var product models.Product
-	if err := database.DB.First(&product, productId).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+	// Take the product out of the trash as a new version
+	product, err := pc.repo.Restore(c.Request.Context(), productId)
+	if err != nil {
+		if errors.Is(err, repository.ErrProductNotFound) {
+			problem.Respond(c, http.StatusNotFound, problem.CodeProductNotFound, "Product not found in trash")
+		} else {
+			handleDBError(c, err, "Could not restore product")
+		}
 		return
 	}
 
-	// Create a temporary struct to hold the updated values
-	var input struct {
-		Name        *string  `json:"name"`
-		Price       *float64 `json:"price" binding:"gte=0"`
-		Description *string  `json:"description"`
-	}
+	c.Header("ETag", productETag(product))
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Product restored successfully",
+		"product": product,
+	})
+}
 
-	// Bind the incoming JSON to the input struct
-	if !bindJSON(c, &input) {
+func (pc *ProductController) UpdateProduct(c *gin.Context) {
+	productId, err := parseProductID(c)
+	if err != nil {
 		return
 	}
 
-	// Track whether any changes were made
-	var updated bool
+	ctx := c.Request.Context()
 
-	// Apply updates only if they are provided
-	if input.Name != nil {
-		if *input.Name == "" {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input", "details": "Name cannot be empty"})
-			return
-		}
-		if *input.Name != product.Name {
-			product.Name = *input.Name
-			updated = true
+	// Find the existing product in the store
+	product, err := pc.repo.Get(ctx, productId)
+	if err != nil {
+		if errors.Is(err, repository.ErrProductNotFound) {
+			problem.Respond(c, http.StatusNotFound, problem.CodeProductNotFound, "Product not found")
+		} else {
+			handleDBError(c, err, "Could not retrieve product")
 		}
+		return
 	}
-	if input.Price != nil && *input.Price != product.Price {
-		product.Price = *input.Price
-		updated = true
+
+	if !pc.checkIfMatch(c, product) {
+		return
 	}
-	if input.Description != nil && *input.Description != product.Description {
-		product.Description = *input.Description
-		updated = true
+
+	// Bind the incoming JSON to the changes struct
+	var input productUpdate
+	if !bindJSON(c, &input) {
+		return
+	}
+	if err := validateProductChanges(input.changes()); err != nil {
+		problem.Send(c, problem.FromBindError(err))
+		return
 	}
 
-	// Only save if there were changes made to the product
+	// Apply updates only if they are provided, tracking whether any changes were made
+	updated := applyProductUpdate(product, input)
+
+	// Only save if there were changes made to the product, which must then match its attribute schemas
 	if updated {
-		if err := database.DB.Save(&product).Error; err != nil {
-			handleDBError(c, err, "Could not update product")
+		if err := pc.validateAttributes(ctx, product); err != nil {
+			handleAttributesError(c, err)
+			return
+		}
+		if err := pc.repo.Update(ctx, product); err != nil {
+			if errors.Is(err, repository.ErrVersionConflict) {
+				handleVersionConflict(c)
+			} else if errors.Is(err, repository.ErrProductNotFound) {
+				problem.Respond(c, http.StatusNotFound, problem.CodeProductNotFound, "Product not found")
+			} else {
+				handleDBError(c, err, "Could not update product")
+			}
 			return
 		}
 
+		c.Header("ETag", productETag(product))
 		c.JSON(http.StatusOK, gin.H{
 			"message": "Product updated successfully",
 			"product": product,
 		})
 	} else {
+		c.Header("ETag", productETag(product))
 		c.JSON(http.StatusOK, gin.H{
 			"message": "No changes detected, product update not performed",
 			"product": product,
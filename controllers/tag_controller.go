@@ -0,0 +1,127 @@
+package controllers
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"products-api/models"
+	"products-api/problem"
+	"products-api/repository"
+	"slices"
+	"strconv"
+)
+
+// productTags holds the tags to add to a product
+type productTags struct {
+	Tags []string `json:"tags" binding:"required,min=1,max=20,dive,required,max=50,excludes=0x2C"`
+}
+
+// updateProductTags saves the product with the given tags and responds with it, unless its tags are unchanged
+func (pc *ProductController) updateProductTags(c *gin.Context, product *models.Product, tags []string, message string) {
+	if slices.Equal(tags, product.Tags) {
+		c.Header("ETag", productETag(product))
+		c.JSON(http.StatusOK, gin.H{
+			"message": "No changes detected, product tags not changed",
+			"product": product,
+		})
+		return
+	}
+
+	product.Tags = tags
+	if err := pc.repo.Update(c.Request.Context(), product); err != nil {
+		if errors.Is(err, repository.ErrVersionConflict) {
+			handleVersionConflict(c)
+		} else if errors.Is(err, repository.ErrProductNotFound) {
+			problem.Respond(c, http.StatusNotFound, problem.CodeProductNotFound, "Product not found")
+		} else {
+			handleDBError(c, err, "Could not update product tags")
+		}
+		return
+	}
+
+	c.Header("ETag", productETag(product))
+	c.JSON(http.StatusOK, gin.H{
+		"message": message,
+		"product": product,
+	})
+}
+
+// getProductForChange finds the product to change and checks the If-Match header against it
+func (pc *ProductController) getProductForChange(c *gin.Context) (*models.Product, bool) {
+	productId, err := parseProductID(c)
+	if err != nil {
+		return nil, false
+	}
+
+	product, err := pc.repo.Get(c.Request.Context(), productId)
+	if err != nil {
+		if errors.Is(err, repository.ErrProductNotFound) {
+			problem.Respond(c, http.StatusNotFound, problem.CodeProductNotFound, "Product not found")
+		} else {
+			handleDBError(c, err, "Could not retrieve product")
+		}
+		return nil, false
+	}
+
+	return product, pc.checkIfMatch(c, product)
+}
+
+func (pc *ProductController) AddProductTags(c *gin.Context) {
+	product, ok := pc.getProductForChange(c)
+	if !ok {
+		return
+	}
+
+	var input productTags
+	if !bindJSON(c, &input) {
+		return
+	}
+
+	// Tags the product already has are ignored
+	tags := models.NormalizeTags(slices.Concat(product.Tags, input.Tags))
+	if len(tags) > models.MaxProductTags {
+		fieldError := problem.NewFieldError("tags", "max", strconv.Itoa(models.MaxProductTags))
+		problem.Send(c, problem.FromBindError(problem.ValidationError{fieldError}))
+		return
+	}
+
+	pc.updateProductTags(c, product, tags, "Tags added successfully")
+}
+
+func (pc *ProductController) RemoveProductTag(c *gin.Context) {
+	product, ok := pc.getProductForChange(c)
+	if !ok {
+		return
+	}
+
+	// The tag is matched in its normalized form, so any case works
+	tag := models.NormalizeTags([]string{c.Param("tag")})
+	if len(tag) == 0 || !slices.Contains(product.Tags, tag[0]) {
+		problem.Send(c, problem.New(http.StatusNotFound, problem.CodeTagNotFound, "Tag not found on product").With("tag", c.Param("tag")))
+		return
+	}
+
+	tags := slices.DeleteFunc(slices.Clone(product.Tags), func(productTag string) bool { return productTag == tag[0] })
+	pc.updateProductTags(c, product, tags, "Tag removed successfully")
+}
+
+func (pc *ProductController) GetTags(c *gin.Context) {
+	// Parse the pagination query parameters
+	page, limit, ok := parsePagination(c)
+	if !ok {
+		return
+	}
+
+	tags, total, err := pc.repo.ListTags(c.Request.Context(), (page-1)*limit, limit)
+	if err != nil {
+		handleDBError(c, err, "Could not retrieve tags")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"total": total,
+		"page":  page,
+		"limit": limit,
+		"data":  tags,
+	})
+}
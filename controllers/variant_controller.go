@@ -0,0 +1,286 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"maps"
+	"net/http"
+	"products-api/models"
+	"products-api/problem"
+	"products-api/repository"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// productWithVariants is the representation of a single product, with its variants embedded
+type productWithVariants struct {
+	*models.Product
+	Variants []models.Variant `json:"variants"`
+}
+
+// variantInput holds the fields of a new variant
+type variantInput struct {
+	SKU        string                 `json:"sku" binding:"required,max=64"`
+	Options    map[string]string      `json:"options" binding:"required,min=1,dive,keys,required,max=50,endkeys,required,max=100"`
+	Price      *float64               `json:"price" binding:"omitempty,gte=0"` // Uses the product price when nil
+	Attributes map[string]interface{} `json:"attributes"`
+}
+
+// variantChanges holds the values of a partial variant update, nil fields are left unchanged
+type variantChanges struct {
+	SKU        *string                `json:"sku" binding:"omitempty,max=64"`
+	Options    map[string]string      `json:"options" binding:"omitempty,min=1,dive,keys,required,max=50,endkeys,required,max=100"`
+	Price      *float64               `json:"price" binding:"omitempty,gte=0"` // Removes the price override when null
+	Attributes map[string]interface{} `json:"attributes"`
+
+	priceSet bool // Whether price was given, since a null one decodes like a missing one
+}
+
+func (changes *variantChanges) UnmarshalJSON(data []byte) error {
+	type fields variantChanges
+	if err := json.Unmarshal(data, (*fields)(changes)); err != nil {
+		return err
+	}
+
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(data, &members); err != nil {
+		return err
+	}
+	_, changes.priceSet = members["price"]
+	return nil
+}
+
+// Utility function to parse a variant ID from the URL parameters
+func parseVariantID(c *gin.Context) (uint64, error) {
+	variantId, err := strconv.ParseUint(c.Param("variant_id"), 10, 0)
+	if err != nil {
+		problem.Respond(c, http.StatusBadRequest, problem.CodeInvalidParameter, "Invalid variant ID format")
+	}
+	return variantId, err
+}
+
+// Utility function to check that the options of a variant stay distinct and non-blank once normalized,
+// which binding tags cannot express
+func validateVariantOptions(options map[string]string) error {
+	normalized := models.NormalizeOptions(options)
+	if len(normalized) != len(options) {
+		return problem.ValidationError{problem.NewFieldError("options", "invalid", "")}
+	}
+	for axis, value := range normalized {
+		if axis == "" || value == "" {
+			return problem.ValidationError{problem.NewFieldError("options", "invalid", "")}
+		}
+	}
+	return nil
+}
+
+// Utility function to apply the provided changes to a variant, reporting whether any value changed
+func applyVariantChanges(variant *models.Variant, changes variantChanges) bool {
+	var updated bool
+	if changes.SKU != nil && *changes.SKU != variant.SKU {
+		variant.SKU = *changes.SKU
+		updated = true
+	}
+	if changes.Options != nil {
+		if options := models.NormalizeOptions(changes.Options); !maps.Equal(options, variant.Options) {
+			variant.Options = options
+			updated = true
+		}
+	}
+	if changes.priceSet && !samePrice(changes.Price, variant.Price) {
+		variant.Price = changes.Price
+		updated = true
+	}
+	if changes.Attributes != nil && !reflect.DeepEqual(changes.Attributes, variant.Attributes) {
+		variant.Attributes = changes.Attributes
+		updated = true
+	}
+	return updated
+}
+
+// Utility function to compare two optional prices
+func samePrice(a, b *float64) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+// Utility function to respond to the failure of a variant operation
+func handleVariantError(c *gin.Context, err error, errorMessage string) {
+	var axesError *repository.VariantAxesError
+	switch {
+	case errors.Is(err, repository.ErrProductNotFound):
+		problem.Respond(c, http.StatusNotFound, problem.CodeProductNotFound, "Product not found")
+	case errors.Is(err, repository.ErrVariantNotFound):
+		problem.Respond(c, http.StatusNotFound, problem.CodeVariantNotFound, "Variant not found")
+	case errors.Is(err, repository.ErrVersionConflict):
+		handleVersionConflict(c)
+	case errors.Is(err, repository.ErrDuplicateSKU):
+		problem.Send(c, problem.FromBindError(problem.ValidationError{problem.NewFieldError("sku", "unique", "")}))
+	case errors.Is(err, repository.ErrDuplicateVariantOptions):
+		problem.Send(c, problem.FromBindError(problem.ValidationError{problem.NewFieldError("options", "unique", "")}))
+	case errors.As(err, &axesError):
+		fieldError := problem.NewFieldError("options", "axes", strings.Join(axesError.Axes, ", "))
+		problem.Send(c, problem.FromBindError(problem.ValidationError{fieldError}))
+	default:
+		handleDBError(c, err, errorMessage)
+	}
+}
+
+// getLiveProduct finds the live product of the variants, responding with an error when there is none
+func (pc *ProductController) getLiveProduct(c *gin.Context) (*models.Product, bool) {
+	productId, err := parseProductID(c)
+	if err != nil {
+		return nil, false
+	}
+
+	product, err := pc.repo.Get(c.Request.Context(), productId)
+	if err != nil {
+		handleVariantError(c, err, "Could not retrieve product")
+		return nil, false
+	}
+	return product, true
+}
+
+func (pc *ProductController) GetProductVariants(c *gin.Context) {
+	product, ok := pc.getLiveProduct(c)
+	if !ok {
+		return
+	}
+
+	variants, err := pc.variants.ListByProduct(c.Request.Context(), uint64(product.ID))
+	if err != nil {
+		handleDBError(c, err, "Could not retrieve variants")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"product_id": product.ID,
+		"data":       variants,
+	})
+}
+
+func (pc *ProductController) GetProductVariant(c *gin.Context) {
+	product, ok := pc.getLiveProduct(c)
+	if !ok {
+		return
+	}
+	variantId, err := parseVariantID(c)
+	if err != nil {
+		return
+	}
+
+	variant, err := pc.variants.Get(c.Request.Context(), uint64(product.ID), variantId)
+	if err != nil {
+		handleVariantError(c, err, "Could not retrieve variant")
+		return
+	}
+
+	c.JSON(http.StatusOK, variant)
+}
+
+func (pc *ProductController) CreateProductVariant(c *gin.Context) {
+	product, ok := pc.getProductForChange(c)
+	if !ok {
+		return
+	}
+
+	var input variantInput
+	if !bindJSON(c, &input) {
+		return
+	}
+	if err := validateVariantOptions(input.Options); err != nil {
+		problem.Send(c, problem.FromBindError(err))
+		return
+	}
+
+	variant := models.Variant{SKU: input.SKU, Options: input.Options, Price: input.Price, Attributes: input.Attributes}
+	if err := pc.variants.Create(c.Request.Context(), product, &variant); err != nil {
+		handleVariantError(c, err, "Failed to create variant")
+		return
+	}
+
+	c.Header("ETag", productETag(product))
+	c.JSON(http.StatusCreated, gin.H{
+		"message": "Variant created successfully",
+		"variant": variant,
+	})
+}
+
+func (pc *ProductController) UpdateProductVariant(c *gin.Context) {
+	product, ok := pc.getProductForChange(c)
+	if !ok {
+		return
+	}
+	variantId, err := parseVariantID(c)
+	if err != nil {
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	// Find the existing variant of the product
+	variant, err := pc.variants.Get(ctx, uint64(product.ID), variantId)
+	if err != nil {
+		handleVariantError(c, err, "Could not retrieve variant")
+		return
+	}
+
+	var input variantChanges
+	if !bindJSON(c, &input) {
+		return
+	}
+	if input.SKU != nil && *input.SKU == "" {
+		problem.Send(c, problem.FromBindError(problem.ValidationError{problem.NewFieldError("sku", "required", "")}))
+		return
+	}
+	if input.Options != nil {
+		if err := validateVariantOptions(input.Options); err != nil {
+			problem.Send(c, problem.FromBindError(err))
+			return
+		}
+	}
+
+	// Only save if there were changes made to the variant
+	if !applyVariantChanges(variant, input) {
+		c.Header("ETag", productETag(product))
+		c.JSON(http.StatusOK, gin.H{
+			"message": "No changes detected, variant update not performed",
+			"variant": variant,
+		})
+		return
+	}
+
+	if err := pc.variants.Update(ctx, product, variant); err != nil {
+		handleVariantError(c, err, "Could not update variant")
+		return
+	}
+
+	c.Header("ETag", productETag(product))
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Variant updated successfully",
+		"variant": variant,
+	})
+}
+
+func (pc *ProductController) DeleteProductVariant(c *gin.Context) {
+	product, ok := pc.getProductForChange(c)
+	if !ok {
+		return
+	}
+	variantId, err := parseVariantID(c)
+	if err != nil {
+		return
+	}
+
+	if err := pc.variants.Delete(c.Request.Context(), product, variantId); err != nil {
+		handleVariantError(c, err, "Could not delete variant")
+		return
+	}
+
+	c.Header("ETag", productETag(product))
+	c.JSON(http.StatusOK, gin.H{"message": "Variant deleted successfully"})
+}
@@ -0,0 +1,183 @@
+package controllers
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"products-api/problem"
+	"products-api/repository"
+	"reflect"
+	"slices"
+	"strconv"
+)
+
+// Utility function to parse a product version from the given value of the URL or query string
+func parseVersion(c *gin.Context, name, value string) (uint, bool) {
+	version, err := strconv.ParseUint(value, 10, 0)
+	if err != nil || version == 0 {
+		problem.Respond(c, http.StatusBadRequest, problem.CodeInvalidParameter, "Invalid "+name+", must be a positive integer")
+		return 0, false
+	}
+	return uint(version), true
+}
+
+// Utility function to respond to the failure of reading a product version
+func handleVersionError(c *gin.Context, err error, version uint) {
+	if errors.Is(err, repository.ErrVersionNotFound) {
+		problem.Send(c, problem.New(http.StatusNotFound, problem.CodeVersionNotFound, "Version not found").With("version", version))
+	} else {
+		handleDBError(c, err, "Could not retrieve product version")
+	}
+}
+
+func (pc *ProductController) GetProductVersions(c *gin.Context) {
+	productId, err := parseProductID(c)
+	if err != nil {
+		return
+	}
+
+	// Parse the pagination query parameters
+	page, limit, ok := parsePagination(c)
+	if !ok {
+		return
+	}
+
+	versions, total, err := pc.repo.ListVersions(c.Request.Context(), productId, (page-1)*limit, limit)
+	if err != nil {
+		handleDBError(c, err, "Could not retrieve product versions")
+		return
+	}
+	// Every product has at least its first version until it is purged
+	if total == 0 {
+		problem.Respond(c, http.StatusNotFound, problem.CodeProductNotFound, "Product not found")
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"product_id": productId,
+		"total":      total,
+		"page":       page,
+		"limit":      limit,
+		"data":       versions,
+	})
+}
+
+func (pc *ProductController) DiffProductVersions(c *gin.Context) {
+	productId, err := parseProductID(c)
+	if err != nil {
+		return
+	}
+
+	from, ok := parseVersion(c, "version", c.Param("a"))
+	if !ok {
+		return
+	}
+	to, ok := parseVersion(c, "version", c.Param("b"))
+	if !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	fromVersion, err := pc.repo.GetVersion(ctx, productId, from)
+	if err != nil {
+		handleVersionError(c, err, from)
+		return
+	}
+	toVersion, err := pc.repo.GetVersion(ctx, productId, to)
+	if err != nil {
+		handleVersionError(c, err, to)
+		return
+	}
+
+	before, after := fromVersion.Product(), toVersion.Product()
+	c.JSON(http.StatusOK, gin.H{
+		"product_id": productId,
+		"from":       from,
+		"to":         to,
+		"changes":    repository.DiffProducts(&before, &after),
+	})
+}
+
+func (pc *ProductController) RevertProduct(c *gin.Context) {
+	productId, err := parseProductID(c)
+	if err != nil {
+		return
+	}
+
+	version, ok := parseVersion(c, "version", c.Query("version"))
+	if !ok {
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	// Find the existing product in the store
+	product, err := pc.repo.Get(ctx, productId)
+	if err != nil {
+		if errors.Is(err, repository.ErrProductNotFound) {
+			problem.Respond(c, http.StatusNotFound, problem.CodeProductNotFound, "Product not found")
+		} else {
+			handleDBError(c, err, "Could not retrieve product")
+		}
+		return
+	}
+
+	if !pc.checkIfMatch(c, product) {
+		return
+	}
+
+	target, err := pc.repo.GetVersion(ctx, productId, version)
+	if err != nil {
+		handleVersionError(c, err, version)
+		return
+	}
+
+	// Restore the values of the past version as a new version, keeping the versions in between
+	snapshot := target.Product()
+	updated := applyProductChanges(product, productChanges{
+		Name:        &snapshot.Name,
+		Price:       &snapshot.Price,
+		Description: &snapshot.Description,
+	})
+	if !slices.Equal(snapshot.Tags, product.Tags) {
+		product.Tags = snapshot.Tags
+		updated = true
+	}
+	if snapshot.Type != product.Type || !reflect.DeepEqual(snapshot.Attributes, product.Attributes) {
+		product.Type, product.Attributes = snapshot.Type, mergeAttributes(nil, snapshot.Attributes)
+		updated = true
+	}
+	if !updated {
+		c.Header("ETag", productETag(product))
+		c.JSON(http.StatusOK, gin.H{
+			"message": "No changes detected, product revert not performed",
+			"product": product,
+		})
+		return
+	}
+
+	// The attributes of the version may not match the schemas that apply to the product now
+	if err := pc.validateAttributes(ctx, product); err != nil {
+		handleAttributesError(c, err)
+		return
+	}
+
+	if err := pc.repo.Update(ctx, product); err != nil {
+		if errors.Is(err, repository.ErrVersionConflict) {
+			handleVersionConflict(c)
+		} else if errors.Is(err, repository.ErrProductNotFound) {
+			problem.Respond(c, http.StatusNotFound, problem.CodeProductNotFound, "Product not found")
+		} else {
+			handleDBError(c, err, "Could not revert product")
+		}
+		return
+	}
+
+	c.Header("ETag", productETag(product))
+	c.JSON(http.StatusOK, gin.H{
+		"message": fmt.Sprintf("Product reverted to version %d", version),
+		"product": product,
+	})
+}
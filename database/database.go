@@ -2,48 +2,107 @@ package database
 
 import (
 	"fmt"
+	"github.com/glebarez/sqlite"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 	"log"
 	"os"
+	"time"
 )
 
-var DB *gorm.DB
+// Supported database drivers
+const (
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+)
+
+// SQLiteInMemory is the SQLite path that keeps the whole database in memory
+const SQLiteInMemory = ":memory:"
 
 // Config holds the database configuration
 type Config struct {
+	Driver   string
 	Host     string
 	User     string
 	Password string
 	Name     string
 	Port     string
+	Path     string // Database file for SQLite, or SQLiteInMemory
 }
 
-// ConnectDB initializes the database connection
-func ConnectDB() {
-	// Load database configuration from environment variables
+// LoadConfig loads the database configuration from environment variables
+func LoadConfig() Config {
 	config := Config{
+		Driver:   os.Getenv("DB_DRIVER"),
 		Host:     os.Getenv("DB_HOST"),
 		User:     os.Getenv("DB_USER"),
 		Password: os.Getenv("DB_PASSWORD"),
 		Name:     os.Getenv("DB_NAME"),
 		Port:     os.Getenv("DB_PORT"),
+		Path:     os.Getenv("DB_PATH"),
 	}
 
-	// Validate essential fields
-	if config.Host == "" || config.User == "" || config.Password == "" || config.Name == "" || config.Port == "" {
-		log.Fatal("Database configuration is incomplete.")
+	// Default to PostgreSQL for backward compatibility
+	if config.Driver == "" {
+		config.Driver = DriverPostgres
+	}
+	return config
+}
+
+// InMemory reports whether the database only lives as long as the process, which is the case of SQLite with SQLiteInMemory
+func (c Config) InMemory() bool {
+	return c.Driver == DriverSQLite && c.Path == SQLiteInMemory
+}
+
+// Open opens a database connection using the given configuration
+func Open(config Config) (*gorm.DB, error) {
+	switch config.Driver {
+	case DriverPostgres:
+		// Validate essential fields
+		if config.Host == "" || config.User == "" || config.Password == "" || config.Name == "" || config.Port == "" {
+			return nil, fmt.Errorf("database configuration is incomplete")
+		}
+
+		// Create the Data Source Name (DSN)
+		dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=disable",
+			config.Host, config.User, config.Password, config.Name, config.Port)
+
+		return gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	case DriverSQLite:
+		if config.Path == "" {
+			return nil, fmt.Errorf("database configuration is incomplete, DB_PATH is required for sqlite")
+		}
+
+		// SQLite stores times as text and compares them as strings, so every time must be stored in UTC
+		db, err := gorm.Open(sqlite.Open(config.Path), &gorm.Config{NowFunc: func() time.Time { return time.Now().UTC() }})
+		if err != nil {
+			return nil, err
+		}
+
+		// Every connection to ":memory:" gets its own empty database, so share a single one
+		if config.InMemory() {
+			sqlDB, err := db.DB()
+			if err != nil {
+				return nil, err
+			}
+			sqlDB.SetMaxOpenConns(1)
+		}
+		return db, nil
+	default:
+		return nil, fmt.Errorf("unsupported database driver %q", config.Driver)
 	}
+}
 
-	// Create the Data Source Name (DSN)
-	dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=disable",
-		config.Host, config.User, config.Password, config.Name, config.Port)
+// ConnectDB initializes and returns the database connection
+func ConnectDB() *gorm.DB {
+	// Load database configuration from environment variables
+	config := LoadConfig()
 
 	// Open the database connection
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	db, err := Open(config)
 	if err != nil {
 		log.Fatal("Failed to connect to database:", err)
 	}
 
-	DB = db
+	return db
 }
@@ -1,29 +1,46 @@
 package main
 
 import (
+	"context"
 	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
 	"log"
 	"net/http"
+	"os"
+	"products-api/controllers"
 	"products-api/database"
-	"products-api/models"
+	"products-api/migrations"
+	"products-api/repository"
 	"products-api/routes"
+	"strconv"
+	"time"
 )
 
 func main() {
-	router := gin.Default()
+	// Run the migrate subcommand instead of the server when requested
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		runMigrateCommand(os.Args[2:])
+		return
+	}
 
-	// Initialize database connection
-	database.ConnectDB()
+	router := gin.Default()
 
-	// Perform migration
-	migrateDatabase()
+	// Initialize the stores
+	repos := setupRepositories()
 
 	router.Handle("GET", "/health", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{"status": "ok"})
 	})
 
 	// Set up routes
-	routes.SetupRoutes(router)
+	config := controllers.LoadConfig()
+	if config.CursorSecret == "" {
+		log.Println("Warning: CURSOR_SECRET is not set, pagination cursors will not survive restarts")
+	}
+	routes.SetupRoutes(router, repos, config)
+
+	// Remove expired idempotency records and old trashed products in the background
+	go runMaintenance(repos, config.WithDefaults())
 
 	// Start server on default port
 	err := router.Run()
@@ -32,10 +49,80 @@ func main() {
 	}
 }
 
-// migrateDatabase performs database migrations
-func migrateDatabase() {
-	err := database.DB.AutoMigrate(&models.Product{})
+// setupRepositories creates the stores selected by the STORAGE_BACKEND environment variable
+func setupRepositories() repository.Repositories {
+	switch os.Getenv("STORAGE_BACKEND") {
+	case "memory":
+		log.Println("Using in-memory storage, data will not be persisted")
+		return repository.NewMemoryRepositories()
+	case "", "database":
+		// Initialize database connection
+		db := database.ConnectDB()
+
+		// Make sure the schema is up to date, an in-memory database starts empty and is only reachable from this process
+		migrateOnStart, _ := strconv.ParseBool(os.Getenv("MIGRATE_ON_START"))
+		if migrateOnStart || database.LoadConfig().InMemory() {
+			applyMigrations(db)
+		} else {
+			checkMigrations(db)
+		}
+
+		return repository.NewGormRepositories(db)
+	default:
+		log.Fatalf("Unknown STORAGE_BACKEND %q, expected \"database\" or \"memory\"", os.Getenv("STORAGE_BACKEND"))
+		return repository.Repositories{}
+	}
+}
+
+// runMaintenance periodically deletes the idempotency records whose TTL has passed
+// and the products that have been in the trash for longer than the retention window
+func runMaintenance(repos repository.Repositories, config controllers.Config) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		ctx := context.Background()
+
+		deleted, err := repos.Idempotency.DeleteExpired(ctx, time.Now())
+		if err != nil {
+			log.Println("Failed to purge expired idempotency records:", err)
+		} else if deleted > 0 {
+			log.Printf("Purged %d expired idempotency records", deleted)
+		}
+
+		purged, err := repos.Products.PurgeDeleted(ctx, time.Now().Add(-config.TrashRetention))
+		if err != nil {
+			log.Println("Failed to purge trashed products:", err)
+		} else if purged > 0 {
+			log.Printf("Purged %d products from the trash", purged)
+		}
+	}
+}
+
+// applyMigrations applies the migrations embedded in the binary that are pending
+func applyMigrations(db *gorm.DB) {
+	migrator, err := migrations.New(db)
 	if err != nil {
-		log.Fatal("Failed to migrate database:", err)
+		log.Fatal("Failed to load migrations:", err)
+	}
+
+	if err := migrator.Up(context.Background()); err != nil {
+		log.Fatal("Migration failed: ", err)
+	}
+}
+
+// checkMigrations warns when the database schema is behind the migrations embedded in the binary
+func checkMigrations(db *gorm.DB) {
+	migrator, err := migrations.New(db)
+	if err != nil {
+		log.Fatal("Failed to load migrations:", err)
+	}
+
+	pending, err := migrator.Pending(context.Background())
+	if err != nil {
+		log.Fatal("Failed to check migrations:", err)
+	}
+	if pending > 0 {
+		log.Printf("Warning: %d pending database migrations, run \"products-api migrate up\"", pending)
 	}
 }
@@ -1,41 +1,42 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
+	"products-api/controllers"
 	"products-api/database"
-	"products-api/models"
+	"products-api/migrations"
+	"products-api/repository"
 	"products-api/routes"
 	"testing"
 
 	"github.com/gin-gonic/gin"
-	"gorm.io/driver/postgres"
-	"gorm.io/gorm"
 )
 
-var testDB *gorm.DB
+var testRepos repository.Repositories
+var testRepo repository.ProductRepository
 var testRouter *gin.Engine
 
+// resetStore removes all products, versions, categories, tags, variants, audit and idempotency records from the test stores
+// and restarts the ID sequences
+var resetStore func() error
+
 func TestMain(m *testing.M) {
 	// Set Gin to Test Mode
 	gin.SetMode(gin.TestMode)
 
-	// Setup Test Database
-	var err error
-	dsn := "host=localhost user=testuser password=testpass dbname=testdb port=5433 sslmode=disable"
-	testDB, err = gorm.Open(postgres.Open(dsn), &gorm.Config{})
-	if err != nil {
-		log.Fatal("Failed to connect to test database:", err)
-	}
-
-	// Migrate the schema
-	err = testDB.AutoMigrate(&models.Product{})
-	if err != nil {
-		log.Fatal("Failed to migrate test database:", err)
+	// Setup the test store, the in-memory one unless STORAGE_BACKEND asks for the database
+	switch os.Getenv("STORAGE_BACKEND") {
+	case "", "memory":
+		setupMemoryStore()
+	case "database":
+		setupDatabaseStore()
+	default:
+		log.Fatalf("Unknown STORAGE_BACKEND %q", os.Getenv("STORAGE_BACKEND"))
 	}
 
-	// Set the global DB variable to our test DB
-	database.DB = testDB
+	testRepo = testRepos.Products
 
 	// Setup the router
 	testRouter = setupRouter()
@@ -47,8 +48,80 @@ func TestMain(m *testing.M) {
 	os.Exit(code)
 }
 
+func setupMemoryStore() {
+	productRepo := repository.NewMemoryProductRepository()
+	idempotencyRepo := repository.NewMemoryIdempotencyRepository()
+	categoryRepo := repository.NewMemoryCategoryRepository(productRepo)
+	variantRepo := repository.NewMemoryVariantRepository(productRepo)
+	schemaRepo := repository.NewMemoryAttributeSchemaRepository(categoryRepo)
+	testRepos = repository.Repositories{
+		Products:    productRepo,
+		Idempotency: idempotencyRepo,
+		Audit:       repository.NewMemoryAuditRepository(productRepo),
+		Categories:  categoryRepo,
+		Variants:    variantRepo,
+		Schemas:     schemaRepo,
+	}
+	resetStore = func() error {
+		productRepo.Reset()
+		idempotencyRepo.Reset()
+		categoryRepo.Reset()
+		variantRepo.Reset()
+		schemaRepo.Reset()
+		return nil
+	}
+}
+
+func setupDatabaseStore() {
+	// Setup Test Database
+	testDB, err := database.Open(testDatabaseConfig())
+	if err != nil {
+		log.Fatal("Failed to connect to test database:", err)
+	}
+
+	// Migrate the schema
+	migrator, err := migrations.New(testDB)
+	if err != nil {
+		log.Fatal("Failed to load migrations:", err)
+	}
+	if err := migrator.Up(context.Background()); err != nil {
+		log.Fatal("Failed to migrate test database:", err)
+	}
+
+	testRepos = repository.NewGormRepositories(testDB)
+	resetStore = func() error {
+		if err := testDB.Exec("DELETE FROM idempotency_keys").Error; err != nil {
+			return err
+		}
+		if testDB.Dialector.Name() == database.DriverSQLite {
+			for _, table := range []string{"products", "product_versions", "audit_log", "product_categories", "categories", "product_tags", "product_variants", "attribute_schemas"} {
+				if err := testDB.Exec("DELETE FROM " + table).Error; err != nil {
+					return err
+				}
+			}
+			return testDB.Exec("DELETE FROM sqlite_sequence WHERE name IN ('products', 'audit_log', 'categories', 'product_variants', 'attribute_schemas')").Error
+		}
+		return testDB.Exec("TRUNCATE TABLE products, product_versions, audit_log, product_categories, categories, product_tags, product_variants, attribute_schemas RESTART IDENTITY").Error
+	}
+}
+
+// testDatabaseConfig returns the configuration of the test database selected by DB_DRIVER
+func testDatabaseConfig() database.Config {
+	if os.Getenv("DB_DRIVER") == database.DriverSQLite {
+		return database.Config{Driver: database.DriverSQLite, Path: database.SQLiteInMemory}
+	}
+	return database.Config{
+		Driver:   database.DriverPostgres,
+		Host:     "localhost",
+		User:     "testuser",
+		Password: "testpass",
+		Name:     "testdb",
+		Port:     "5433",
+	}
+}
+
 func setupRouter() *gin.Engine {
 	r := gin.Default()
-	routes.SetupRoutes(r)
+	routes.SetupRoutes(r, testRepos, controllers.Config{CursorSecret: "test-cursor-secret"})
 	return r
 }
@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"products-api/problem"
+	"products-api/repository"
+	"strings"
+)
+
+// ActorHeader names who is making the request, as recorded in the audit log
+const ActorHeader = "X-Actor"
+
+// AnonymousActor is recorded in the audit log for requests without an X-Actor header
+const AnonymousActor = "anonymous"
+
+// maxActorLength is the longest actor accepted, matching the size of the database column
+const maxActorLength = 255
+
+// Audit attributes the product changes made while handling the request to the actor of the X-Actor header
+// and to the request ID assigned by the RequestID middleware, which must run first
+func Audit() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		actor := strings.TrimSpace(c.GetHeader(ActorHeader))
+		if actor == "" {
+			actor = AnonymousActor
+		}
+		if len(actor) > maxActorLength {
+			problem.Abort(c, http.StatusBadRequest, problem.CodeInvalidHeader, "Invalid X-Actor, must be at most 255 characters")
+			return
+		}
+
+		ctx := repository.WithAuditInfo(c.Request.Context(), repository.AuditInfo{
+			Actor:     actor,
+			RequestID: c.GetString(RequestIDKey),
+		})
+		c.Request = c.Request.WithContext(ctx)
+		c.Next()
+	}
+}
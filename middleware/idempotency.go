@@ -0,0 +1,175 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"io"
+	"log"
+	"net/http"
+	"products-api/models"
+	"products-api/problem"
+	"products-api/repository"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// IdempotencyKeyHeader is the request header identifying retries of the same request
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// maxIdempotencyKeyLength is the longest key accepted, matching the size of the database column
+const maxIdempotencyKeyLength = 255
+
+// maxIdempotentBodySize is the largest body, in bytes, read into memory to fingerprint a request
+const maxIdempotentBodySize = 10 << 20
+
+// streamedContentTypes lists the content types of the uploads streamed to the handlers, which are
+// fingerprinted by their type and length instead of being read into memory
+var streamedContentTypes = []string{"text/csv", "application/csv", "multipart/form-data"}
+
+// replayedHeaders lists the response headers stored and replayed along with the body
+var replayedHeaders = []string{"Content-Type", "ETag", "Last-Modified", "Location"}
+
+// responseRecorder keeps a copy of the response body written by the handlers
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *responseRecorder) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *responseRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// Idempotency makes POST and PATCH requests carrying an Idempotency-Key header safe to retry:
+// the response of the first request is stored for the given TTL and replayed for retries,
+// while reusing a key for a different request is rejected with 422 Unprocessable Entity.
+// Keys are scoped to the actor set by the Audit middleware, which must run first
+func Idempotency(repo repository.IdempotencyRepository, ttl time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyKeyHeader)
+		if key == "" || (c.Request.Method != http.MethodPost && c.Request.Method != http.MethodPatch) {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			problem.Abort(c, http.StatusBadRequest, problem.CodeInvalidHeader, "Invalid Idempotency-Key, must be at most 255 characters")
+			return
+		}
+
+		// Read the body to fingerprint the request, then restore it for the handlers
+		var body []byte
+		if slices.Contains(streamedContentTypes, c.ContentType()) {
+			body = []byte(c.ContentType() + " " + strconv.FormatInt(c.Request.ContentLength, 10))
+		} else {
+			var err error
+			body, err = io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxIdempotentBodySize))
+			var maxBytesErr *http.MaxBytesError
+			if errors.As(err, &maxBytesErr) {
+				problem.Abort(c, http.StatusRequestEntityTooLarge, problem.CodeBodyTooLarge, "The body of a request with an Idempotency-Key must be at most 10 MiB")
+				return
+			}
+			if err != nil {
+				problem.Abort(c, http.StatusBadRequest, problem.CodeInvalidBody, err.Error())
+				return
+			}
+			c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		}
+		fingerprint := requestFingerprint(c.Request, body)
+
+		// Prefix the key with the actor so that clients choosing the same key do not see each other's responses
+		ctx := c.Request.Context()
+		key = repository.AuditInfoFrom(ctx).Actor + ":" + key
+		existing, err := repo.Begin(ctx, models.IdempotencyRecord{
+			Key:         key,
+			Fingerprint: fingerprint,
+			ExpiresAt:   time.Now().UTC().Add(ttl),
+		})
+		if err != nil {
+			problem.Abort(c, http.StatusInternalServerError, problem.CodeInternalError, "Could not process Idempotency-Key")
+			log.Println(err.Error())
+			return
+		}
+
+		if existing != nil {
+			switch {
+			case existing.Fingerprint != fingerprint:
+				problem.Abort(c, http.StatusUnprocessableEntity, problem.CodeIdempotencyKeyReused, "Idempotency-Key was already used for a different request")
+			case existing.StatusCode == 0:
+				problem.Abort(c, http.StatusConflict, problem.CodeIdempotencyKeyInUse, "A request with this Idempotency-Key is still being processed")
+			default:
+				replay(c, existing)
+			}
+			return
+		}
+
+		// The outcome is stored even when the client disconnects, which cancels the request context,
+		// as the client is then likely to retry and must not find the key in use until it expires
+		storeCtx := context.WithoutCancel(ctx)
+
+		// Free the key if a handler panics, the recovery middleware then responds with 500
+		defer func() {
+			if r := recover(); r != nil {
+				if err := repo.Release(storeCtx, key); err != nil {
+					log.Println(err.Error())
+				}
+				panic(r)
+			}
+		}()
+
+		recorder := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+		c.Next()
+
+		// Server errors are not stored so that the request can be retried
+		if recorder.Status() >= http.StatusInternalServerError {
+			if err := repo.Release(storeCtx, key); err != nil {
+				log.Println(err.Error())
+			}
+			return
+		}
+
+		headers := make(map[string]string)
+		for _, name := range replayedHeaders {
+			if value := recorder.Header().Get(name); value != "" {
+				headers[name] = value
+			}
+		}
+		encodedHeaders, _ := json.Marshal(headers)
+		if err := repo.Complete(storeCtx, key, recorder.Status(), string(encodedHeaders), recorder.body.Bytes()); err != nil {
+			log.Println(err.Error())
+		}
+	}
+}
+
+// requestFingerprint hashes everything that identifies a request, given its body or a description of a streamed one
+func requestFingerprint(r *http.Request, body []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(r.Method + " " + r.URL.RequestURI() + "\n"))
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// replay writes a stored response again, marking it with the Idempotent-Replayed header
+func replay(c *gin.Context, record *models.IdempotencyRecord) {
+	var headers map[string]string
+	if err := json.Unmarshal([]byte(record.Headers), &headers); err == nil {
+		for name, value := range headers {
+			c.Header(name, value)
+		}
+	}
+	c.Header("Idempotent-Replayed", "true")
+	c.Status(record.StatusCode)
+	c.Writer.Write(record.Body)
+	c.Abort()
+}
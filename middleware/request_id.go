@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"github.com/gin-gonic/gin"
+)
+
+// RequestIDHeader carries the ID identifying a request in responses and audit records
+const RequestIDHeader = "X-Request-ID"
+
+// RequestIDKey is the key of the request ID in the gin context
+const RequestIDKey = "request_id"
+
+// maxRequestIDLength is the longest request ID accepted from clients, matching the size of the database columns
+const maxRequestIDLength = 255
+
+// RequestID assigns every request an ID, reusing the one sent by the client or a proxy when there is one,
+// and returns it in the X-Request-ID response header
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(RequestIDHeader)
+		if id == "" || len(id) > maxRequestIDLength {
+			id = newRequestID()
+		}
+
+		c.Set(RequestIDKey, id)
+		c.Header(RequestIDHeader, id)
+		c.Next()
+	}
+}
+
+// newRequestID generates a random request ID
+func newRequestID() string {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		panic("failed to generate request ID: " + err.Error())
+	}
+	return hex.EncodeToString(id)
+}
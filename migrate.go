@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"products-api/database"
+	"products-api/migrations"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+const migrateUsage = "usage: products-api migrate up|down|status|to N"
+
+// runMigrateCommand implements the "migrate" subcommand
+func runMigrateCommand(args []string) {
+	if len(args) == 0 {
+		log.Fatal(migrateUsage)
+	}
+
+	ctx := context.Background()
+	migrator, err := migrations.New(database.ConnectDB())
+	if err != nil {
+		log.Fatal("Failed to load migrations:", err)
+	}
+
+	switch args[0] {
+	case "up":
+		err = migrator.Up(ctx)
+	case "down":
+		err = migrator.Down(ctx)
+	case "to":
+		if len(args) != 2 {
+			log.Fatal(migrateUsage)
+		}
+		version, parseErr := strconv.ParseUint(args[1], 10, 0)
+		if parseErr != nil {
+			log.Fatal("Invalid migration version, must be a non-negative integer")
+		}
+		err = migrator.To(ctx, uint(version))
+	case "status":
+		err = printMigrationStatus(ctx, migrator)
+	default:
+		log.Fatal(migrateUsage)
+	}
+
+	if err != nil {
+		log.Fatal("Migration failed: ", err)
+	}
+}
+
+// printMigrationStatus writes a table of all migrations and when they were applied
+func printMigrationStatus(ctx context.Context, migrator *migrations.Migrator) error {
+	statuses, err := migrator.Status(ctx)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "VERSION\tNAME\tSTATUS\tAPPLIED AT")
+	for _, status := range statuses {
+		state, appliedAt := "pending", ""
+		if status.Applied {
+			state, appliedAt = "applied", status.AppliedAt.Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", status.Version, status.Name, state, appliedAt)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"products-api/database"
+	"products-api/migrations"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMigrations(t *testing.T) {
+	ctx := context.Background()
+
+	db, err := database.Open(database.Config{Driver: database.DriverSQLite, Path: database.SQLiteInMemory})
+	require.NoError(t, err)
+
+	migrator, err := migrations.New(db)
+	require.NoError(t, err)
+
+	// Nothing is applied on a fresh database
+	pending, err := migrator.Pending(ctx)
+	require.NoError(t, err)
+	assert.Greater(t, pending, 0)
+
+	// Applying everything leaves nothing pending and creates the products table
+	require.NoError(t, migrator.Up(ctx))
+	pending, err = migrator.Pending(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, pending)
+	assert.True(t, db.Migrator().HasTable("products"))
+
+	// Running up again is a no-op
+	require.NoError(t, migrator.Up(ctx))
+
+	statuses, err := migrator.Status(ctx)
+	require.NoError(t, err)
+	for _, status := range statuses {
+		assert.True(t, status.Applied, "migration %d should be applied", status.Version)
+		assert.NotNil(t, status.AppliedAt)
+	}
+
+	// Reverting the latest migration marks it as pending again
+	require.NoError(t, migrator.Down(ctx))
+	pending, err = migrator.Pending(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 1, pending)
+
+	// Migrating to version 0 reverts everything
+	require.NoError(t, migrator.To(ctx, 0))
+	assert.False(t, db.Migrator().HasTable("products"))
+
+	// Unknown versions are rejected
+	assert.Error(t, migrator.To(ctx, migrator.Latest()+1))
+}
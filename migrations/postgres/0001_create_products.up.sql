@@ -0,0 +1,9 @@
+-- Existing deployments created this table with AutoMigrate, so keep it idempotent
+CREATE TABLE IF NOT EXISTS products (
+    id          BIGSERIAL PRIMARY KEY,
+    name        TEXT,
+    description TEXT,
+    price       DECIMAL,
+    created_at  TIMESTAMPTZ,
+    updated_at  TIMESTAMPTZ
+);
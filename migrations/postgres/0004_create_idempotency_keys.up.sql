@@ -0,0 +1,11 @@
+CREATE TABLE idempotency_keys (
+    idempotency_key VARCHAR(255) PRIMARY KEY,
+    fingerprint     VARCHAR(64) NOT NULL,
+    status_code     INTEGER NOT NULL DEFAULT 0,
+    headers         TEXT NOT NULL DEFAULT '',
+    body            BYTEA,
+    created_at      TIMESTAMPTZ NOT NULL,
+    expires_at      TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX idempotency_keys_expires_at_idx ON idempotency_keys (expires_at);
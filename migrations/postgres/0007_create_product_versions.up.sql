@@ -0,0 +1,13 @@
+CREATE TABLE product_versions (
+    product_id  BIGINT NOT NULL,
+    version     BIGINT NOT NULL,
+    name        TEXT,
+    description TEXT,
+    price       DECIMAL,
+    created_at  TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (product_id, version)
+);
+
+-- Start the history of existing products with their current state
+INSERT INTO product_versions (product_id, version, name, description, price, created_at)
+SELECT id, version, name, description, price, COALESCE(updated_at, CURRENT_TIMESTAMP) FROM products;
@@ -0,0 +1,3 @@
+DROP INDEX product_versions_valid_from_idx;
+ALTER TABLE product_versions DROP COLUMN valid_to;
+ALTER TABLE product_versions RENAME COLUMN valid_from TO created_at;
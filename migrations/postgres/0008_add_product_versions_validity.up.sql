@@ -0,0 +1,14 @@
+-- Each version is valid from the change that created it until the next change, deletion or purge
+ALTER TABLE product_versions RENAME COLUMN created_at TO valid_from;
+ALTER TABLE product_versions ADD COLUMN valid_to TIMESTAMPTZ;
+
+-- Close the versions that were superseded, then the current versions of products in the trash
+UPDATE product_versions SET valid_to = (
+    SELECT MIN(next.valid_from) FROM product_versions next
+    WHERE next.product_id = product_versions.product_id AND next.version > product_versions.version
+);
+UPDATE product_versions SET valid_to = (
+    SELECT deleted_at FROM products WHERE products.id = product_versions.product_id
+) WHERE valid_to IS NULL;
+
+CREATE INDEX product_versions_valid_from_idx ON product_versions (valid_from);
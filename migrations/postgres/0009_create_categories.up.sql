@@ -0,0 +1,24 @@
+-- Categories form a tree, path lists the IDs from the root down to the category, such as /1/4/,
+-- so that the descendants of a category are the rows whose path starts with its own
+CREATE TABLE categories (
+    id          BIGSERIAL PRIMARY KEY,
+    name        TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    parent_id   BIGINT,
+    path        TEXT NOT NULL DEFAULT '',
+    created_at  TIMESTAMPTZ NOT NULL,
+    updated_at  TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX categories_parent_id_idx ON categories (parent_id);
+-- text_pattern_ops lets prefix matches with LIKE use the index whatever the collation
+CREATE INDEX categories_path_idx ON categories (path text_pattern_ops);
+
+CREATE TABLE product_categories (
+    product_id  BIGINT NOT NULL,
+    category_id BIGINT NOT NULL,
+    created_at  TIMESTAMPTZ NOT NULL,
+    PRIMARY KEY (product_id, category_id)
+);
+
+CREATE INDEX product_categories_category_id_idx ON product_categories (category_id);
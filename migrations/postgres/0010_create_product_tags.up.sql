@@ -0,0 +1,8 @@
+-- Tags are stored normalized, lowercase with single spaces, see models.NormalizeTags
+CREATE TABLE product_tags (
+    product_id  BIGINT NOT NULL,
+    tag         VARCHAR(50) NOT NULL,
+    PRIMARY KEY (product_id, tag)
+);
+
+CREATE INDEX product_tags_tag_idx ON product_tags (tag);
@@ -0,0 +1,14 @@
+-- Options are stored as a JSON object with sorted keys, so that equal combinations are equal strings
+CREATE TABLE product_variants (
+    id          BIGSERIAL PRIMARY KEY,
+    product_id  BIGINT NOT NULL,
+    sku         VARCHAR(64) NOT NULL,
+    options     TEXT NOT NULL,
+    price       DECIMAL,
+    attributes  JSONB NOT NULL DEFAULT '{}',
+    created_at  TIMESTAMPTZ NOT NULL,
+    updated_at  TIMESTAMPTZ NOT NULL
+);
+
+CREATE UNIQUE INDEX product_variants_sku_idx ON product_variants (sku);
+CREATE UNIQUE INDEX product_variants_options_idx ON product_variants (product_id, options);
@@ -0,0 +1,16 @@
+ALTER TABLE products ADD COLUMN type VARCHAR(50) NOT NULL DEFAULT '';
+ALTER TABLE products ADD COLUMN attributes JSONB NOT NULL DEFAULT '{}';
+CREATE INDEX products_type_idx ON products (type);
+
+-- Every schema applies either to a product type or to a category, and every type or category has at most one schema
+CREATE TABLE attribute_schemas (
+    id           BIGSERIAL PRIMARY KEY,
+    product_type VARCHAR(50),
+    category_id  BIGINT,
+    attributes   JSONB NOT NULL,
+    created_at   TIMESTAMPTZ NOT NULL,
+    updated_at   TIMESTAMPTZ NOT NULL
+);
+
+CREATE UNIQUE INDEX attribute_schemas_product_type_idx ON attribute_schemas (product_type);
+CREATE UNIQUE INDEX attribute_schemas_category_id_idx ON attribute_schemas (category_id);
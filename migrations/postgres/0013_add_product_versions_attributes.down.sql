@@ -0,0 +1,2 @@
+ALTER TABLE product_versions DROP COLUMN attributes;
+ALTER TABLE product_versions DROP COLUMN type;
@@ -0,0 +1,6 @@
+ALTER TABLE product_versions ADD COLUMN type VARCHAR(50) NOT NULL DEFAULT '';
+ALTER TABLE product_versions ADD COLUMN attributes JSONB NOT NULL DEFAULT '{}';
+
+-- Earlier versions did not snapshot them, so they take the current values that as_of reads returned until now
+UPDATE product_versions SET type = products.type, attributes = products.attributes
+FROM products WHERE products.id = product_versions.product_id;
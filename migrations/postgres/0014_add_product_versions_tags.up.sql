@@ -0,0 +1,6 @@
+ALTER TABLE product_versions ADD COLUMN tags JSONB NOT NULL DEFAULT '[]';
+
+-- Earlier versions did not snapshot them, so they take the current tags that as_of reads returned until now
+UPDATE product_versions SET tags = tagged.tags
+FROM (SELECT product_id, jsonb_agg(tag ORDER BY tag) AS tags FROM product_tags GROUP BY product_id) AS tagged
+WHERE tagged.product_id = product_versions.product_id;
@@ -0,0 +1 @@
+-- The versions closed by the up migration cannot be told apart from the others, so they stay closed
@@ -0,0 +1,3 @@
+-- Keys of different actors may collide once unscoped, drop the stored responses instead
+DELETE FROM idempotency_keys;
+ALTER TABLE idempotency_keys ALTER COLUMN idempotency_key TYPE VARCHAR(255);
@@ -0,0 +1,5 @@
+-- Keys are now prefixed with the actor and the separator, each at most 255 characters long
+ALTER TABLE idempotency_keys ALTER COLUMN idempotency_key TYPE VARCHAR(511);
+
+-- The stored keys were sent without an X-Actor header or before it existed
+UPDATE idempotency_keys SET idempotency_key = 'anonymous:' || idempotency_key;
@@ -0,0 +1,9 @@
+-- Existing deployments created this table with AutoMigrate, so keep it idempotent
+CREATE TABLE IF NOT EXISTS products (
+    id          INTEGER PRIMARY KEY AUTOINCREMENT,
+    name        TEXT,
+    description TEXT,
+    price       REAL,
+    created_at  DATETIME,
+    updated_at  DATETIME
+);
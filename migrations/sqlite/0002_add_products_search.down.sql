@@ -0,0 +1,2 @@
+-- SQLite has no tsvector, product search ranks LIKE matches in the application instead
+SELECT 1;
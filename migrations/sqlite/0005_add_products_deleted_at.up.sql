@@ -0,0 +1,2 @@
+ALTER TABLE products ADD COLUMN deleted_at DATETIME;
+CREATE INDEX products_deleted_at_idx ON products (deleted_at);
@@ -0,0 +1,14 @@
+-- Append-only, rows are never updated or deleted, not even when their product is purged
+CREATE TABLE audit_log (
+    id          INTEGER PRIMARY KEY AUTOINCREMENT,
+    product_id  INTEGER NOT NULL,
+    action      VARCHAR(16) NOT NULL,
+    actor       VARCHAR(255) NOT NULL,
+    request_id  VARCHAR(255) NOT NULL DEFAULT '',
+    version     INTEGER NOT NULL,
+    changes     TEXT NOT NULL,
+    created_at  DATETIME NOT NULL
+);
+
+CREATE INDEX audit_log_product_id_idx ON audit_log (product_id);
+CREATE INDEX audit_log_created_at_idx ON audit_log (created_at);
@@ -0,0 +1,23 @@
+-- Categories form a tree, path lists the IDs from the root down to the category, such as /1/4/,
+-- so that the descendants of a category are the rows whose path starts with its own
+CREATE TABLE categories (
+    id          INTEGER PRIMARY KEY AUTOINCREMENT,
+    name        TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    parent_id   INTEGER,
+    path        TEXT NOT NULL DEFAULT '',
+    created_at  DATETIME NOT NULL,
+    updated_at  DATETIME NOT NULL
+);
+
+CREATE INDEX categories_parent_id_idx ON categories (parent_id);
+CREATE INDEX categories_path_idx ON categories (path);
+
+CREATE TABLE product_categories (
+    product_id  INTEGER NOT NULL,
+    category_id INTEGER NOT NULL,
+    created_at  DATETIME NOT NULL,
+    PRIMARY KEY (product_id, category_id)
+);
+
+CREATE INDEX product_categories_category_id_idx ON product_categories (category_id);
@@ -0,0 +1,14 @@
+-- Options are stored as a JSON object with sorted keys, so that equal combinations are equal strings
+CREATE TABLE product_variants (
+    id          INTEGER PRIMARY KEY AUTOINCREMENT,
+    product_id  INTEGER NOT NULL,
+    sku         TEXT NOT NULL,
+    options     TEXT NOT NULL,
+    price       REAL,
+    attributes  TEXT NOT NULL DEFAULT '{}',
+    created_at  DATETIME NOT NULL,
+    updated_at  DATETIME NOT NULL
+);
+
+CREATE UNIQUE INDEX product_variants_sku_idx ON product_variants (sku);
+CREATE UNIQUE INDEX product_variants_options_idx ON product_variants (product_id, options);
@@ -0,0 +1,4 @@
+DROP TABLE IF EXISTS attribute_schemas;
+DROP INDEX products_type_idx;
+ALTER TABLE products DROP COLUMN attributes;
+ALTER TABLE products DROP COLUMN type;
@@ -0,0 +1,16 @@
+ALTER TABLE products ADD COLUMN type TEXT NOT NULL DEFAULT '';
+ALTER TABLE products ADD COLUMN attributes TEXT NOT NULL DEFAULT '{}';
+CREATE INDEX products_type_idx ON products (type);
+
+-- Every schema applies either to a product type or to a category, and every type or category has at most one schema
+CREATE TABLE attribute_schemas (
+    id           INTEGER PRIMARY KEY AUTOINCREMENT,
+    product_type TEXT,
+    category_id  INTEGER,
+    attributes   TEXT NOT NULL,
+    created_at   DATETIME NOT NULL,
+    updated_at   DATETIME NOT NULL
+);
+
+CREATE UNIQUE INDEX attribute_schemas_product_type_idx ON attribute_schemas (product_type);
+CREATE UNIQUE INDEX attribute_schemas_category_id_idx ON attribute_schemas (category_id);
@@ -0,0 +1,7 @@
+ALTER TABLE product_versions ADD COLUMN type TEXT NOT NULL DEFAULT '';
+ALTER TABLE product_versions ADD COLUMN attributes TEXT NOT NULL DEFAULT '{}';
+
+-- Earlier versions did not snapshot them, so they take the current values that as_of reads returned until now
+UPDATE product_versions SET
+    type = COALESCE((SELECT type FROM products WHERE products.id = product_versions.product_id), ''),
+    attributes = COALESCE((SELECT attributes FROM products WHERE products.id = product_versions.product_id), '{}');
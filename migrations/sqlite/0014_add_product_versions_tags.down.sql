@@ -0,0 +1 @@
+ALTER TABLE product_versions DROP COLUMN tags;
@@ -0,0 +1,8 @@
+ALTER TABLE product_versions ADD COLUMN tags TEXT NOT NULL DEFAULT '[]';
+
+-- Earlier versions did not snapshot them, so they take the current tags that as_of reads returned until now
+UPDATE product_versions SET tags = (
+    SELECT json_group_array(tag) FROM (
+        SELECT tag FROM product_tags WHERE product_tags.product_id = product_versions.product_id ORDER BY tag
+    )
+);
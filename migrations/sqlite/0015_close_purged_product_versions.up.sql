@@ -0,0 +1,5 @@
+-- Migration 0008 left the versions of the products purged before it open, close them at their purge
+UPDATE product_versions SET valid_to = (
+    SELECT MAX(created_at) FROM audit_log
+    WHERE audit_log.product_id = product_versions.product_id AND audit_log.action = 'purge'
+) WHERE valid_to IS NULL AND product_id NOT IN (SELECT id FROM products);
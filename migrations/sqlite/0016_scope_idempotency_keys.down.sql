@@ -0,0 +1,2 @@
+-- Keys of different actors may collide once unscoped, drop the stored responses instead
+DELETE FROM idempotency_keys;
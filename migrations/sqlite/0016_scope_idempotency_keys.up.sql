@@ -0,0 +1,2 @@
+-- Keys are now prefixed with the actor, the stored ones were sent without an X-Actor header or before it existed
+UPDATE idempotency_keys SET idempotency_key = 'anonymous:' || idempotency_key;
@@ -0,0 +1,86 @@
+package models
+
+import (
+	"math"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Types of the attributes described by an AttributeDefinition
+const (
+	AttributeTypeString  = "string"
+	AttributeTypeNumber  = "number"
+	AttributeTypeInteger = "integer"
+	AttributeTypeBoolean = "boolean"
+)
+
+// attributeNamePattern matches the names of product attributes, which are used as JSON keys and in query parameters
+var attributeNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// ValidAttributeName reports whether the name can be used for a product attribute:
+// a lowercase letter followed by lowercase letters, digits and underscores
+func ValidAttributeName(name string) bool {
+	return len(name) <= 50 && attributeNamePattern.MatchString(name)
+}
+
+// AttributeSchema describes the attributes of the products of a type, or of the products in a category
+// and all its descendants, exactly one of ProductType and CategoryID being set
+type AttributeSchema struct {
+	ID          uint                  `json:"id" gorm:"primaryKey"`
+	ProductType *string               `json:"product_type"`
+	CategoryID  *uint                 `json:"category_id"`
+	Attributes  []AttributeDefinition `json:"attributes" gorm:"serializer:json"`
+	CreatedAt   time.Time             `json:"created_at"`
+	UpdatedAt   time.Time             `json:"updated_at"`
+}
+
+// AttributeDefinition describes an attribute of an AttributeSchema
+type AttributeDefinition struct {
+	Name     string   `json:"name" binding:"required,max=50"`
+	Type     string   `json:"type" binding:"required,oneof=string number integer boolean"`
+	Required bool     `json:"required"`
+	Values   []string `json:"values,omitempty" binding:"omitempty,min=1"` // Allowed values of a string attribute
+	Min      *float64 `json:"min,omitempty"`                              // Smallest value of a numeric attribute
+	Max      *float64 `json:"max,omitempty"`                              // Largest value of a numeric attribute
+}
+
+// Check returns the validation rule the value of the attribute breaks, nil being a missing value,
+// with the parameter of the rule, or an empty rule when the value is valid
+func (d AttributeDefinition) Check(value interface{}) (rule, param string) {
+	if value == nil {
+		if d.Required {
+			return "required", ""
+		}
+		return "", ""
+	}
+
+	switch d.Type {
+	case AttributeTypeString:
+		s, ok := value.(string)
+		if !ok {
+			return "type", d.Type
+		}
+		if d.Values != nil && !slices.Contains(d.Values, s) {
+			return "oneof", strings.Join(d.Values, " ")
+		}
+	case AttributeTypeBoolean:
+		if _, ok := value.(bool); !ok {
+			return "type", d.Type
+		}
+	case AttributeTypeNumber, AttributeTypeInteger:
+		n, ok := value.(float64)
+		if !ok || (d.Type == AttributeTypeInteger && n != math.Trunc(n)) {
+			return "type", d.Type
+		}
+		if d.Min != nil && n < *d.Min {
+			return "gte", strconv.FormatFloat(*d.Min, 'f', -1, 64)
+		}
+		if d.Max != nil && n > *d.Max {
+			return "lte", strconv.FormatFloat(*d.Max, 'f', -1, 64)
+		}
+	}
+	return "", ""
+}
@@ -0,0 +1,68 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Audited product actions
+const (
+	AuditActionCreate  = "create"
+	AuditActionUpdate  = "update"
+	AuditActionDelete  = "delete"
+	AuditActionRestore = "restore"
+	AuditActionPurge   = "purge"
+)
+
+// AuditActions lists every audited product action
+var AuditActions = []string{AuditActionCreate, AuditActionUpdate, AuditActionDelete, AuditActionRestore, AuditActionPurge}
+
+// AuditRecord is an immutable entry of the audit log describing a single change to a product
+type AuditRecord struct {
+	ID        uint         `json:"id" gorm:"primaryKey"`
+	ProductID uint         `json:"product_id"`
+	Action    string       `json:"action"`
+	Actor     string       `json:"actor"`
+	RequestID string       `json:"request_id"`
+	Version   uint         `json:"version"` // Version of the product after the change, or before it for purges
+	Changes   AuditChanges `json:"changes"`
+	CreatedAt time.Time    `json:"created_at"`
+}
+
+// TableName overrides the table name used by AuditRecord
+func (AuditRecord) TableName() string {
+	return "audit_log"
+}
+
+// AuditChange holds the values of a field before and after a change, nil when the field did not exist
+type AuditChange struct {
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// AuditChanges maps the JSON names of the changed fields to their change, stored as a JSON document
+type AuditChanges map[string]AuditChange
+
+func (c AuditChanges) Value() (driver.Value, error) {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+func (c *AuditChanges) Scan(value interface{}) error {
+	switch data := value.(type) {
+	case []byte:
+		return json.Unmarshal(data, c)
+	case string:
+		return json.Unmarshal([]byte(data), c)
+	case nil:
+		*c = nil
+		return nil
+	default:
+		return fmt.Errorf("cannot scan %T into AuditChanges", value)
+	}
+}
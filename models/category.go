@@ -0,0 +1,50 @@
+package models
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Category classifies products in a tree, where every category but the roots has a parent
+type Category struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	ParentID    *uint     `json:"parent_id"` // Nil for root categories
+	Path        string    `json:"path"`      // IDs from the root down to the category, such as /1/4/
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// CategoryPath returns the path of a category with the given ID below the given parent, or at the root if nil
+func CategoryPath(parent *Category, id uint) string {
+	path := "/"
+	if parent != nil {
+		path = parent.Path
+	}
+	return path + strconv.FormatUint(uint64(id), 10) + "/"
+}
+
+// IsDescendantOf reports whether the category is the given category or one of its descendants
+func (c Category) IsDescendantOf(ancestor Category) bool {
+	return strings.HasPrefix(c.Path, ancestor.Path)
+}
+
+// PathIDs returns the IDs of the ancestors of the category, from the root down, followed by its own ID
+func (c Category) PathIDs() []uint {
+	var ids []uint
+	for _, idStr := range strings.Split(strings.Trim(c.Path, "/"), "/") {
+		if id, err := strconv.ParseUint(idStr, 10, 0); err == nil {
+			ids = append(ids, uint(id))
+		}
+	}
+	return ids
+}
+
+// ProductCategory links a product to one of its categories
+type ProductCategory struct {
+	ProductID  uint      `gorm:"primaryKey;autoIncrement:false"`
+	CategoryID uint      `gorm:"primaryKey;autoIncrement:false"`
+	CreatedAt  time.Time // When the product was added to the category
+}
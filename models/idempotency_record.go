@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// IdempotencyRecord stores the outcome of a request sent with an Idempotency-Key header
+type IdempotencyRecord struct {
+	Key         string `gorm:"column:idempotency_key;primaryKey"`
+	Fingerprint string // Hash of the method, URL and body of the request
+	StatusCode  int    // Zero while the request is still being processed
+	Headers     string // JSON object of the response headers to replay
+	Body        []byte // Response body to replay
+	CreatedAt   time.Time
+	ExpiresAt   time.Time
+}
+
+// TableName overrides the table name used by IdempotencyRecord
+func (IdempotencyRecord) TableName() string {
+	return "idempotency_keys"
+}
@@ -1,12 +1,25 @@
 package models
 
-import "time"
+import (
+	"gorm.io/gorm"
+	"time"
+)
 
 type Product struct {
-	ID          uint      `json:"id" gorm:"primaryKey"`
-	Name        string    `json:"name" binding:"required"`
-	Description string    `json:"description"`
-	Price       float64   `json:"price" binding:"required,gte=0"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	ID          uint           `json:"id" gorm:"primaryKey"`
+	Name        string         `json:"name" binding:"required"`
+	Description string         `json:"description"`
+	Price       float64        `json:"price" binding:"required,gte=0"`
+	Version     uint           `json:"version" gorm:"not null;default:1"` // Incremented on every update for optimistic locking
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+	DeletedAt   gorm.DeletedAt `json:"deleted_at"` // Set while the product is in the trash
+
+	// At most MaxProductTags labels, normalized with NormalizeTags and stored in product_tags, without commas
+	Tags []string `json:"tags" gorm:"-" binding:"max=20,dive,required,max=50,excludes=0x2C"`
+
+	// Selects the attribute schema of the product type, see AttributeSchema
+	Type string `json:"type" binding:"max=50"`
+	// Values of the attributes named with ValidAttributeName, checked against the schemas of the type and categories
+	Attributes map[string]interface{} `json:"attributes" gorm:"serializer:json"`
 }
@@ -0,0 +1,37 @@
+package models
+
+import "time"
+
+// ProductVersion is a snapshot of the fields of a product at one of its versions
+type ProductVersion struct {
+	ProductID   uint                   `json:"product_id" gorm:"primaryKey;autoIncrement:false"`
+	Version     uint                   `json:"version" gorm:"primaryKey;autoIncrement:false"`
+	Name        string                 `json:"name"`
+	Description string                 `json:"description"`
+	Price       float64                `json:"price"`
+	Tags        []string               `json:"tags" gorm:"serializer:json"` // Normalized like the tags of the product
+	Type        string                 `json:"type"`
+	Attributes  map[string]interface{} `json:"attributes" gorm:"serializer:json"`
+	ValidFrom   time.Time              `json:"valid_from"` // When the product reached this version
+	ValidTo     *time.Time             `json:"valid_to"`   // When the version was superseded, deleted or purged, nil while it is current
+}
+
+// Product returns the product as it was at this version
+func (v ProductVersion) Product() Product {
+	return Product{
+		ID:          v.ProductID,
+		Name:        v.Name,
+		Description: v.Description,
+		Price:       v.Price,
+		Tags:        v.Tags,
+		Type:        v.Type,
+		Attributes:  v.Attributes,
+		Version:     v.Version,
+		UpdatedAt:   v.ValidFrom,
+	}
+}
+
+// ValidAt reports whether the product was at this version at the given time
+func (v ProductVersion) ValidAt(t time.Time) bool {
+	return !v.ValidFrom.After(t) && (v.ValidTo == nil || v.ValidTo.After(t))
+}
@@ -0,0 +1,29 @@
+package models
+
+import (
+	"slices"
+	"strings"
+)
+
+// MaxProductTags is the maximum number of tags of a product
+const MaxProductTags = 20
+
+// ProductTag gives a tag to a product
+type ProductTag struct {
+	ProductID uint   `gorm:"primaryKey;autoIncrement:false"`
+	Tag       string `gorm:"primaryKey"`
+}
+
+// NormalizeTags lowercases the tags and collapses their spaces, dropping the empty and repeated ones,
+// and sorts them so that equal sets of tags are equal slices
+func NormalizeTags(tags []string) []string {
+	normalized := []string{}
+	for _, tag := range tags {
+		tag = strings.Join(strings.Fields(strings.ToLower(tag)), " ")
+		if tag != "" && !slices.Contains(normalized, tag) {
+			normalized = append(normalized, tag)
+		}
+	}
+	slices.Sort(normalized)
+	return normalized
+}
@@ -0,0 +1,41 @@
+package models
+
+import (
+	"maps"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Variant is a sellable version of a product, such as a size and colour, identified by its own SKU
+type Variant struct {
+	ID         uint                   `json:"id" gorm:"primaryKey"`
+	ProductID  uint                   `json:"product_id"`
+	SKU        string                 `json:"sku" gorm:"column:sku"`
+	Options    map[string]string      `json:"options" gorm:"serializer:json"`    // Value of every option axis, normalized with NormalizeOptions
+	Price      *float64               `json:"price"`                             // Overrides the product price when set
+	Attributes map[string]interface{} `json:"attributes" gorm:"serializer:json"` // Free-form details, such as a barcode or weight
+	CreatedAt  time.Time              `json:"created_at"`
+	UpdatedAt  time.Time              `json:"updated_at"`
+}
+
+// TableName overrides the table name used by Variant
+func (Variant) TableName() string {
+	return "product_variants"
+}
+
+// Axes returns the sorted names of the option axes of the variant
+func (v Variant) Axes() []string {
+	return slices.Sorted(maps.Keys(v.Options))
+}
+
+// NormalizeOptions lowercases the axis names and collapses the spaces of the axis names and values,
+// so that " Size " and "size" are the same axis
+func NormalizeOptions(options map[string]string) map[string]string {
+	normalized := make(map[string]string, len(options))
+	for axis, value := range options {
+		axis = strings.Join(strings.Fields(strings.ToLower(axis)), " ")
+		normalized[axis] = strings.Join(strings.Fields(value), " ")
+	}
+	return normalized
+}
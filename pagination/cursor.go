@@ -0,0 +1,112 @@
+package pagination
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"products-api/models"
+	"strings"
+	"time"
+)
+
+// ErrInvalidCursor is returned when a cursor is malformed or its signature does not match
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Cursor marks a position in a sorted product list
+type Cursor struct {
+	Sort     string         // Canonical sort expression the cursor was issued for
+	Backward bool           // Whether the cursor points to the page before the key
+	Key      models.Product // Boundary product, only the sort fields are meaningful
+}
+
+// cursorPayload is the serialized form of a Cursor, kept short since it travels in URLs
+type cursorPayload struct {
+	Sort      string    `json:"s"`
+	Backward  bool      `json:"b,omitempty"`
+	ID        uint      `json:"i"`
+	Name      string    `json:"n"`
+	Price     float64   `json:"p"`
+	CreatedAt time.Time `json:"c"`
+	UpdatedAt time.Time `json:"u"`
+}
+
+// CursorCodec encodes cursors into opaque tokens signed with HMAC-SHA256
+type CursorCodec struct {
+	key []byte
+}
+
+// NewCursorCodec creates a CursorCodec signing with the given key, or with a random key when it is empty
+func NewCursorCodec(key []byte) *CursorCodec {
+	if len(key) == 0 {
+		key = make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			panic("failed to generate cursor signing key: " + err.Error())
+		}
+	}
+	return &CursorCodec{key: key}
+}
+
+// Encode serializes and signs the cursor
+func (cc *CursorCodec) Encode(cursor Cursor) string {
+	payload := cursorPayload{
+		Sort:      cursor.Sort,
+		Backward:  cursor.Backward,
+		ID:        cursor.Key.ID,
+		Name:      cursor.Key.Name,
+		Price:     cursor.Key.Price,
+		CreatedAt: cursor.Key.CreatedAt,
+		UpdatedAt: cursor.Key.UpdatedAt,
+	}
+
+	// Marshalling a struct of basic types cannot fail
+	data, _ := json.Marshal(payload)
+	encoded := base64.RawURLEncoding.EncodeToString(data)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(cc.sign(encoded))
+}
+
+// Decode verifies the signature of the token and returns the cursor it encodes
+func (cc *CursorCodec) Decode(token string) (Cursor, error) {
+	encoded, signature, found := strings.Cut(token, ".")
+	if !found {
+		return Cursor{}, ErrInvalidCursor
+	}
+
+	providedSignature, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(providedSignature, cc.sign(encoded)) {
+		return Cursor{}, ErrInvalidCursor
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+
+	var payload cursorPayload
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&payload); err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+
+	return Cursor{
+		Sort:     payload.Sort,
+		Backward: payload.Backward,
+		Key: models.Product{
+			ID:        payload.ID,
+			Name:      payload.Name,
+			Price:     payload.Price,
+			CreatedAt: payload.CreatedAt,
+			UpdatedAt: payload.UpdatedAt,
+		},
+	}, nil
+}
+
+func (cc *CursorCodec) sign(data string) []byte {
+	mac := hmac.New(sha256.New, cc.key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
@@ -0,0 +1,109 @@
+package problem
+
+import (
+	"embed"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultLanguage is used when the client accepts none of the supported languages
+const DefaultLanguage = "en"
+
+//go:embed locales/*.json
+var catalogFiles embed.FS
+
+// catalog holds the validation messages of a language, where {field} and {param} are replaced
+// by the field path and the parameter of the rule
+type catalog struct {
+	Rules map[string]string `json:"rules"` // Messages by rule, with "invalid" for rules without a message
+	Types map[string]string `json:"types"` // Names of the JSON types, used as parameter of the type rule
+	Value string            `json:"value"` // Replaces the field path when the whole value is invalid
+}
+
+// catalogs maps the supported languages to their messages, loaded from the locales directory
+var catalogs = loadCatalogs()
+
+// loadCatalogs parses the embedded message catalogs, named after their language
+func loadCatalogs() map[string]catalog {
+	files, err := catalogFiles.ReadDir("locales")
+	if err != nil {
+		panic("failed to read the message catalogs: " + err.Error())
+	}
+
+	catalogs := make(map[string]catalog, len(files))
+	for _, file := range files {
+		data, err := catalogFiles.ReadFile(path.Join("locales", file.Name()))
+		if err != nil {
+			panic("failed to read the message catalog " + file.Name() + ": " + err.Error())
+		}
+		var messages catalog
+		if err := json.Unmarshal(data, &messages); err != nil {
+			panic("invalid message catalog " + file.Name() + ": " + err.Error())
+		}
+		catalogs[strings.TrimSuffix(file.Name(), path.Ext(file.Name()))] = messages
+	}
+	return catalogs
+}
+
+// Language picks the supported language the client prefers according to its Accept-Language header,
+// matching only the primary language so that de-CH selects de
+func Language(c *gin.Context) string {
+	type preference struct {
+		language string
+		quality  float64
+	}
+
+	var preferences []preference
+	for _, entry := range strings.Split(c.GetHeader("Accept-Language"), ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(entry), ";")
+		quality := 1.0
+		if value, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+			quality = parsed
+		}
+		language, _, _ := strings.Cut(strings.ToLower(strings.TrimSpace(tag)), "-")
+		if language != "" && quality > 0 {
+			preferences = append(preferences, preference{language, quality})
+		}
+	}
+
+	// Keep the order of the header between languages of the same quality
+	sort.SliceStable(preferences, func(i, j int) bool { return preferences[i].quality > preferences[j].quality })
+	for _, preference := range preferences {
+		if _, ok := catalogs[preference.language]; ok {
+			return preference.language
+		}
+		if preference.language == "*" {
+			return DefaultLanguage
+		}
+	}
+	return DefaultLanguage
+}
+
+// message renders the message of a field that failed a rule in the given language,
+// falling back to the default language for unsupported languages
+func message(language, field, rule, param string) string {
+	messages, ok := catalogs[language]
+	if !ok {
+		messages = catalogs[DefaultLanguage]
+	}
+
+	template, ok := messages.Rules[rule]
+	if !ok {
+		template = messages.Rules["invalid"]
+	}
+	if field == "" {
+		field = messages.Value
+	}
+	if rule == "type" {
+		param = messages.Types[param]
+	}
+	return strings.NewReplacer("{field}", field, "{param}", param).Replace(template)
+}
@@ -0,0 +1,121 @@
+package problem
+
+import (
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// ContentType is the media type of problem responses
+const ContentType = "application/problem+json"
+
+// requestIDKey is the key under which middleware.RequestID stores the request ID in the gin context,
+// repeated here since the middleware reports its own problems
+const requestIDKey = "request_id"
+
+// Stable machine-readable codes identifying the kind of a problem, clients can rely on them unlike on the detail
+const (
+	CodeInvalidJSON             = "invalid_json"               // The body is not valid JSON
+	CodeValidationFailed        = "validation_failed"          // Some fields of the body are invalid, see errors
+	CodeInvalidBody             = "invalid_body"               // The body is well-formed but cannot be processed as a whole
+	CodeInvalidCSV              = "invalid_csv"                // The imported CSV file is malformed
+	CodeBodyTooLarge            = "body_too_large"             // The body exceeds the size the request accepts
+	CodeInvalidParameter        = "invalid_parameter"          // A path or query parameter is invalid
+	CodeInvalidHeader           = "invalid_header"             // A request header is invalid
+	CodeTooManyItems            = "too_many_items"             // A bulk request exceeds the maximum number of items
+	CodeUnsupportedMediaType    = "unsupported_media_type"     // The body has an unsupported content type
+	CodeProductNotFound         = "product_not_found"          // The product does not exist, or not in the requested state
+	CodeVersionNotFound         = "version_not_found"          // The product version does not exist
+	CodeCategoryNotFound        = "category_not_found"         // The category does not exist
+	CodeCategoryNotEmpty        = "category_not_empty"         // The category cannot be deleted while it has subcategories
+	CodeTagNotFound             = "tag_not_found"              // The product does not have the tag
+	CodeVariantNotFound         = "variant_not_found"          // The product does not have the variant
+	CodeAttributeSchemaNotFound = "attribute_schema_not_found" // The attribute schema does not exist
+	CodePreconditionRequired    = "precondition_required"      // The request must carry an If-Match header
+	CodePreconditionFailed      = "precondition_failed"        // The If-Match header does not match the current version
+	CodeVersionConflict         = "version_conflict"           // The product changed while the request was processed
+	CodeIdempotencyKeyReused    = "idempotency_key_reused"     // The Idempotency-Key was used for a different request
+	CodeIdempotencyKeyInUse     = "idempotency_key_in_use"     // A request with the same Idempotency-Key is still processed
+	CodeInternalError           = "internal_error"             // The server failed, the request can be retried
+)
+
+// Problem is the body of every error response, following RFC 7807 with the code, request ID
+// and field errors as extension members
+type Problem struct {
+	Type      string       `json:"type"`
+	Title     string       `json:"title"`
+	Status    int          `json:"status"`
+	Code      string       `json:"code"`
+	Detail    string       `json:"detail,omitempty"`
+	Instance  string       `json:"instance,omitempty"`
+	RequestID string       `json:"request_id,omitempty"`
+	Errors    []FieldError `json:"errors,omitempty"`
+
+	extensions map[string]interface{}
+}
+
+// New creates a problem with the given status, code and human-readable detail
+func New(status int, code, detail string) *Problem {
+	return &Problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Code:   code,
+		Detail: detail,
+	}
+}
+
+// With adds an extension member to the problem, such as the IDs of the products that were not found
+func (p *Problem) With(name string, value interface{}) *Problem {
+	if p.extensions == nil {
+		p.extensions = make(map[string]interface{})
+	}
+	p.extensions[name] = value
+	return p
+}
+
+// MarshalJSON adds the extension members to the standard members of the problem
+func (p *Problem) MarshalJSON() ([]byte, error) {
+	type problem Problem
+	data, err := json.Marshal((*problem)(p))
+	if err != nil || len(p.extensions) == 0 {
+		return data, err
+	}
+
+	members := make(map[string]interface{}, len(p.extensions))
+	if err := json.Unmarshal(data, &members); err != nil {
+		return nil, err
+	}
+	for name, value := range p.extensions {
+		if _, exists := members[name]; !exists {
+			members[name] = value
+		}
+	}
+	return json.Marshal(members)
+}
+
+// Send writes the problem as the response, identifying the request it occurred in,
+// with the messages of the field errors in the language preferred by the client
+func Send(c *gin.Context, p *Problem) {
+	p.Instance = c.Request.URL.Path
+	p.RequestID = c.GetString(requestIDKey)
+	if p.Errors != nil {
+		language := Language(c)
+		p.Errors = Localize(p.Errors, language)
+		c.Header("Content-Language", language)
+		c.Header("Vary", "Accept-Language")
+	}
+	c.Header("Content-Type", ContentType)
+	c.JSON(p.Status, p)
+}
+
+// Respond writes a problem with the given status, code and detail as the response
+func Respond(c *gin.Context, status int, code, detail string) {
+	Send(c, New(status, code, detail))
+}
+
+// Abort writes a problem with the given status, code and detail as the response and stops the handler chain
+func Abort(c *gin.Context, status int, code, detail string) {
+	Respond(c, status, code, detail)
+	c.Abort()
+}
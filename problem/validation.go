@@ -0,0 +1,135 @@
+package problem
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+)
+
+// FieldError describes why the value of a single field was rejected
+type FieldError struct {
+	Field   string `json:"field"`   // Path of the field in the JSON body, such as name or items[0].price
+	Rule    string `json:"rule"`    // Validation rule that failed, such as required or gte
+	Message string `json:"message"` // Human-readable explanation, in the language of the client
+
+	param string // Parameter of the rule, kept to translate the message
+}
+
+// ValidationError is an error made of field errors, for rules that binding tags cannot express
+type ValidationError []FieldError
+
+func (e ValidationError) Error() string {
+	messages := make([]string, len(e))
+	for i, fieldError := range e {
+		messages[i] = fieldError.Message
+	}
+	return strings.Join(messages, "; ")
+}
+
+// NewFieldError creates the error of a field that failed the given rule, with the parameter of the rule if any.
+// The parameter of the type rule is the name of the expected JSON type, such as number or string
+func NewFieldError(field, rule, param string) FieldError {
+	return FieldError{Field: field, Rule: rule, Message: message(DefaultLanguage, field, rule, param), param: param}
+}
+
+// Localize returns the field errors with their messages in the given language
+func Localize(fieldErrors []FieldError, language string) []FieldError {
+	if fieldErrors == nil {
+		return nil
+	}
+	localized := make([]FieldError, len(fieldErrors))
+	for i, fieldError := range fieldErrors {
+		localized[i] = fieldError
+		localized[i].Message = message(language, fieldError.Field, fieldError.Rule, fieldError.param)
+	}
+	return localized
+}
+
+func init() {
+	// Name the fields in validation errors after their JSON keys, as clients know them
+	if validate, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		validate.RegisterTagNameFunc(func(field reflect.StructField) string {
+			name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if name == "" || name == "-" {
+				return field.Name
+			}
+			return name
+		})
+	}
+}
+
+// FieldErrors returns the field errors of a validation or JSON type error, or nil for other errors
+func FieldErrors(err error) []FieldError {
+	var validationErrors validator.ValidationErrors
+	var validationError ValidationError
+	var typeError *json.UnmarshalTypeError
+
+	switch {
+	case errors.As(err, &validationErrors):
+		fieldErrors := make([]FieldError, len(validationErrors))
+		for i, fieldError := range validationErrors {
+			// Drop the name of the validated struct from the path, which is why it must be of a named type
+			_, field, _ := strings.Cut(fieldError.Namespace(), ".")
+			fieldErrors[i] = NewFieldError(field, fieldError.Tag(), fieldError.Param())
+		}
+		return fieldErrors
+	case errors.As(err, &validationError):
+		return validationError
+	case errors.As(err, &typeError) && typeError.Field != "":
+		return []FieldError{NewFieldError(typeError.Field, "type", jsonTypeName(typeError.Type))}
+	default:
+		return nil
+	}
+}
+
+// jsonTypeName names the kind of JSON value expected for a Go type
+func jsonTypeName(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.String:
+		return "string"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	default:
+		return "object"
+	}
+}
+
+// Message explains an input error in the given language, from its field errors when it has some
+func Message(err error, language string) string {
+	if fieldErrors := FieldErrors(err); fieldErrors != nil {
+		return ValidationError(Localize(fieldErrors, language)).Error()
+	}
+	var typeError *json.UnmarshalTypeError
+	if errors.As(err, &typeError) {
+		return message(language, "", "type", jsonTypeName(typeError.Type))
+	}
+	return err.Error()
+}
+
+// FromBindError converts the error of binding a JSON body into the problem describing it
+func FromBindError(err error) *Problem {
+	if fieldErrors := FieldErrors(err); fieldErrors != nil {
+		p := New(http.StatusBadRequest, CodeValidationFailed, "Invalid input, see errors for the invalid fields")
+		p.Errors = fieldErrors
+		return p
+	}
+	if errors.Is(err, io.EOF) {
+		return New(http.StatusBadRequest, CodeInvalidJSON, "Invalid input, the body must not be empty")
+	}
+	var typeError *json.UnmarshalTypeError
+	if errors.As(err, &typeError) {
+		return New(http.StatusBadRequest, CodeInvalidJSON, "Invalid input, the body must be "+catalogs[DefaultLanguage].Types[jsonTypeName(typeError.Type)])
+	}
+	return New(http.StatusBadRequest, CodeInvalidJSON, "Invalid input, the body must be valid JSON: "+err.Error())
+}
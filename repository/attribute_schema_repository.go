@@ -0,0 +1,51 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"products-api/models"
+	"slices"
+)
+
+var (
+	// ErrAttributeSchemaNotFound is returned when an attribute schema with the requested ID does not exist
+	ErrAttributeSchemaNotFound = errors.New("attribute schema not found")
+	// ErrSchemaCategoryNotFound is returned when the category given to an attribute schema does not exist
+	ErrSchemaCategoryNotFound = errors.New("category of the attribute schema not found")
+	// ErrDuplicateAttributeSchema is returned when the product type or category of a schema already has another one
+	ErrDuplicateAttributeSchema = errors.New("product type or category already has an attribute schema")
+)
+
+// AttributeSchemaRepository abstracts the storage of the attribute schemas of product types and categories.
+// The schema of a category is deleted with the category
+type AttributeSchemaRepository interface {
+	// List returns the requested page of schemas in creation order and the total number of schemas
+	List(ctx context.Context, offset, limit int) ([]models.AttributeSchema, int64, error)
+	// Get returns the schema with the given ID or ErrAttributeSchemaNotFound
+	Get(ctx context.Context, id uint64) (*models.AttributeSchema, error)
+	// Create stores a new schema and fills in its generated fields,
+	// or returns ErrSchemaCategoryNotFound or ErrDuplicateAttributeSchema
+	Create(ctx context.Context, schema *models.AttributeSchema) error
+	// Update replaces an existing schema, or returns ErrAttributeSchemaNotFound or the errors of Create
+	Update(ctx context.Context, schema *models.AttributeSchema) error
+	// Delete removes the schema with the given ID or returns ErrAttributeSchemaNotFound
+	Delete(ctx context.Context, id uint64) error
+	// ListApplicable returns the schemas of the product type, unless it is empty, and of the given categories
+	ListApplicable(ctx context.Context, productType string, categoryIDs []uint) ([]models.AttributeSchema, error)
+}
+
+// sameSchemaTarget reports whether two schemas apply to the same product type or category
+func sameSchemaTarget(a, b models.AttributeSchema) bool {
+	if a.ProductType != nil && b.ProductType != nil {
+		return *a.ProductType == *b.ProductType
+	}
+	return a.CategoryID != nil && b.CategoryID != nil && *a.CategoryID == *b.CategoryID
+}
+
+// schemaApplies reports whether a schema applies to the product type, unless it is empty, or to one of the categories
+func schemaApplies(schema models.AttributeSchema, productType string, categoryIDs []uint) bool {
+	if schema.ProductType != nil {
+		return productType != "" && *schema.ProductType == productType
+	}
+	return schema.CategoryID != nil && slices.Contains(categoryIDs, *schema.CategoryID)
+}
@@ -0,0 +1,137 @@
+package repository
+
+import (
+	"context"
+	"products-api/models"
+	"reflect"
+	"time"
+)
+
+// SystemActor is the actor of changes made without a request, such as background purges
+const SystemActor = "system"
+
+// AuditInfo identifies who made the changes recorded in the audit log
+type AuditInfo struct {
+	Actor     string
+	RequestID string
+}
+
+type auditInfoKey struct{}
+
+// WithAuditInfo returns a context whose product changes are attributed to the given actor and request
+func WithAuditInfo(ctx context.Context, info AuditInfo) context.Context {
+	return context.WithValue(ctx, auditInfoKey{}, info)
+}
+
+// AuditInfoFrom returns the audit information of the context, attributing changes to SystemActor by default
+func AuditInfoFrom(ctx context.Context) AuditInfo {
+	if info, ok := ctx.Value(auditInfoKey{}).(AuditInfo); ok {
+		return info
+	}
+	return AuditInfo{Actor: SystemActor}
+}
+
+// AuditFilter restricts which audit records are listed, zero values match everything
+type AuditFilter struct {
+	ProductID *uint
+	Actor     string
+	Action    string
+	From      *time.Time // Records created at or after this time
+	To        *time.Time // Records created before this time
+}
+
+// Matches reports whether the record satisfies every condition of the filter
+func (f AuditFilter) Matches(record models.AuditRecord) bool {
+	if f.ProductID != nil && record.ProductID != *f.ProductID {
+		return false
+	}
+	if f.Actor != "" && record.Actor != f.Actor {
+		return false
+	}
+	if f.Action != "" && record.Action != f.Action {
+		return false
+	}
+	if f.From != nil && record.CreatedAt.Before(*f.From) {
+		return false
+	}
+	if f.To != nil && !record.CreatedAt.Before(*f.To) {
+		return false
+	}
+	return true
+}
+
+// AuditListOptions holds the parameters used to retrieve a page of audit records
+type AuditListOptions struct {
+	Filter AuditFilter
+	Offset int
+	Limit  int // Every matching record is returned when not positive
+}
+
+// AuditRepository reads the audit log, which the ProductRepository writes in the same transaction as the changes
+type AuditRepository interface {
+	// List returns the requested page of records matching the filter, oldest first, and the total number of matches
+	List(ctx context.Context, opts AuditListOptions) ([]models.AuditRecord, int64, error)
+}
+
+// auditedFields lists the product fields compared by audit records
+var auditedFields = []string{"name", "description", "price", "tags", "type", "attributes", "deleted_at"}
+
+// auditValues returns the audited field values of a product, or nil values when there is no product
+func auditValues(product *models.Product) map[string]interface{} {
+	values := make(map[string]interface{}, len(auditedFields))
+	if product == nil {
+		return values
+	}
+
+	values["name"] = product.Name
+	values["description"] = product.Description
+	values["price"] = product.Price
+	if len(product.Tags) > 0 {
+		values["tags"] = product.Tags
+	}
+	if product.Type != "" {
+		values["type"] = product.Type
+	}
+	if len(product.Attributes) > 0 {
+		values["attributes"] = product.Attributes
+	}
+	if product.DeletedAt.Valid {
+		values["deleted_at"] = product.DeletedAt.Time.UTC().Format(time.RFC3339Nano)
+	}
+	return values
+}
+
+// newAuditRecord describes the change of a product from before to after, either of which is nil
+// when the product is created or purged, attributing it to the actor of the context
+func newAuditRecord(ctx context.Context, action string, before, after *models.Product) models.AuditRecord {
+	info := AuditInfoFrom(ctx)
+	record := models.AuditRecord{
+		Action:    action,
+		Actor:     info.Actor,
+		RequestID: info.RequestID,
+		CreatedAt: time.Now().UTC(),
+	}
+
+	current := after
+	if current == nil {
+		current = before
+	}
+	record.ProductID = current.ID
+	record.Version = current.Version
+
+	record.Changes = DiffProducts(before, after)
+	return record
+}
+
+// DiffProducts returns the audited fields whose values differ between two states of a product,
+// either of which is nil when the product does not exist in that state
+func DiffProducts(before, after *models.Product) models.AuditChanges {
+	changes := models.AuditChanges{}
+	beforeValues, afterValues := auditValues(before), auditValues(after)
+	for _, field := range auditedFields {
+		if !reflect.DeepEqual(beforeValues[field], afterValues[field]) {
+			changes[field] = models.AuditChange{Before: beforeValues[field], After: afterValues[field]}
+		}
+	}
+	return changes
+}
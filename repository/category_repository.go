@@ -0,0 +1,55 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"products-api/models"
+)
+
+var (
+	// ErrCategoryNotFound is returned when a category with the requested ID does not exist
+	ErrCategoryNotFound = errors.New("category not found")
+	// ErrParentCategoryNotFound is returned when the parent given to a category does not exist
+	ErrParentCategoryNotFound = errors.New("parent category not found")
+	// ErrCategoryCycle is returned when a category would be moved below itself or one of its descendants
+	ErrCategoryCycle = errors.New("category cannot be its own ancestor")
+	// ErrCategoryHasChildren is returned when deleting a category that still has subcategories
+	ErrCategoryHasChildren = errors.New("category has subcategories")
+	// ErrProductNotInCategory is returned when unlinking a product that is not in the category
+	ErrProductNotInCategory = errors.New("product not in category")
+)
+
+// CategoryListOptions holds the parameters used to retrieve a page of categories
+type CategoryListOptions struct {
+	ParentID *uint // Only the direct children of this category when set
+	Offset   int
+	Limit    int // Every matching category is returned when not positive
+}
+
+// CategoryRepository abstracts the storage of the category tree and of the links between products and categories.
+// Links are not checked against the products, a link to a purged product is removed with the product
+type CategoryRepository interface {
+	// Get returns the category with the given ID or ErrCategoryNotFound
+	Get(ctx context.Context, id uint64) (*models.Category, error)
+	// List returns the requested page of categories in tree order, every category followed by its descendants,
+	// and the total number of matches
+	List(ctx context.Context, opts CategoryListOptions) ([]models.Category, int64, error)
+	// Create stores a new category below its parent, or at the root when it has none, and fills in its generated fields,
+	// or returns ErrParentCategoryNotFound
+	Create(ctx context.Context, category *models.Category) error
+	// Update persists the changes made to an existing category, moving its descendants along when its parent changed,
+	// or returns ErrCategoryNotFound, ErrParentCategoryNotFound or ErrCategoryCycle
+	Update(ctx context.Context, category *models.Category) error
+	// Delete removes the category with the given ID, its links to products and its attribute schema,
+	// or returns ErrCategoryNotFound or ErrCategoryHasChildren
+	Delete(ctx context.Context, id uint64) error
+	// DescendantIDs returns the ID of the category followed by the IDs of all its descendants, or ErrCategoryNotFound
+	DescendantIDs(ctx context.Context, id uint64) ([]uint, error)
+	// LinkProducts adds the products to the category, ignoring those already in it, and returns the number of new links,
+	// or ErrCategoryNotFound
+	LinkProducts(ctx context.Context, id uint64, productIDs []uint) (int64, error)
+	// UnlinkProduct removes the product from the category, or returns ErrProductNotInCategory
+	UnlinkProduct(ctx context.Context, id uint64, productID uint64) error
+	// ListByProduct returns the categories of the product in tree order
+	ListByProduct(ctx context.Context, productID uint64) ([]models.Category, error)
+}
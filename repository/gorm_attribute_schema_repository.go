@@ -0,0 +1,115 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"gorm.io/gorm"
+	"products-api/models"
+)
+
+// GormAttributeSchemaRepository is an AttributeSchemaRepository backed by a GORM database
+type GormAttributeSchemaRepository struct {
+	db *gorm.DB
+}
+
+// NewGormAttributeSchemaRepository creates an AttributeSchemaRepository using the given database connection
+func NewGormAttributeSchemaRepository(db *gorm.DB) *GormAttributeSchemaRepository {
+	return &GormAttributeSchemaRepository{db: db}
+}
+
+func (r *GormAttributeSchemaRepository) List(ctx context.Context, offset, limit int) ([]models.AttributeSchema, int64, error) {
+	query := r.db.WithContext(ctx).Model(&models.AttributeSchema{})
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	schemas := []models.AttributeSchema{}
+	err := query.Order("id").Scopes(limitScope(limit)).Offset(offset).Find(&schemas).Error
+	return schemas, total, err
+}
+
+func (r *GormAttributeSchemaRepository) Get(ctx context.Context, id uint64) (*models.AttributeSchema, error) {
+	return findAttributeSchema(r.db.WithContext(ctx), id)
+}
+
+func (r *GormAttributeSchemaRepository) Create(ctx context.Context, schema *models.AttributeSchema) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := checkAttributeSchema(tx, *schema); err != nil {
+			return err
+		}
+		return tx.Create(schema).Error
+	})
+}
+
+func (r *GormAttributeSchemaRepository) Update(ctx context.Context, schema *models.AttributeSchema) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		stored, err := findAttributeSchema(tx, uint64(schema.ID))
+		if err != nil {
+			return err
+		}
+		if err := checkAttributeSchema(tx, *schema); err != nil {
+			return err
+		}
+
+		schema.CreatedAt = stored.CreatedAt
+		return tx.Model(schema).Select("product_type", "category_id", "attributes", "updated_at").Updates(schema).Error
+	})
+}
+
+func (r *GormAttributeSchemaRepository) Delete(ctx context.Context, id uint64) error {
+	result := r.db.WithContext(ctx).Delete(&models.AttributeSchema{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrAttributeSchemaNotFound
+	}
+	return nil
+}
+
+func (r *GormAttributeSchemaRepository) ListApplicable(ctx context.Context, productType string, categoryIDs []uint) ([]models.AttributeSchema, error) {
+	schemas := []models.AttributeSchema{}
+	query := r.db.WithContext(ctx).Where("category_id IN ?", categoryIDs)
+	if productType != "" {
+		query = query.Or("product_type = ?", productType)
+	}
+	err := query.Order("id").Find(&schemas).Error
+	return schemas, err
+}
+
+// findAttributeSchema reads the schema with the given ID, returning ErrAttributeSchemaNotFound when it does not exist
+func findAttributeSchema(db *gorm.DB, id uint64) (*models.AttributeSchema, error) {
+	var schema models.AttributeSchema
+	if err := db.First(&schema, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrAttributeSchemaNotFound
+		}
+		return nil, err
+	}
+	return &schema, nil
+}
+
+// checkAttributeSchema checks that the category of a new or changed schema exists
+// and that no other schema applies to the same product type or category
+func checkAttributeSchema(tx *gorm.DB, schema models.AttributeSchema) error {
+	others := tx.Model(&models.AttributeSchema{}).Where("id <> ?", schema.ID)
+	if schema.CategoryID != nil {
+		if _, err := findCategory(tx, uint64(*schema.CategoryID), ErrSchemaCategoryNotFound); err != nil {
+			return err
+		}
+		others = others.Where("category_id = ?", *schema.CategoryID)
+	} else {
+		others = others.Where("product_type = ?", schema.ProductType)
+	}
+
+	var duplicates int64
+	if err := others.Count(&duplicates).Error; err != nil {
+		return err
+	}
+	if duplicates > 0 {
+		return ErrDuplicateAttributeSchema
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package repository
+
+import (
+	"context"
+	"gorm.io/gorm"
+	"products-api/models"
+)
+
+// GormAuditRepository is an AuditRepository backed by a GORM database
+type GormAuditRepository struct {
+	db *gorm.DB
+}
+
+// NewGormAuditRepository creates an AuditRepository using the given database connection
+func NewGormAuditRepository(db *gorm.DB) *GormAuditRepository {
+	return &GormAuditRepository{db: db}
+}
+
+func (r *GormAuditRepository) List(ctx context.Context, opts AuditListOptions) ([]models.AuditRecord, int64, error) {
+	var total int64
+	err := r.db.WithContext(ctx).Model(&models.AuditRecord{}).Scopes(auditFilterScope(opts.Filter)).Count(&total).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	records := []models.AuditRecord{}
+	err = r.db.WithContext(ctx).Scopes(auditFilterScope(opts.Filter), limitScope(opts.Limit)).
+		Order("id").Offset(opts.Offset).Find(&records).Error
+	return records, total, err
+}
+
+// auditFilterScope translates an AuditFilter into WHERE conditions
+func auditFilterScope(filter AuditFilter) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if filter.ProductID != nil {
+			db = db.Where("product_id = ?", *filter.ProductID)
+		}
+		if filter.Actor != "" {
+			db = db.Where("actor = ?", filter.Actor)
+		}
+		if filter.Action != "" {
+			db = db.Where("action = ?", filter.Action)
+		}
+		// Records are stored in UTC, which keeps comparisons right on SQLite where times are text
+		if filter.From != nil {
+			db = db.Where("created_at >= ?", filter.From.UTC())
+		}
+		if filter.To != nil {
+			db = db.Where("created_at < ?", filter.To.UTC())
+		}
+		return db
+	}
+}
@@ -0,0 +1,189 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"products-api/models"
+)
+
+// GormCategoryRepository is a CategoryRepository backed by a GORM database
+type GormCategoryRepository struct {
+	db *gorm.DB
+}
+
+// NewGormCategoryRepository creates a CategoryRepository using the given database connection
+func NewGormCategoryRepository(db *gorm.DB) *GormCategoryRepository {
+	return &GormCategoryRepository{db: db}
+}
+
+func (r *GormCategoryRepository) Get(ctx context.Context, id uint64) (*models.Category, error) {
+	return findCategory(r.db.WithContext(ctx), id, ErrCategoryNotFound)
+}
+
+func (r *GormCategoryRepository) List(ctx context.Context, opts CategoryListOptions) ([]models.Category, int64, error) {
+	query := r.db.WithContext(ctx).Model(&models.Category{})
+	if opts.ParentID != nil {
+		query = query.Where("parent_id = ?", *opts.ParentID)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	categories := []models.Category{}
+	err := query.Order("path").Scopes(limitScope(opts.Limit)).Offset(opts.Offset).Find(&categories).Error
+	return categories, total, err
+}
+
+func (r *GormCategoryRepository) Create(ctx context.Context, category *models.Category) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		parent, err := findParentCategory(tx, category.ParentID)
+		if err != nil {
+			return err
+		}
+
+		// The path ends with the generated ID, so it can only be set once the row exists
+		category.Path = ""
+		if err := tx.Create(category).Error; err != nil {
+			return err
+		}
+		category.Path = models.CategoryPath(parent, category.ID)
+		return tx.Model(category).UpdateColumn("path", category.Path).Error
+	})
+}
+
+func (r *GormCategoryRepository) Update(ctx context.Context, category *models.Category) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		stored, err := findCategory(tx, uint64(category.ID), ErrCategoryNotFound)
+		if err != nil {
+			return err
+		}
+
+		category.Path = stored.Path
+		category.CreatedAt = stored.CreatedAt
+		if !sameParent(stored.ParentID, category.ParentID) {
+			parent, err := findParentCategory(tx, category.ParentID)
+			if err != nil {
+				return err
+			}
+			if parent != nil && parent.IsDescendantOf(*stored) {
+				return ErrCategoryCycle
+			}
+
+			// Replace the old path of the category at the start of the paths of its descendants
+			category.Path = models.CategoryPath(parent, category.ID)
+			err = tx.Model(&models.Category{}).Where("path LIKE ? AND id <> ?", stored.Path+"%", stored.ID).
+				UpdateColumn("path", gorm.Expr("CAST(? AS TEXT) || SUBSTR(path, ?)", category.Path, len(stored.Path)+1)).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		return tx.Model(category).Select("name", "description", "parent_id", "path", "updated_at").Updates(category).Error
+	})
+}
+
+func (r *GormCategoryRepository) Delete(ctx context.Context, id uint64) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if _, err := findCategory(tx, id, ErrCategoryNotFound); err != nil {
+			return err
+		}
+
+		var children int64
+		if err := tx.Model(&models.Category{}).Where("parent_id = ?", id).Count(&children).Error; err != nil {
+			return err
+		}
+		if children > 0 {
+			return ErrCategoryHasChildren
+		}
+
+		if err := tx.Where("category_id = ?", id).Delete(&models.ProductCategory{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("category_id = ?", id).Delete(&models.AttributeSchema{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&models.Category{}, id).Error
+	})
+}
+
+func (r *GormCategoryRepository) DescendantIDs(ctx context.Context, id uint64) ([]uint, error) {
+	category, err := r.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []uint
+	err = r.db.WithContext(ctx).Model(&models.Category{}).Where("path LIKE ?", category.Path+"%").
+		Order("path").Pluck("id", &ids).Error
+	return ids, err
+}
+
+func (r *GormCategoryRepository) LinkProducts(ctx context.Context, id uint64, productIDs []uint) (int64, error) {
+	var linked int64
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if _, err := findCategory(tx, id, ErrCategoryNotFound); err != nil {
+			return err
+		}
+
+		now := tx.NowFunc()
+		links := make([]models.ProductCategory, len(productIDs))
+		for i, productID := range productIDs {
+			links[i] = models.ProductCategory{ProductID: productID, CategoryID: uint(id), CreatedAt: now}
+		}
+		// Products already in the category keep their original link
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(links, createBatchSize)
+		linked = result.RowsAffected
+		return result.Error
+	})
+	return linked, err
+}
+
+func (r *GormCategoryRepository) UnlinkProduct(ctx context.Context, id uint64, productID uint64) error {
+	result := r.db.WithContext(ctx).Where("category_id = ? AND product_id = ?", id, productID).Delete(&models.ProductCategory{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrProductNotInCategory
+	}
+	return nil
+}
+
+func (r *GormCategoryRepository) ListByProduct(ctx context.Context, productID uint64) ([]models.Category, error) {
+	categories := []models.Category{}
+	err := r.db.WithContext(ctx).Where("id IN (SELECT category_id FROM product_categories WHERE product_id = ?)", productID).
+		Order("path").Find(&categories).Error
+	return categories, err
+}
+
+// findCategory reads the category with the given ID, returning notFound when it does not exist
+func findCategory(db *gorm.DB, id uint64, notFound error) (*models.Category, error) {
+	var category models.Category
+	if err := db.First(&category, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, notFound
+		}
+		return nil, err
+	}
+	return &category, nil
+}
+
+// findParentCategory reads the parent a category is placed below, which is nil for root categories
+func findParentCategory(db *gorm.DB, parentID *uint) (*models.Category, error) {
+	if parentID == nil {
+		return nil, nil
+	}
+	return findCategory(db, uint64(*parentID), ErrParentCategoryNotFound)
+}
+
+// sameParent reports whether two parent IDs designate the same parent, or both the root
+func sameParent(a, b *uint) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
@@ -0,0 +1,57 @@
+package repository
+
+import (
+	"context"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"products-api/models"
+	"time"
+)
+
+// GormIdempotencyRepository is an IdempotencyRepository backed by a GORM database
+type GormIdempotencyRepository struct {
+	db *gorm.DB
+}
+
+// NewGormIdempotencyRepository creates an IdempotencyRepository using the given database connection
+func NewGormIdempotencyRepository(db *gorm.DB) *GormIdempotencyRepository {
+	return &GormIdempotencyRepository{db: db}
+}
+
+func (r *GormIdempotencyRepository) Begin(ctx context.Context, record models.IdempotencyRecord) (*models.IdempotencyRecord, error) {
+	var existing *models.IdempotencyRecord
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now().UTC()
+
+		// An expired record no longer holds the key
+		if err := tx.Where("idempotency_key = ? AND expires_at <= ?", record.Key, now).
+			Delete(&models.IdempotencyRecord{}).Error; err != nil {
+			return err
+		}
+
+		// Insert the record unless another request already claimed the key
+		record.CreatedAt = now
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&record)
+		if result.Error != nil || result.RowsAffected == 1 {
+			return result.Error
+		}
+
+		existing = &models.IdempotencyRecord{}
+		return tx.Where("idempotency_key = ?", record.Key).First(existing).Error
+	})
+	return existing, err
+}
+
+func (r *GormIdempotencyRepository) Complete(ctx context.Context, key string, statusCode int, headers string, body []byte) error {
+	return r.db.WithContext(ctx).Model(&models.IdempotencyRecord{}).Where("idempotency_key = ?", key).
+		Updates(map[string]interface{}{"status_code": statusCode, "headers": headers, "body": body}).Error
+}
+
+func (r *GormIdempotencyRepository) Release(ctx context.Context, key string) error {
+	return r.db.WithContext(ctx).Where("idempotency_key = ?", key).Delete(&models.IdempotencyRecord{}).Error
+}
+
+func (r *GormIdempotencyRepository) DeleteExpired(ctx context.Context, before time.Time) (int64, error) {
+	result := r.db.WithContext(ctx).Where("expires_at < ?", before.UTC()).Delete(&models.IdempotencyRecord{})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,707 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"products-api/models"
+	"slices"
+	"strings"
+	"time"
+)
+
+// GormProductRepository is a ProductRepository backed by a GORM database
+type GormProductRepository struct {
+	db *gorm.DB
+}
+
+// NewGormProductRepository creates a ProductRepository using the given database connection
+func NewGormProductRepository(db *gorm.DB) *GormProductRepository {
+	return &GormProductRepository{db: db}
+}
+
+func (r *GormProductRepository) Get(ctx context.Context, id uint64) (*models.Product, error) {
+	var row productWithTags
+	if err := r.db.WithContext(ctx).Model(&models.Product{}).Scopes(tagsScope).First(&row, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrProductNotFound
+		}
+		return nil, err
+	}
+	product := row.product()
+	return &product, nil
+}
+
+func (r *GormProductRepository) List(ctx context.Context, opts ListOptions) ([]models.Product, error) {
+	var rows []productWithTags
+	query := r.db.WithContext(ctx).Model(&models.Product{}).Scopes(filterScope(opts.Filter), listTagsScope(opts.Filter))
+
+	if opts.Keyset != nil {
+		// Walk backward pages in reverse order and flip the result afterwards
+		fields := withTiebreaker(opts.Sort)
+		if opts.Keyset.Backward {
+			fields = reverseSort(fields)
+		}
+		err := query.Scopes(keysetScope(fields, opts.Keyset.Key), sortScope(fields), limitScope(opts.Limit)).Find(&rows).Error
+		if opts.Keyset.Backward {
+			slices.Reverse(rows)
+		}
+		return taggedProducts(rows), err
+	}
+
+	err := query.Scopes(sortScope(opts.Sort), limitScope(opts.Limit)).Offset(opts.Offset).Find(&rows).Error
+	return taggedProducts(rows), err
+}
+
+func (r *GormProductRepository) Each(ctx context.Context, opts ListOptions, fn func(product models.Product) error) error {
+	// Read the rows through a database cursor instead of collecting them in a slice
+	rows, err := r.db.WithContext(ctx).Model(&models.Product{}).
+		Scopes(filterScope(opts.Filter), listTagsScope(opts.Filter), sortScope(opts.Sort), limitScope(opts.Limit)).
+		Offset(opts.Offset).Rows()
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var row productWithTags
+		if err := r.db.ScanRows(rows, &row); err != nil {
+			return err
+		}
+		if err := fn(row.product()); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (r *GormProductRepository) Count(ctx context.Context, filter ProductFilter) (int64, error) {
+	var total int64
+	err := r.db.WithContext(ctx).Model(&models.Product{}).Scopes(filterScope(filter)).Count(&total).Error
+	return total, err
+}
+
+func (r *GormProductRepository) Search(ctx context.Context, opts SearchOptions) ([]SearchResult, int64, error) {
+	if r.db.Dialector.Name() != "postgres" {
+		return r.searchFallback(ctx, opts)
+	}
+
+	// Match every term as a prefix so that partially typed words already find products
+	prefixes := make([]string, len(opts.Terms))
+	for i, term := range opts.Terms {
+		prefixes[i] = term + ":*"
+	}
+	tsQuery := strings.Join(prefixes, " & ")
+
+	var total int64
+	err := r.db.WithContext(ctx).Model(&models.Product{}).
+		Where("search_vector @@ to_tsquery('english', ?)", tsQuery).Count(&total).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var rows []struct {
+		models.Product
+		TagList              *string
+		Rank                 float64
+		NameHighlight        string
+		DescriptionHighlight string
+	}
+	err = r.db.WithContext(ctx).Raw(`SELECT products.*, ts_rank(search_vector, query) AS rank, `+tagsColumn(r.db)+`,
+			ts_headline('english', `+escapeHTML("coalesce(name, '')")+`, query, ?) AS name_highlight,
+			ts_headline('english', `+escapeHTML("coalesce(description, '')")+`, query, ?) AS description_highlight
+		FROM products, to_tsquery('english', ?) AS query
+		WHERE search_vector @@ query AND deleted_at IS NULL
+		ORDER BY rank DESC, id
+		LIMIT ? OFFSET ?`,
+		fmt.Sprintf("StartSel=%s, StopSel=%s, HighlightAll=true", HighlightStart, HighlightStop),
+		fmt.Sprintf("StartSel=%s, StopSel=%s, MaxWords=%d, MinWords=%d", HighlightStart, HighlightStop, snippetWords, snippetWords/2),
+		tsQuery, opts.Limit, opts.Offset).Scan(&rows).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	results := make([]SearchResult, len(rows))
+	for i, row := range rows {
+		results[i] = SearchResult{
+			Product: productWithTags{row.Product, row.TagList}.product(),
+			Rank:    row.Rank,
+			Highlights: SearchHighlights{
+				Name:        row.NameHighlight,
+				Description: row.DescriptionHighlight,
+			},
+		}
+	}
+	return results, total, nil
+}
+
+// escapeHTML returns the SQL expression escaping the text of the given expression like html.EscapeString,
+// so that only the highlight markers of ts_headline are markup
+func escapeHTML(expression string) string {
+	for _, replacement := range [][2]string{{"&", "&amp;"}, {"'", "&#39;"}, {"<", "&lt;"}, {">", "&gt;"}, {`"`, "&#34;"}} {
+		expression = fmt.Sprintf("replace(%s, '%s', '%s')", expression, strings.ReplaceAll(replacement[0], "'", "''"), replacement[1])
+	}
+	return expression
+}
+
+// searchFallback narrows the candidates down with LIKE and ranks them in the application,
+// for databases without native full-text search
+func (r *GormProductRepository) searchFallback(ctx context.Context, opts SearchOptions) ([]SearchResult, int64, error) {
+	query := r.db.WithContext(ctx).Model(&models.Product{}).Scopes(tagsScope)
+	for _, term := range opts.Terms {
+		pattern := likePattern(term)
+		query = query.Where(`(LOWER(name) LIKE ? ESCAPE '\' OR LOWER(description) LIKE ? ESCAPE '\')`, pattern, pattern)
+	}
+
+	var candidates []productWithTags
+	if err := query.Find(&candidates).Error; err != nil {
+		return nil, 0, err
+	}
+
+	results, total := searchProducts(taggedProducts(candidates), opts)
+	return results, total, nil
+}
+
+func (r *GormProductRepository) Create(ctx context.Context, product *models.Product) error {
+	product.Version = 1
+	product.DeletedAt = gorm.DeletedAt{}
+	normalizeProduct(product)
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(product).Error; err != nil {
+			return err
+		}
+		if err := saveTags(tx, product.ID, product.Tags); err != nil {
+			return err
+		}
+		return recordChange(ctx, tx, models.AuditActionCreate, nil, product)
+	})
+}
+
+// createBatchSize is the number of products inserted per statement by CreateBatch
+const createBatchSize = 100
+
+func (r *GormProductRepository) CreateBatch(ctx context.Context, products []models.Product) error {
+	for i := range products {
+		products[i].Version = 1
+		products[i].DeletedAt = gorm.DeletedAt{}
+		normalizeProduct(&products[i])
+	}
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.CreateInBatches(products, createBatchSize).Error; err != nil {
+			return err
+		}
+		records := make([]models.AuditRecord, len(products))
+		versions := make([]models.ProductVersion, len(products))
+		var tags []models.ProductTag
+		for i := range products {
+			records[i] = newAuditRecord(ctx, models.AuditActionCreate, nil, &products[i])
+			versions[i] = newProductVersion(&products[i])
+			for _, tag := range products[i].Tags {
+				tags = append(tags, models.ProductTag{ProductID: products[i].ID, Tag: tag})
+			}
+		}
+		if err := tx.CreateInBatches(records, createBatchSize).Error; err != nil {
+			return err
+		}
+		if len(tags) > 0 {
+			if err := tx.CreateInBatches(tags, createBatchSize).Error; err != nil {
+				return err
+			}
+		}
+		return tx.CreateInBatches(versions, createBatchSize).Error
+	})
+}
+
+func (r *GormProductRepository) Update(ctx context.Context, product *models.Product) error {
+	expectedVersion := product.Version
+	normalizeProduct(product)
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		before, err := findForChange(tx, uint64(product.ID), expectedVersion, false)
+		if err != nil {
+			return err
+		}
+
+		// Only update the row if nobody else changed it since it was read
+		product.Version++
+		result := tx.Model(product).Where("version = ?", expectedVersion).
+			Select("*").Omit("id", "created_at").Updates(product)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected != 1 {
+			return ErrVersionConflict
+		}
+		if !slices.Equal(before.Tags, product.Tags) {
+			if err := saveTags(tx, product.ID, product.Tags); err != nil {
+				return err
+			}
+		}
+
+		return recordChange(ctx, tx, models.AuditActionUpdate, before, product)
+	})
+	if err != nil {
+		product.Version = expectedVersion
+	}
+	return err
+}
+
+func (r *GormProductRepository) Transaction(ctx context.Context, fn func(repo ProductRepository) error) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return fn(NewGormProductRepository(tx))
+	})
+}
+
+func (r *GormProductRepository) Delete(ctx context.Context, id uint64, expectedVersion uint) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		before, err := findForChange(tx, id, expectedVersion, false)
+		if err != nil {
+			return err
+		}
+
+		after := *before
+		after.DeletedAt = gorm.DeletedAt{Time: tx.NowFunc(), Valid: true}
+		result := tx.Model(&models.Product{}).Where("id = ? AND version = ?", id, before.Version).
+			UpdateColumn("deleted_at", after.DeletedAt)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected != 1 {
+			return ErrVersionConflict
+		}
+
+		return recordChange(ctx, tx, models.AuditActionDelete, before, &after)
+	})
+}
+
+func (r *GormProductRepository) Restore(ctx context.Context, id uint64) (*models.Product, error) {
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var row productWithTags
+		err := tx.Unscoped().Model(&models.Product{}).Scopes(tagsScope).Where("deleted_at IS NOT NULL").First(&row, id).Error
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return ErrProductNotFound
+			}
+			return err
+		}
+
+		before := row.product()
+		after := before
+		after.DeletedAt = gorm.DeletedAt{}
+		after.Version++
+		after.UpdatedAt = tx.NowFunc()
+		result := tx.Unscoped().Model(&models.Product{}).Where("id = ? AND version = ?", id, before.Version).
+			UpdateColumns(map[string]interface{}{
+				"deleted_at": nil,
+				"version":    after.Version,
+				"updated_at": after.UpdatedAt,
+			})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected != 1 {
+			return ErrVersionConflict
+		}
+
+		return recordChange(ctx, tx, models.AuditActionRestore, &before, &after)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return r.Get(ctx, id)
+}
+
+func (r *GormProductRepository) Purge(ctx context.Context, id uint64, expectedVersion uint) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		before, err := findForChange(tx, id, expectedVersion, true)
+		if err != nil {
+			return err
+		}
+
+		result := tx.Unscoped().Where("version = ?", before.Version).Delete(&models.Product{}, id)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected != 1 {
+			return ErrVersionConflict
+		}
+		if err := tx.Where("product_id = ?", id).Delete(&models.ProductCategory{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("product_id = ?", id).Delete(&models.ProductTag{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("product_id = ?", id).Delete(&models.Variant{}).Error; err != nil {
+			return err
+		}
+		return recordChange(ctx, tx, models.AuditActionPurge, before, nil)
+	})
+}
+
+func (r *GormProductRepository) PurgeDeleted(ctx context.Context, before time.Time) (int64, error) {
+	var purged int64
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var rows []productWithTags
+		err := tx.Unscoped().Model(&models.Product{}).Scopes(tagsScope).
+			Where("deleted_at IS NOT NULL AND deleted_at < ?", before.UTC()).Find(&rows).Error
+		if err != nil {
+			return err
+		}
+		if len(rows) == 0 {
+			return nil
+		}
+
+		products := taggedProducts(rows)
+
+		ids := ProductIDs(products)
+		result := tx.Unscoped().Delete(&models.Product{}, ids)
+		if result.Error != nil {
+			return result.Error
+		}
+		purged = result.RowsAffected
+		if err := tx.Where("product_id IN ?", ids).Delete(&models.ProductCategory{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("product_id IN ?", ids).Delete(&models.ProductTag{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("product_id IN ?", ids).Delete(&models.Variant{}).Error; err != nil {
+			return err
+		}
+
+		records := make([]models.AuditRecord, len(products))
+		for i := range products {
+			records[i] = newAuditRecord(ctx, models.AuditActionPurge, &products[i], nil)
+		}
+		return tx.CreateInBatches(records, createBatchSize).Error
+	})
+	return purged, err
+}
+
+func (r *GormProductRepository) ListTags(ctx context.Context, offset, limit int) ([]TagCount, int64, error) {
+	liveTags := func() *gorm.DB {
+		return r.db.WithContext(ctx).Table("product_tags").
+			Joins("JOIN products ON products.id = product_tags.product_id").Where("products.deleted_at IS NULL")
+	}
+
+	var total int64
+	if err := liveTags().Distinct("tag").Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	tags := []TagCount{}
+	err := liveTags().Select("tag, COUNT(*) AS count").Group("tag").Order("count DESC, tag").
+		Scopes(limitScope(limit)).Offset(offset).Scan(&tags).Error
+	return tags, total, err
+}
+
+func (r *GormProductRepository) ListVersions(ctx context.Context, id uint64, offset, limit int) ([]models.ProductVersion, int64, error) {
+	var total int64
+	err := r.db.WithContext(ctx).Model(&models.ProductVersion{}).Where("product_id = ?", id).Count(&total).Error
+	if err != nil {
+		return nil, 0, err
+	}
+
+	versions := []models.ProductVersion{}
+	err = r.db.WithContext(ctx).Where("product_id = ?", id).Order("version").
+		Scopes(limitScope(limit)).Offset(offset).Find(&versions).Error
+	return versions, total, err
+}
+
+func (r *GormProductRepository) GetVersion(ctx context.Context, id uint64, version uint) (*models.ProductVersion, error) {
+	var productVersion models.ProductVersion
+	err := r.db.WithContext(ctx).Where("product_id = ? AND version = ?", id, version).First(&productVersion).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrVersionNotFound
+		}
+		return nil, err
+	}
+	return &productVersion, nil
+}
+
+// recordChange writes the audit record of a change in the given transaction, ends the validity of the current
+// version when the change supersedes, deletes or purges it, and snapshots the new version if there is one
+func recordChange(ctx context.Context, tx *gorm.DB, action string, before, after *models.Product) error {
+	return writeChange(tx, newAuditRecord(ctx, action, before, after), before, after)
+}
+
+// writeChange writes the given audit record of a change in the given transaction and updates the versions
+// like recordChange
+func writeChange(tx *gorm.DB, record models.AuditRecord, before, after *models.Product) error {
+	if err := tx.Create(&record).Error; err != nil {
+		return err
+	}
+
+	validTo, version := versionTransition(before, after)
+	if validTo != nil {
+		err := tx.Model(&models.ProductVersion{}).Where("product_id = ? AND valid_to IS NULL", record.ProductID).
+			Update("valid_to", *validTo).Error
+		if err != nil {
+			return err
+		}
+	}
+	if version == nil {
+		return nil
+	}
+	return tx.Create(version).Error
+}
+
+// findForChange reads the product a change applies to inside a transaction, including products in the trash
+// when unscoped, and checks that it is still at the expected version unless that is 0
+func findForChange(tx *gorm.DB, id uint64, expectedVersion uint, unscoped bool) (*models.Product, error) {
+	query := tx
+	if unscoped {
+		query = query.Unscoped()
+	}
+
+	var row productWithTags
+	if err := query.Model(&models.Product{}).Scopes(tagsScope).First(&row, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrProductNotFound
+		}
+		return nil, err
+	}
+	product := row.product()
+	if expectedVersion != 0 && product.Version != expectedVersion {
+		return nil, ErrVersionConflict
+	}
+	return &product, nil
+}
+
+// productWithTags is a product read along with its tags, selected by tagsScope
+type productWithTags struct {
+	models.Product
+	TagList *string // Comma-separated tags, nil when the product has none
+}
+
+// product returns the product with its sorted tags
+func (row productWithTags) product() models.Product {
+	product := row.Product
+	product.Tags = []string{}
+	if row.TagList != nil && *row.TagList != "" {
+		product.Tags = strings.Split(*row.TagList, ",")
+		slices.Sort(product.Tags)
+	}
+	return product
+}
+
+// taggedProducts returns the products of the rows with their tags
+func taggedProducts(rows []productWithTags) []models.Product {
+	products := make([]models.Product, len(rows))
+	for i, row := range rows {
+		products[i] = row.product()
+	}
+	return products
+}
+
+// tagsColumn aggregates the tags of every product into a comma-separated tag_list column,
+// in the same query as the product so that streamed rows need no other query
+func tagsColumn(db *gorm.DB) string {
+	aggregate := "group_concat(tag, ',')"
+	if db.Dialector.Name() == "postgres" {
+		aggregate = "string_agg(tag, ',')"
+	}
+	return "(SELECT " + aggregate + " FROM product_tags WHERE product_tags.product_id = products.id) AS tag_list"
+}
+
+// tagsScope selects the tags of the products along with their columns, to be read into productWithTags
+func tagsScope(db *gorm.DB) *gorm.DB {
+	return db.Select("products.*, " + tagsColumn(db))
+}
+
+// listTagsScope selects the tags of the listed products like tagsScope, past products already carry the tags
+// of their version in the tag_list column of asOfQuery
+func listTagsScope(filter ProductFilter) func(*gorm.DB) *gorm.DB {
+	if filter.AsOf != nil {
+		return func(db *gorm.DB) *gorm.DB {
+			return db.Select("products.*")
+		}
+	}
+	return tagsScope
+}
+
+// saveTags replaces the tags of a product with the given normalized tags
+func saveTags(tx *gorm.DB, productID uint, tags []string) error {
+	if err := tx.Where("product_id = ?", productID).Delete(&models.ProductTag{}).Error; err != nil {
+		return err
+	}
+	if len(tags) == 0 {
+		return nil
+	}
+
+	rows := make([]models.ProductTag, len(tags))
+	for i, tag := range tags {
+		rows[i] = models.ProductTag{ProductID: productID, Tag: tag}
+	}
+	return tx.Create(&rows).Error
+}
+
+// filterScope translates a ProductFilter into WHERE conditions
+func filterScope(filter ProductFilter) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if filter.AsOf != nil {
+			db = db.Unscoped().Table("(?) AS products", asOfQuery(db, *filter.AsOf))
+		}
+		if filter.Trashed {
+			db = db.Unscoped().Where("deleted_at IS NOT NULL")
+		}
+		if filter.IDs != nil {
+			db = db.Where("id IN ?", filter.IDs)
+		}
+		if filter.Names != nil {
+			db = db.Where("name IN ?", filter.Names)
+		}
+		if filter.CategoryIDs != nil {
+			db = db.Where("id IN (SELECT product_id FROM product_categories WHERE category_id IN ?)", filter.CategoryIDs)
+		}
+		if filter.Tags != nil && filter.AsOf != nil {
+			db = db.Where(tagListCondition(filter.Tags, filter.AllTags))
+		} else if filter.Tags != nil && filter.AllTags {
+			db = db.Where("id IN (SELECT product_id FROM product_tags WHERE tag IN ? GROUP BY product_id HAVING COUNT(*) = ?)",
+				filter.Tags, len(filter.Tags))
+		} else if filter.Tags != nil {
+			db = db.Where("id IN (SELECT product_id FROM product_tags WHERE tag IN ?)", filter.Tags)
+		}
+		if filter.Type != "" {
+			db = db.Where("type = ?", filter.Type)
+		}
+		for _, condition := range filter.Attributes {
+			db = db.Where(attributeCondition(db, condition))
+		}
+		if filter.Name != "" {
+			db = db.Where(`LOWER(name) LIKE ? ESCAPE '\'`, likePattern(filter.Name))
+		}
+		if filter.Description != "" {
+			db = db.Where(`LOWER(description) LIKE ? ESCAPE '\'`, likePattern(filter.Description))
+		}
+		if filter.MinPrice != nil {
+			db = db.Where("price >= ?", *filter.MinPrice)
+		}
+		if filter.MaxPrice != nil {
+			db = db.Where("price <= ?", *filter.MaxPrice)
+		}
+		if filter.CreatedAfter != nil {
+			db = db.Where("created_at > ?", *filter.CreatedAfter)
+		}
+		if filter.CreatedBefore != nil {
+			db = db.Where("created_at < ?", *filter.CreatedBefore)
+		}
+		if filter.UpdatedSince != nil {
+			db = db.Where("updated_at >= ?", *filter.UpdatedSince)
+		}
+		return db
+	}
+}
+
+// asOfQuery selects the version of every product that was valid at the given time as rows of the products table,
+// created when their first version became valid and never deleted
+func asOfQuery(db *gorm.DB, asOf time.Time) *gorm.DB {
+	asOf = asOf.UTC()
+	// Join the first version rather than selecting its time in a subquery, which SQLite would return as text
+	tagList := "(SELECT group_concat(value, ',') FROM json_each(v.tags))"
+	if db.Dialector.Name() == "postgres" {
+		tagList = "(SELECT string_agg(value, ',') FROM jsonb_array_elements_text(v.tags))"
+	}
+	return db.Session(&gorm.Session{NewDB: true}).Table("product_versions AS v").
+		Select(`v.product_id AS id, v.name, v.description, v.price, v.type, v.attributes, v.version,
+			v1.valid_from AS created_at, v.valid_from AS updated_at, NULL AS deleted_at, `+tagList+` AS tag_list`).
+		Joins(`JOIN product_versions v1 ON v1.product_id = v.product_id
+			AND v1.version = (SELECT MIN(version) FROM product_versions WHERE product_id = v.product_id)`).
+		Where("v.valid_from <= ? AND (v.valid_to IS NULL OR v.valid_to > ?)", asOf, asOf)
+}
+
+// tagListCondition matches the rows of asOfQuery having any or all of the tags in their comma-separated tag_list
+func tagListCondition(tags []string, all bool) clause.Expression {
+	conditions := make([]clause.Expression, len(tags))
+	for i, tag := range tags {
+		pattern := "%," + strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(tag) + ",%"
+		conditions[i] = gorm.Expr(`',' || COALESCE(tag_list, '') || ',' LIKE ? ESCAPE '\'`, pattern)
+	}
+	if all {
+		return clause.And(conditions...)
+	}
+	return clause.Or(conditions...)
+}
+
+// attributeCondition returns the SQL condition of an attribute filter, comparing the attribute as text when it is
+// a string or a boolean and as a number when it is numeric, like AttributeCondition.Matches
+func attributeCondition(db *gorm.DB, condition AttributeCondition) clause.Expr {
+	// The CASE expressions only read the value once its JSON type is known, so that the casts never fail
+	path := `$."` + condition.Name + `"`
+	text := gorm.Expr(`CASE json_type(attributes, ?) WHEN 'text' THEN json_extract(attributes, ?)
+		WHEN 'true' THEN 'true' WHEN 'false' THEN 'false' END`, path, path)
+	number := gorm.Expr(`CASE WHEN json_type(attributes, ?) IN ('integer', 'real') THEN json_extract(attributes, ?) END`, path, path)
+	if db.Dialector.Name() == "postgres" {
+		text = gorm.Expr(`CASE WHEN jsonb_typeof(attributes -> CAST(? AS TEXT)) IN ('string', 'boolean')
+			THEN attributes ->> CAST(? AS TEXT) END`, condition.Name, condition.Name)
+		number = gorm.Expr(`CASE WHEN jsonb_typeof(attributes -> CAST(? AS TEXT)) = 'number'
+			THEN CAST(attributes ->> CAST(? AS TEXT) AS NUMERIC) END`, condition.Name, condition.Name)
+	}
+
+	equals := gorm.Expr("? = ?", text, condition.Value)
+	if condition.Number != nil {
+		equals = gorm.Expr("(? = ? OR ? = ?)", text, condition.Value, number, *condition.Number)
+	}
+	switch condition.Operator {
+	case AttributeEq:
+		return equals
+	case AttributeNe:
+		return gorm.Expr("NOT COALESCE(?, FALSE)", equals)
+	}
+
+	operators := map[string]string{AttributeGt: ">", AttributeGte: ">=", AttributeLt: "<", AttributeLte: "<="}
+	if condition.Number == nil || operators[condition.Operator] == "" {
+		return gorm.Expr("1 = 0")
+	}
+	return gorm.Expr("? "+operators[condition.Operator]+" ?", number, *condition.Number)
+}
+
+// limitScope limits the number of rows returned, if the limit is positive
+func limitScope(limit int) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		if limit <= 0 {
+			return db
+		}
+		return db.Limit(limit)
+	}
+}
+
+// sortScope orders the query by the given fields, using the ID as tiebreaker
+func sortScope(fields []SortField) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		for _, field := range withTiebreaker(fields) {
+			db = db.Order(clause.OrderByColumn{Column: clause.Column{Name: field.Field}, Desc: field.Desc})
+		}
+		return db
+	}
+}
+
+// keysetScope keeps only the products that come after the key in the order of the fields,
+// expanding (a, b) > (x, y) into a > x OR (a = x AND b > y) so that each field can have its own direction
+func keysetScope(fields []SortField, key models.Product) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		var conditions []clause.Expression
+		for i, field := range fields {
+			var and []clause.Expression
+			for _, previous := range fields[:i] {
+				and = append(and, clause.Eq{Column: clause.Column{Name: previous.Field}, Value: sortValue(key, previous.Field)})
+			}
+			column, value := clause.Column{Name: field.Field}, sortValue(key, field.Field)
+			if field.Desc {
+				and = append(and, clause.Lt{Column: column, Value: value})
+			} else {
+				and = append(and, clause.Gt{Column: column, Value: value})
+			}
+			conditions = append(conditions, clause.And(and...))
+		}
+		return db.Where(clause.Or(conditions...))
+	}
+}
+
+// likePattern builds a case-insensitive substring pattern, escaping the LIKE wildcards in the input
+func likePattern(substr string) string {
+	escaped := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(strings.ToLower(substr))
+	return "%" + escaped + "%"
+}
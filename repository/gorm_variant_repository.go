@@ -0,0 +1,142 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"gorm.io/gorm"
+	"products-api/models"
+)
+
+// GormVariantRepository is a VariantRepository backed by a GORM database
+type GormVariantRepository struct {
+	db *gorm.DB
+}
+
+// NewGormVariantRepository creates a VariantRepository using the given database connection
+func NewGormVariantRepository(db *gorm.DB) *GormVariantRepository {
+	return &GormVariantRepository{db: db}
+}
+
+func (r *GormVariantRepository) ListByProduct(ctx context.Context, productID uint64) ([]models.Variant, error) {
+	return listVariants(r.db.WithContext(ctx), productID)
+}
+
+func (r *GormVariantRepository) Get(ctx context.Context, productID uint64, id uint64) (*models.Variant, error) {
+	return findVariant(r.db.WithContext(ctx), productID, id)
+}
+
+func (r *GormVariantRepository) Create(ctx context.Context, product *models.Product, variant *models.Variant) error {
+	normalizeVariant(variant)
+	return r.changeVariant(ctx, product, func(tx *gorm.DB) (*models.Variant, *models.Variant, error) {
+		variant.ID = 0
+		variant.ProductID = product.ID
+		if err := checkVariantInDB(tx, *variant); err != nil {
+			return nil, nil, err
+		}
+		if err := tx.Create(variant).Error; err != nil {
+			return nil, nil, err
+		}
+		return nil, variant, nil
+	})
+}
+
+func (r *GormVariantRepository) Update(ctx context.Context, product *models.Product, variant *models.Variant) error {
+	normalizeVariant(variant)
+	return r.changeVariant(ctx, product, func(tx *gorm.DB) (*models.Variant, *models.Variant, error) {
+		stored, err := findVariant(tx, uint64(product.ID), uint64(variant.ID))
+		if err != nil {
+			return nil, nil, err
+		}
+		variant.ProductID = stored.ProductID
+		variant.CreatedAt = stored.CreatedAt
+		if err := checkVariantInDB(tx, *variant); err != nil {
+			return nil, nil, err
+		}
+		err = tx.Model(variant).Select("sku", "options", "price", "attributes", "updated_at").Updates(variant).Error
+		return stored, variant, err
+	})
+}
+
+func (r *GormVariantRepository) Delete(ctx context.Context, product *models.Product, id uint64) error {
+	return r.changeVariant(ctx, product, func(tx *gorm.DB) (*models.Variant, *models.Variant, error) {
+		stored, err := findVariant(tx, uint64(product.ID), id)
+		if err != nil {
+			return nil, nil, err
+		}
+		return stored, nil, tx.Delete(&models.Variant{}, id).Error
+	})
+}
+
+// changeVariant runs the change of a variant of the product in a transaction, which increments the version
+// of the product if it is still at the version it was read at and records the change in the audit log.
+// The change returns the variant before and after it, and the product is only updated once it is committed
+func (r *GormVariantRepository) changeVariant(ctx context.Context, product *models.Product,
+	change func(tx *gorm.DB) (*models.Variant, *models.Variant, error)) error {
+	var after models.Product
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		before, err := findForChange(tx, uint64(product.ID), product.Version, false)
+		if err != nil {
+			return err
+		}
+
+		after = *before
+		after.Version++
+		after.UpdatedAt = tx.NowFunc()
+		result := tx.Model(&models.Product{}).Where("id = ? AND version = ?", before.ID, before.Version).
+			UpdateColumns(map[string]interface{}{"version": after.Version, "updated_at": after.UpdatedAt})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected != 1 {
+			return ErrVersionConflict
+		}
+
+		beforeVariant, afterVariant, err := change(tx)
+		if err != nil {
+			return err
+		}
+		return writeChange(tx, variantAuditRecord(ctx, before, &after, beforeVariant, afterVariant), before, &after)
+	})
+	if err == nil {
+		*product = after
+	}
+	return err
+}
+
+// listVariants reads the variants of a product in creation order
+func listVariants(db *gorm.DB, productID uint64) ([]models.Variant, error) {
+	variants := []models.Variant{}
+	err := db.Where("product_id = ?", productID).Order("id").Find(&variants).Error
+	return variants, err
+}
+
+// findVariant reads the variant of a product with the given ID, returning ErrVariantNotFound when it does not exist
+func findVariant(db *gorm.DB, productID uint64, id uint64) (*models.Variant, error) {
+	var variant models.Variant
+	if err := db.Where("product_id = ?", productID).First(&variant, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrVariantNotFound
+		}
+		return nil, err
+	}
+	return &variant, nil
+}
+
+// checkVariantInDB checks a new or changed variant against the other variants, whose SKUs it must not reuse,
+// and against the other variants of its product
+func checkVariantInDB(tx *gorm.DB, variant models.Variant) error {
+	var sameSKU int64
+	err := tx.Model(&models.Variant{}).Where("sku = ? AND id <> ?", variant.SKU, variant.ID).Count(&sameSKU).Error
+	if err != nil {
+		return err
+	}
+	if sameSKU > 0 {
+		return ErrDuplicateSKU
+	}
+
+	others, err := listVariants(tx, uint64(variant.ProductID))
+	if err != nil {
+		return err
+	}
+	return checkVariant(variant, others)
+}
@@ -0,0 +1,20 @@
+package repository
+
+import (
+	"context"
+	"products-api/models"
+	"time"
+)
+
+// IdempotencyRepository stores the responses of requests sent with an Idempotency-Key header
+type IdempotencyRepository interface {
+	// Begin claims the key of the record, which must have no status yet, and returns nil,
+	// or returns the existing record when the key is already claimed and has not expired
+	Begin(ctx context.Context, record models.IdempotencyRecord) (*models.IdempotencyRecord, error)
+	// Complete stores the response of the request that claimed the key
+	Complete(ctx context.Context, key string, statusCode int, headers string, body []byte) error
+	// Release removes the key so that the request can be retried
+	Release(ctx context.Context, key string) error
+	// DeleteExpired removes the records that expired before the given time
+	DeleteExpired(ctx context.Context, before time.Time) (int64, error)
+}
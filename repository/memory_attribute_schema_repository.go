@@ -0,0 +1,131 @@
+package repository
+
+import (
+	"context"
+	"products-api/models"
+	"slices"
+	"time"
+)
+
+// MemoryAttributeSchemaRepository is an AttributeSchemaRepository keeping the schemas in a MemoryCategoryRepository,
+// so that deleting a category removes its schema
+type MemoryAttributeSchemaRepository struct {
+	categories *MemoryCategoryRepository // Shares the lock of its products
+	nextID     uint
+}
+
+// NewMemoryAttributeSchemaRepository creates an empty AttributeSchemaRepository checking schemas against the given categories
+func NewMemoryAttributeSchemaRepository(categories *MemoryCategoryRepository) *MemoryAttributeSchemaRepository {
+	return &MemoryAttributeSchemaRepository{categories: categories, nextID: 1}
+}
+
+// Reset removes every schema and restarts the ID sequence
+func (r *MemoryAttributeSchemaRepository) Reset() {
+	defer r.categories.products.lock()()
+
+	r.nextID = 1
+	r.categories.attributeSchemas = make(map[uint]models.AttributeSchema)
+}
+
+// sorted returns the schemas matching the predicate in creation order, the caller must hold the lock
+func (r *MemoryAttributeSchemaRepository) sorted(match func(schema models.AttributeSchema) bool) []models.AttributeSchema {
+	schemas := []models.AttributeSchema{}
+	for _, schema := range r.categories.attributeSchemas {
+		if match(schema) {
+			schemas = append(schemas, schema)
+		}
+	}
+	slices.SortFunc(schemas, func(a, b models.AttributeSchema) int { return int(a.ID) - int(b.ID) })
+	return schemas
+}
+
+func (r *MemoryAttributeSchemaRepository) List(_ context.Context, offset, limit int) ([]models.AttributeSchema, int64, error) {
+	defer r.categories.products.rlock()()
+
+	schemas := r.sorted(func(models.AttributeSchema) bool { return true })
+	total := int64(len(schemas))
+
+	if offset >= len(schemas) {
+		return []models.AttributeSchema{}, total, nil
+	}
+	end := len(schemas)
+	if limit > 0 && offset+limit < end {
+		end = offset + limit
+	}
+	return schemas[offset:end], total, nil
+}
+
+func (r *MemoryAttributeSchemaRepository) Get(_ context.Context, id uint64) (*models.AttributeSchema, error) {
+	defer r.categories.products.rlock()()
+
+	schema, ok := r.categories.attributeSchemas[uint(id)]
+	if !ok {
+		return nil, ErrAttributeSchemaNotFound
+	}
+	return &schema, nil
+}
+
+// check checks that the category of a new or changed schema exists and that no other schema applies
+// to the same product type or category, the caller must hold the lock
+func (r *MemoryAttributeSchemaRepository) check(schema models.AttributeSchema) error {
+	if schema.CategoryID != nil {
+		if _, ok := r.categories.categories[*schema.CategoryID]; !ok {
+			return ErrSchemaCategoryNotFound
+		}
+	}
+	for _, other := range r.categories.attributeSchemas {
+		if other.ID != schema.ID && sameSchemaTarget(other, schema) {
+			return ErrDuplicateAttributeSchema
+		}
+	}
+	return nil
+}
+
+func (r *MemoryAttributeSchemaRepository) Create(_ context.Context, schema *models.AttributeSchema) error {
+	defer r.categories.products.lock()()
+
+	schema.ID = 0
+	if err := r.check(*schema); err != nil {
+		return err
+	}
+
+	schema.ID = r.nextID
+	r.nextID++
+	schema.CreatedAt = time.Now()
+	schema.UpdatedAt = schema.CreatedAt
+	r.categories.attributeSchemas[schema.ID] = *schema
+	return nil
+}
+
+func (r *MemoryAttributeSchemaRepository) Update(_ context.Context, schema *models.AttributeSchema) error {
+	defer r.categories.products.lock()()
+
+	stored, ok := r.categories.attributeSchemas[schema.ID]
+	if !ok {
+		return ErrAttributeSchemaNotFound
+	}
+	if err := r.check(*schema); err != nil {
+		return err
+	}
+
+	schema.CreatedAt = stored.CreatedAt
+	schema.UpdatedAt = time.Now()
+	r.categories.attributeSchemas[schema.ID] = *schema
+	return nil
+}
+
+func (r *MemoryAttributeSchemaRepository) Delete(_ context.Context, id uint64) error {
+	defer r.categories.products.lock()()
+
+	if _, ok := r.categories.attributeSchemas[uint(id)]; !ok {
+		return ErrAttributeSchemaNotFound
+	}
+	delete(r.categories.attributeSchemas, uint(id))
+	return nil
+}
+
+func (r *MemoryAttributeSchemaRepository) ListApplicable(_ context.Context, productType string, categoryIDs []uint) ([]models.AttributeSchema, error) {
+	defer r.categories.products.rlock()()
+
+	return r.sorted(func(schema models.AttributeSchema) bool { return schemaApplies(schema, productType, categoryIDs) }), nil
+}
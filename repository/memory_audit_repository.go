@@ -0,0 +1,34 @@
+package repository
+
+import (
+	"context"
+	"products-api/models"
+)
+
+// MemoryAuditRepository is an AuditRepository reading the audit log of a MemoryProductRepository
+type MemoryAuditRepository struct {
+	products *MemoryProductRepository
+}
+
+// NewMemoryAuditRepository creates an AuditRepository over the changes made to the given in-memory products
+func NewMemoryAuditRepository(products *MemoryProductRepository) *MemoryAuditRepository {
+	return &MemoryAuditRepository{products: products}
+}
+
+func (r *MemoryAuditRepository) List(_ context.Context, opts AuditListOptions) ([]models.AuditRecord, int64, error) {
+	defer r.products.rlock()()
+
+	// The log is appended in ID order, so it is already sorted oldest first
+	records := []models.AuditRecord{}
+	var total int64
+	for _, record := range r.products.audit {
+		if !opts.Filter.Matches(record) {
+			continue
+		}
+		total++
+		if total > int64(opts.Offset) && (opts.Limit <= 0 || len(records) < opts.Limit) {
+			records = append(records, record)
+		}
+	}
+	return records, total, nil
+}
@@ -0,0 +1,230 @@
+package repository
+
+import (
+	"context"
+	"maps"
+	"products-api/models"
+	"slices"
+	"strings"
+	"time"
+)
+
+// MemoryCategoryRepository is a CategoryRepository keeping the categories in memory, next to the links
+// it stores in a MemoryProductRepository so that purging a product removes them
+type MemoryCategoryRepository struct {
+	products   *MemoryProductRepository // Shares its lock
+	categories map[uint]models.Category
+	nextID     uint
+
+	attributeSchemas map[uint]models.AttributeSchema // Managed by MemoryAttributeSchemaRepository
+}
+
+// NewMemoryCategoryRepository creates an empty CategoryRepository linking categories to the given in-memory products
+func NewMemoryCategoryRepository(products *MemoryProductRepository) *MemoryCategoryRepository {
+	return &MemoryCategoryRepository{
+		products:   products,
+		categories: make(map[uint]models.Category),
+		nextID:     1,
+
+		attributeSchemas: make(map[uint]models.AttributeSchema),
+	}
+}
+
+// Reset removes every category, link and category schema and restarts the ID sequence
+func (r *MemoryCategoryRepository) Reset() {
+	defer r.products.lock()()
+
+	r.categories = make(map[uint]models.Category)
+	r.nextID = 1
+	r.products.productCategories = make(map[uint][]uint)
+	maps.DeleteFunc(r.attributeSchemas, func(_ uint, schema models.AttributeSchema) bool { return schema.CategoryID != nil })
+}
+
+// sorted returns the categories matching the predicate in tree order, the caller must hold the lock
+func (r *MemoryCategoryRepository) sorted(match func(category models.Category) bool) []models.Category {
+	categories := []models.Category{}
+	for _, category := range r.categories {
+		if match(category) {
+			categories = append(categories, category)
+		}
+	}
+	slices.SortFunc(categories, func(a, b models.Category) int { return strings.Compare(a.Path, b.Path) })
+	return categories
+}
+
+func (r *MemoryCategoryRepository) Get(_ context.Context, id uint64) (*models.Category, error) {
+	defer r.products.rlock()()
+
+	category, ok := r.categories[uint(id)]
+	if !ok {
+		return nil, ErrCategoryNotFound
+	}
+	return &category, nil
+}
+
+func (r *MemoryCategoryRepository) List(_ context.Context, opts CategoryListOptions) ([]models.Category, int64, error) {
+	defer r.products.rlock()()
+
+	categories := r.sorted(func(category models.Category) bool {
+		return opts.ParentID == nil || sameParent(category.ParentID, opts.ParentID)
+	})
+	total := int64(len(categories))
+
+	if opts.Offset >= len(categories) {
+		return []models.Category{}, total, nil
+	}
+	end := len(categories)
+	if opts.Limit > 0 && opts.Offset+opts.Limit < end {
+		end = opts.Offset + opts.Limit
+	}
+	return categories[opts.Offset:end], total, nil
+}
+
+// parent returns the parent a category is placed below, which is nil for root categories,
+// the caller must hold the lock
+func (r *MemoryCategoryRepository) parent(parentID *uint) (*models.Category, error) {
+	if parentID == nil {
+		return nil, nil
+	}
+	parent, ok := r.categories[*parentID]
+	if !ok {
+		return nil, ErrParentCategoryNotFound
+	}
+	return &parent, nil
+}
+
+func (r *MemoryCategoryRepository) Create(_ context.Context, category *models.Category) error {
+	defer r.products.lock()()
+
+	parent, err := r.parent(category.ParentID)
+	if err != nil {
+		return err
+	}
+
+	category.ID = r.nextID
+	r.nextID++
+	category.Path = models.CategoryPath(parent, category.ID)
+	category.CreatedAt = time.Now()
+	category.UpdatedAt = category.CreatedAt
+	r.categories[category.ID] = *category
+	return nil
+}
+
+func (r *MemoryCategoryRepository) Update(_ context.Context, category *models.Category) error {
+	defer r.products.lock()()
+
+	stored, ok := r.categories[category.ID]
+	if !ok {
+		return ErrCategoryNotFound
+	}
+
+	category.Path = stored.Path
+	category.CreatedAt = stored.CreatedAt
+	if !sameParent(stored.ParentID, category.ParentID) {
+		parent, err := r.parent(category.ParentID)
+		if err != nil {
+			return err
+		}
+		if parent != nil && parent.IsDescendantOf(stored) {
+			return ErrCategoryCycle
+		}
+
+		// Replace the old path of the category at the start of the paths of its descendants
+		category.Path = models.CategoryPath(parent, category.ID)
+		for id, descendant := range r.categories {
+			if id != stored.ID && descendant.IsDescendantOf(stored) {
+				descendant.Path = category.Path + strings.TrimPrefix(descendant.Path, stored.Path)
+				r.categories[id] = descendant
+			}
+		}
+	}
+
+	category.UpdatedAt = time.Now()
+	r.categories[category.ID] = *category
+	return nil
+}
+
+func (r *MemoryCategoryRepository) Delete(_ context.Context, id uint64) error {
+	defer r.products.lock()()
+
+	if _, ok := r.categories[uint(id)]; !ok {
+		return ErrCategoryNotFound
+	}
+	for _, category := range r.categories {
+		if category.ParentID != nil && *category.ParentID == uint(id) {
+			return ErrCategoryHasChildren
+		}
+	}
+
+	for productID, categoryIDs := range r.products.productCategories {
+		r.unlink(productID, categoryIDs, uint(id))
+	}
+	maps.DeleteFunc(r.attributeSchemas, func(_ uint, schema models.AttributeSchema) bool {
+		return schema.CategoryID != nil && *schema.CategoryID == uint(id)
+	})
+	delete(r.categories, uint(id))
+	return nil
+}
+
+func (r *MemoryCategoryRepository) DescendantIDs(_ context.Context, id uint64) ([]uint, error) {
+	defer r.products.rlock()()
+
+	category, ok := r.categories[uint(id)]
+	if !ok {
+		return nil, ErrCategoryNotFound
+	}
+
+	descendants := r.sorted(func(descendant models.Category) bool { return descendant.IsDescendantOf(category) })
+	ids := make([]uint, len(descendants))
+	for i, descendant := range descendants {
+		ids[i] = descendant.ID
+	}
+	return ids, nil
+}
+
+func (r *MemoryCategoryRepository) LinkProducts(_ context.Context, id uint64, productIDs []uint) (int64, error) {
+	defer r.products.lock()()
+
+	if _, ok := r.categories[uint(id)]; !ok {
+		return 0, ErrCategoryNotFound
+	}
+
+	var linked int64
+	for _, productID := range productIDs {
+		categoryIDs := r.products.productCategories[productID]
+		if !slices.Contains(categoryIDs, uint(id)) {
+			// Never append in place, the slice may be shared with a copy made by a product transaction
+			r.products.productCategories[productID] = append(slices.Clip(categoryIDs), uint(id))
+			linked++
+		}
+	}
+	return linked, nil
+}
+
+func (r *MemoryCategoryRepository) UnlinkProduct(_ context.Context, id uint64, productID uint64) error {
+	defer r.products.lock()()
+
+	categoryIDs := r.products.productCategories[uint(productID)]
+	if !slices.Contains(categoryIDs, uint(id)) {
+		return ErrProductNotInCategory
+	}
+	r.unlink(uint(productID), categoryIDs, uint(id))
+	return nil
+}
+
+// unlink removes a category from the categories of a product, the caller must hold the write lock
+func (r *MemoryCategoryRepository) unlink(productID uint, categoryIDs []uint, id uint) {
+	remaining := slices.DeleteFunc(slices.Clone(categoryIDs), func(categoryID uint) bool { return categoryID == id })
+	if len(remaining) == 0 {
+		delete(r.products.productCategories, productID)
+	} else {
+		r.products.productCategories[productID] = remaining
+	}
+}
+
+func (r *MemoryCategoryRepository) ListByProduct(_ context.Context, productID uint64) ([]models.Category, error) {
+	defer r.products.rlock()()
+
+	categoryIDs := r.products.productCategories[uint(productID)]
+	return r.sorted(func(category models.Category) bool { return slices.Contains(categoryIDs, category.ID) }), nil
+}
@@ -0,0 +1,78 @@
+package repository
+
+import (
+	"context"
+	"products-api/models"
+	"sync"
+	"time"
+)
+
+// MemoryIdempotencyRepository is a concurrency-safe IdempotencyRepository that keeps all records in memory
+type MemoryIdempotencyRepository struct {
+	mu      sync.Mutex
+	records map[string]models.IdempotencyRecord
+}
+
+// NewMemoryIdempotencyRepository creates an empty in-memory IdempotencyRepository
+func NewMemoryIdempotencyRepository() *MemoryIdempotencyRepository {
+	return &MemoryIdempotencyRepository{records: make(map[string]models.IdempotencyRecord)}
+}
+
+// Reset removes every record
+func (r *MemoryIdempotencyRepository) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.records = make(map[string]models.IdempotencyRecord)
+}
+
+func (r *MemoryIdempotencyRepository) Begin(_ context.Context, record models.IdempotencyRecord) (*models.IdempotencyRecord, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now().UTC()
+	if existing, ok := r.records[record.Key]; ok && existing.ExpiresAt.After(now) {
+		return &existing, nil
+	}
+
+	record.CreatedAt = now
+	r.records[record.Key] = record
+	return nil, nil
+}
+
+func (r *MemoryIdempotencyRepository) Complete(_ context.Context, key string, statusCode int, headers string, body []byte) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	record, ok := r.records[key]
+	if !ok {
+		return nil
+	}
+	record.StatusCode = statusCode
+	record.Headers = headers
+	record.Body = body
+	r.records[key] = record
+	return nil
+}
+
+func (r *MemoryIdempotencyRepository) Release(_ context.Context, key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.records, key)
+	return nil
+}
+
+func (r *MemoryIdempotencyRepository) DeleteExpired(_ context.Context, before time.Time) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var deleted int64
+	for key, record := range r.records {
+		if record.ExpiresAt.Before(before) {
+			delete(r.records, key)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
@@ -0,0 +1,449 @@
+package repository
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"gorm.io/gorm"
+	"maps"
+	"products-api/models"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MemoryProductRepository is a concurrency-safe ProductRepository that keeps all products in memory
+type MemoryProductRepository struct {
+	mu       *sync.RWMutex
+	inTx     bool // Set on the copy used inside a transaction, which already holds the write lock
+	products map[uint]models.Product
+	nextID   uint
+	audit    []models.AuditRecord // Append-only log of the changes, read by MemoryAuditRepository
+	versions []models.ProductVersion
+
+	productCategories map[uint][]uint           // IDs of the categories of every product, managed by MemoryCategoryRepository
+	productVariants   map[uint][]models.Variant // Variants of every product, managed by MemoryVariantRepository
+}
+
+// NewMemoryProductRepository creates an empty in-memory ProductRepository
+func NewMemoryProductRepository() *MemoryProductRepository {
+	return &MemoryProductRepository{
+		mu:                &sync.RWMutex{},
+		products:          make(map[uint]models.Product),
+		nextID:            1,
+		productCategories: make(map[uint][]uint),
+		productVariants:   make(map[uint][]models.Variant),
+	}
+}
+
+// lock acquires the write lock, unless running inside a transaction, and returns the function releasing it
+func (r *MemoryProductRepository) lock() func() {
+	if r.inTx {
+		return func() {}
+	}
+	r.mu.Lock()
+	return r.mu.Unlock
+}
+
+// rlock acquires the read lock, unless running inside a transaction, and returns the function releasing it
+func (r *MemoryProductRepository) rlock() func() {
+	if r.inTx {
+		return func() {}
+	}
+	r.mu.RLock()
+	return r.mu.RUnlock
+}
+
+// Transaction runs fn against a copy of the products that replaces the current ones only if fn succeeds,
+// holding the write lock meanwhile so that transactions are serializable
+func (r *MemoryProductRepository) Transaction(_ context.Context, fn func(repo ProductRepository) error) error {
+	defer r.lock()()
+
+	tx := &MemoryProductRepository{
+		mu:       r.mu,
+		inTx:     true,
+		products: make(map[uint]models.Product, len(r.products)),
+		nextID:   r.nextID,
+		// Limit the capacity so that appending inside the transaction never writes to the shared arrays
+		audit:    r.audit[:len(r.audit):len(r.audit)],
+		versions: r.versions[:len(r.versions):len(r.versions)],
+
+		productCategories: maps.Clone(r.productCategories),
+		productVariants:   maps.Clone(r.productVariants),
+	}
+	for id, product := range r.products {
+		tx.products[id] = product
+	}
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	r.products = tx.products
+	r.nextID = tx.nextID
+	r.audit = tx.audit
+	r.versions = tx.versions
+	r.productCategories = tx.productCategories
+	r.productVariants = tx.productVariants
+	return nil
+}
+
+// Reset removes every product, version, audit record, category link and variant and restarts the ID sequence
+func (r *MemoryProductRepository) Reset() {
+	defer r.lock()()
+
+	r.products = make(map[uint]models.Product)
+	r.nextID = 1
+	r.audit = nil
+	r.versions = nil
+	r.productCategories = make(map[uint][]uint)
+	r.productVariants = make(map[uint][]models.Variant)
+}
+
+// recordChange appends the audit record of a change, ends the validity of the current version when the change
+// supersedes, deletes or purges it, and snapshots the new version if there is one, the caller must hold the write lock
+func (r *MemoryProductRepository) recordChange(ctx context.Context, action string, before, after *models.Product) {
+	r.writeChange(newAuditRecord(ctx, action, before, after), before, after)
+}
+
+// writeChange appends the given audit record of a change and updates the versions like recordChange,
+// the caller must hold the write lock
+func (r *MemoryProductRepository) writeChange(record models.AuditRecord, before, after *models.Product) {
+	record.ID = uint(len(r.audit)) + 1
+	r.audit = append(r.audit, record)
+
+	validTo, version := versionTransition(before, after)
+	if validTo != nil {
+		// Inside a transaction the array is shared with the repository, which must be left intact on rollback
+		if r.inTx {
+			r.versions = slices.Clone(r.versions)
+		}
+		for i := range r.versions {
+			if r.versions[i].ProductID == record.ProductID && r.versions[i].ValidTo == nil {
+				r.versions[i].ValidTo = validTo
+			}
+		}
+	}
+	if version != nil {
+		r.versions = append(r.versions, *version)
+	}
+}
+
+// candidates returns the stored products, or the products as they were at the time of the filter if it has one,
+// the caller must hold the lock
+func (r *MemoryProductRepository) candidates(filter ProductFilter) map[uint]models.Product {
+	if filter.AsOf == nil {
+		return r.products
+	}
+
+	products := make(map[uint]models.Product)
+	createdAt := make(map[uint]time.Time)
+	for _, version := range r.versions {
+		if _, ok := createdAt[version.ProductID]; !ok {
+			createdAt[version.ProductID] = version.ValidFrom
+		}
+		if version.ValidAt(*filter.AsOf) {
+			products[version.ProductID] = version.Product()
+		}
+	}
+	for id, product := range products {
+		product.CreatedAt = createdAt[id]
+		normalizeProduct(&product)
+		products[id] = product
+	}
+	return products
+}
+
+// matches reports whether the product satisfies the filter, including the conditions on its categories,
+// the caller must hold the lock
+func (r *MemoryProductRepository) matches(filter ProductFilter, product models.Product) bool {
+	if !filter.Matches(product) {
+		return false
+	}
+	return filter.CategoryIDs == nil || slices.ContainsFunc(r.productCategories[product.ID], func(id uint) bool {
+		return slices.Contains(filter.CategoryIDs, id)
+	})
+}
+
+func (r *MemoryProductRepository) Get(_ context.Context, id uint64) (*models.Product, error) {
+	defer r.rlock()()
+
+	product, ok := r.products[uint(id)]
+	if !ok || product.DeletedAt.Valid {
+		return nil, ErrProductNotFound
+	}
+	return &product, nil
+}
+
+func (r *MemoryProductRepository) List(_ context.Context, opts ListOptions) ([]models.Product, error) {
+	defer r.rlock()()
+
+	products := make([]models.Product, 0, len(r.products))
+	for _, product := range r.candidates(opts.Filter) {
+		if r.matches(opts.Filter, product) {
+			products = append(products, product)
+		}
+	}
+	sortProducts(products, opts.Sort)
+
+	if opts.Keyset != nil {
+		return keysetPage(products, opts.Sort, *opts.Keyset, opts.Limit), nil
+	}
+
+	if opts.Offset >= len(products) {
+		return []models.Product{}, nil
+	}
+	end := len(products)
+	if opts.Limit > 0 && opts.Offset+opts.Limit < end {
+		end = opts.Offset + opts.Limit
+	}
+	return products[opts.Offset:end], nil
+}
+
+func (r *MemoryProductRepository) Each(ctx context.Context, opts ListOptions, fn func(product models.Product) error) error {
+	// Iterate over a snapshot so that fn runs without holding the lock
+	products, err := r.List(ctx, ListOptions{Filter: opts.Filter, Sort: opts.Sort, Offset: opts.Offset, Limit: opts.Limit})
+	if err != nil {
+		return err
+	}
+
+	for _, product := range products {
+		if err := fn(product); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *MemoryProductRepository) Count(_ context.Context, filter ProductFilter) (int64, error) {
+	defer r.rlock()()
+
+	var total int64
+	for _, product := range r.candidates(filter) {
+		if r.matches(filter, product) {
+			total++
+		}
+	}
+	return total, nil
+}
+
+func (r *MemoryProductRepository) Search(_ context.Context, opts SearchOptions) ([]SearchResult, int64, error) {
+	defer r.rlock()()
+
+	products := make([]models.Product, 0, len(r.products))
+	for _, product := range r.products {
+		if !product.DeletedAt.Valid {
+			products = append(products, product)
+		}
+	}
+
+	results, total := searchProducts(products, opts)
+	return results, total, nil
+}
+
+func (r *MemoryProductRepository) Create(ctx context.Context, product *models.Product) error {
+	defer r.lock()()
+
+	return r.create(ctx, product)
+}
+
+func (r *MemoryProductRepository) CreateBatch(ctx context.Context, products []models.Product) error {
+	defer r.lock()()
+
+	// Keep the previous state to roll back to if any product fails
+	nextID, auditLen, versionsLen := r.nextID, len(r.audit), len(r.versions)
+	for i := range products {
+		if err := r.create(ctx, &products[i]); err != nil {
+			for _, created := range products[:i] {
+				delete(r.products, created.ID)
+			}
+			r.nextID = nextID
+			r.audit = r.audit[:auditLen]
+			r.versions = r.versions[:versionsLen]
+			return err
+		}
+	}
+	return nil
+}
+
+// create stores a product, the caller must hold the write lock
+func (r *MemoryProductRepository) create(ctx context.Context, product *models.Product) error {
+	// Assign the next ID unless one was provided, like an auto-increment column
+	if product.ID == 0 {
+		product.ID = r.nextID
+	}
+	if _, exists := r.products[product.ID]; exists {
+		return fmt.Errorf("product with ID %d already exists", product.ID)
+	}
+	if product.ID >= r.nextID {
+		r.nextID = product.ID + 1
+	}
+
+	now := time.Now()
+	normalizeProduct(product)
+	product.Version = 1
+	product.DeletedAt = gorm.DeletedAt{}
+	product.CreatedAt = now
+	product.UpdatedAt = now
+	r.products[product.ID] = *product
+	r.recordChange(ctx, models.AuditActionCreate, nil, product)
+	return nil
+}
+
+func (r *MemoryProductRepository) Update(ctx context.Context, product *models.Product) error {
+	defer r.lock()()
+
+	stored, ok := r.products[product.ID]
+	if !ok || stored.DeletedAt.Valid {
+		return ErrProductNotFound
+	}
+	if stored.Version != product.Version {
+		return ErrVersionConflict
+	}
+
+	normalizeProduct(product)
+	product.Version++
+	product.UpdatedAt = time.Now()
+	r.products[product.ID] = *product
+	r.recordChange(ctx, models.AuditActionUpdate, &stored, product)
+	return nil
+}
+
+func (r *MemoryProductRepository) Delete(ctx context.Context, id uint64, expectedVersion uint) error {
+	defer r.lock()()
+
+	stored, ok := r.products[uint(id)]
+	if !ok || stored.DeletedAt.Valid {
+		return ErrProductNotFound
+	}
+	if expectedVersion != 0 && stored.Version != expectedVersion {
+		return ErrVersionConflict
+	}
+
+	// Keep the product in the trash like a soft delete
+	deleted := stored
+	deleted.DeletedAt = gorm.DeletedAt{Time: time.Now(), Valid: true}
+	r.products[uint(id)] = deleted
+	r.recordChange(ctx, models.AuditActionDelete, &stored, &deleted)
+	return nil
+}
+
+func (r *MemoryProductRepository) Restore(ctx context.Context, id uint64) (*models.Product, error) {
+	defer r.lock()()
+
+	stored, ok := r.products[uint(id)]
+	if !ok || !stored.DeletedAt.Valid {
+		return nil, ErrProductNotFound
+	}
+
+	restored := stored
+	restored.DeletedAt = gorm.DeletedAt{}
+	restored.Version++
+	restored.UpdatedAt = time.Now()
+	r.products[uint(id)] = restored
+	r.recordChange(ctx, models.AuditActionRestore, &stored, &restored)
+	return &restored, nil
+}
+
+func (r *MemoryProductRepository) Purge(ctx context.Context, id uint64, expectedVersion uint) error {
+	defer r.lock()()
+
+	stored, ok := r.products[uint(id)]
+	if !ok {
+		return ErrProductNotFound
+	}
+	if expectedVersion != 0 && stored.Version != expectedVersion {
+		return ErrVersionConflict
+	}
+	delete(r.products, uint(id))
+	delete(r.productCategories, uint(id))
+	delete(r.productVariants, uint(id))
+	r.recordChange(ctx, models.AuditActionPurge, &stored, nil)
+	return nil
+}
+
+func (r *MemoryProductRepository) PurgeDeleted(ctx context.Context, before time.Time) (int64, error) {
+	defer r.lock()()
+
+	var expired []models.Product
+	for _, product := range r.products {
+		if product.DeletedAt.Valid && product.DeletedAt.Time.Before(before) {
+			expired = append(expired, product)
+		}
+	}
+
+	// Record the purges in ID order, like the database implementation
+	sortProducts(expired, nil)
+	for i := range expired {
+		delete(r.products, expired[i].ID)
+		delete(r.productCategories, expired[i].ID)
+		delete(r.productVariants, expired[i].ID)
+		r.recordChange(ctx, models.AuditActionPurge, &expired[i], nil)
+	}
+	return int64(len(expired)), nil
+}
+
+func (r *MemoryProductRepository) ListTags(_ context.Context, offset, limit int) ([]TagCount, int64, error) {
+	defer r.rlock()()
+
+	counts := make(map[string]int64)
+	for _, product := range r.products {
+		if product.DeletedAt.Valid {
+			continue
+		}
+		for _, tag := range product.Tags {
+			counts[tag]++
+		}
+	}
+
+	tags := make([]TagCount, 0, len(counts))
+	for tag, count := range counts {
+		tags = append(tags, TagCount{Tag: tag, Count: count})
+	}
+	slices.SortFunc(tags, func(a, b TagCount) int {
+		if a.Count != b.Count {
+			return cmp.Compare(b.Count, a.Count)
+		}
+		return strings.Compare(a.Tag, b.Tag)
+	})
+
+	total := int64(len(tags))
+	if offset >= len(tags) {
+		return []TagCount{}, total, nil
+	}
+	end := len(tags)
+	if limit > 0 && offset+limit < end {
+		end = offset + limit
+	}
+	return tags[offset:end], total, nil
+}
+
+func (r *MemoryProductRepository) ListVersions(_ context.Context, id uint64, offset, limit int) ([]models.ProductVersion, int64, error) {
+	defer r.rlock()()
+
+	// Versions are appended in order, so those of a product are already sorted oldest first
+	versions := []models.ProductVersion{}
+	var total int64
+	for _, version := range r.versions {
+		if version.ProductID != uint(id) {
+			continue
+		}
+		total++
+		if total > int64(offset) && (limit <= 0 || len(versions) < limit) {
+			versions = append(versions, version)
+		}
+	}
+	return versions, total, nil
+}
+
+func (r *MemoryProductRepository) GetVersion(_ context.Context, id uint64, version uint) (*models.ProductVersion, error) {
+	defer r.rlock()()
+
+	for _, productVersion := range r.versions {
+		if productVersion.ProductID == uint(id) && productVersion.Version == version {
+			return &productVersion, nil
+		}
+	}
+	return nil, ErrVersionNotFound
+}
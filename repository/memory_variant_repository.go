@@ -0,0 +1,150 @@
+package repository
+
+import (
+	"context"
+	"products-api/models"
+	"slices"
+	"time"
+)
+
+// MemoryVariantRepository is a VariantRepository keeping the variants in a MemoryProductRepository,
+// so that they change along with the version of their product and are removed when it is purged
+type MemoryVariantRepository struct {
+	products *MemoryProductRepository // Shares its lock
+	nextID   uint
+}
+
+// NewMemoryVariantRepository creates an empty VariantRepository storing variants in the given in-memory products
+func NewMemoryVariantRepository(products *MemoryProductRepository) *MemoryVariantRepository {
+	return &MemoryVariantRepository{products: products, nextID: 1}
+}
+
+// Reset removes every variant and restarts the ID sequence
+func (r *MemoryVariantRepository) Reset() {
+	defer r.products.lock()()
+
+	r.nextID = 1
+	r.products.productVariants = make(map[uint][]models.Variant)
+}
+
+func (r *MemoryVariantRepository) ListByProduct(_ context.Context, productID uint64) ([]models.Variant, error) {
+	defer r.products.rlock()()
+
+	return append([]models.Variant{}, r.products.productVariants[uint(productID)]...), nil
+}
+
+func (r *MemoryVariantRepository) Get(_ context.Context, productID uint64, id uint64) (*models.Variant, error) {
+	defer r.products.rlock()()
+
+	return r.find(uint(productID), uint(id))
+}
+
+// find returns the variant of a product with the given ID, the caller must hold the lock
+func (r *MemoryVariantRepository) find(productID uint, id uint) (*models.Variant, error) {
+	index := slices.IndexFunc(r.products.productVariants[productID], func(variant models.Variant) bool { return variant.ID == id })
+	if index < 0 {
+		return nil, ErrVariantNotFound
+	}
+	variant := r.products.productVariants[productID][index]
+	return &variant, nil
+}
+
+// check checks a new or changed variant against the other variants, whose SKUs it must not reuse,
+// and against the other variants of its product, the caller must hold the lock
+func (r *MemoryVariantRepository) check(variant models.Variant) error {
+	for _, variants := range r.products.productVariants {
+		if slices.ContainsFunc(variants, func(other models.Variant) bool { return other.SKU == variant.SKU && other.ID != variant.ID }) {
+			return ErrDuplicateSKU
+		}
+	}
+	return checkVariant(variant, r.products.productVariants[variant.ProductID])
+}
+
+func (r *MemoryVariantRepository) Create(ctx context.Context, product *models.Product, variant *models.Variant) error {
+	defer r.products.lock()()
+
+	normalizeVariant(variant)
+	return r.changeVariant(ctx, product, func(variants []models.Variant) ([]models.Variant, *models.Variant, *models.Variant, error) {
+		variant.ID = 0
+		variant.ProductID = product.ID
+		if err := r.check(*variant); err != nil {
+			return nil, nil, nil, err
+		}
+
+		variant.ID = r.nextID
+		r.nextID++
+		variant.CreatedAt = time.Now()
+		variant.UpdatedAt = variant.CreatedAt
+		return append(variants, *variant), nil, variant, nil
+	})
+}
+
+func (r *MemoryVariantRepository) Update(ctx context.Context, product *models.Product, variant *models.Variant) error {
+	defer r.products.lock()()
+
+	normalizeVariant(variant)
+	return r.changeVariant(ctx, product, func(variants []models.Variant) ([]models.Variant, *models.Variant, *models.Variant, error) {
+		stored, err := r.find(product.ID, variant.ID)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		variant.ProductID = stored.ProductID
+		variant.CreatedAt = stored.CreatedAt
+		if err := r.check(*variant); err != nil {
+			return nil, nil, nil, err
+		}
+
+		variant.UpdatedAt = time.Now()
+		for i := range variants {
+			if variants[i].ID == variant.ID {
+				variants[i] = *variant
+			}
+		}
+		return variants, stored, variant, nil
+	})
+}
+
+func (r *MemoryVariantRepository) Delete(ctx context.Context, product *models.Product, id uint64) error {
+	defer r.products.lock()()
+
+	return r.changeVariant(ctx, product, func(variants []models.Variant) ([]models.Variant, *models.Variant, *models.Variant, error) {
+		stored, err := r.find(product.ID, uint(id))
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		return slices.DeleteFunc(variants, func(variant models.Variant) bool { return variant.ID == uint(id) }), stored, nil, nil
+	})
+}
+
+// changeVariant applies the change of a variant of the product to a copy of its variants, increments the version
+// of the product if it is still at the version it was read at and records the change in the audit log.
+// The change returns the new variants and the variant before and after it, the caller must hold the write lock
+func (r *MemoryVariantRepository) changeVariant(ctx context.Context, product *models.Product,
+	change func(variants []models.Variant) ([]models.Variant, *models.Variant, *models.Variant, error)) error {
+	stored, ok := r.products.products[product.ID]
+	if !ok || stored.DeletedAt.Valid {
+		return ErrProductNotFound
+	}
+	if stored.Version != product.Version {
+		return ErrVersionConflict
+	}
+
+	// Never change the variants in place, the slice may be shared with a copy made by a product transaction
+	variants, beforeVariant, afterVariant, err := change(slices.Clone(r.products.productVariants[product.ID]))
+	if err != nil {
+		return err
+	}
+	if len(variants) == 0 {
+		delete(r.products.productVariants, product.ID)
+	} else {
+		r.products.productVariants[product.ID] = variants
+	}
+
+	after := stored
+	after.Version++
+	after.UpdatedAt = time.Now()
+	r.products.products[product.ID] = after
+	r.products.writeChange(variantAuditRecord(ctx, &stored, &after, beforeVariant, afterVariant), &stored, &after)
+	*product = after
+	return nil
+}
@@ -0,0 +1,154 @@
+package repository
+
+import (
+	"products-api/models"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Operators comparing an attribute of the products to the value of an AttributeCondition
+const (
+	AttributeEq  = "eq"
+	AttributeNe  = "ne"
+	AttributeGt  = "gt"
+	AttributeGte = "gte"
+	AttributeLt  = "lt"
+	AttributeLte = "lte"
+)
+
+// AttributeCondition compares an attribute of the products to a value. Equality matches string and boolean
+// attributes by their text and numeric attributes by their value, the other operators only match numeric attributes
+type AttributeCondition struct {
+	Name     string   // Valid attribute name, see models.ValidAttributeName
+	Operator string   // One of AttributeEq, AttributeNe, AttributeGt, AttributeGte, AttributeLt and AttributeLte
+	Value    string   // Value as given, such as red, true or 2.5
+	Number   *float64 // Value as a number, when it is one, which is required by the ordering operators
+}
+
+// Matches reports whether the attributes satisfy the condition, where a missing attribute only matches AttributeNe
+func (c AttributeCondition) Matches(attributes map[string]interface{}) bool {
+	value := attributes[c.Name]
+	switch c.Operator {
+	case AttributeEq:
+		return c.equals(value)
+	case AttributeNe:
+		return !c.equals(value)
+	}
+
+	n, ok := value.(float64)
+	if !ok || c.Number == nil {
+		return false
+	}
+	switch c.Operator {
+	case AttributeGt:
+		return n > *c.Number
+	case AttributeGte:
+		return n >= *c.Number
+	case AttributeLt:
+		return n < *c.Number
+	case AttributeLte:
+		return n <= *c.Number
+	}
+	return false
+}
+
+// equals reports whether an attribute value equals the value of the condition
+func (c AttributeCondition) equals(value interface{}) bool {
+	switch v := value.(type) {
+	case string:
+		return v == c.Value
+	case bool:
+		return strconv.FormatBool(v) == c.Value
+	case float64:
+		return c.Number != nil && v == *c.Number
+	}
+	return false
+}
+
+// ProductFilter restricts which products are listed and counted, zero values match everything
+type ProductFilter struct {
+	IDs           []uint               // Only these products when not nil, so an empty list matches nothing
+	Names         []string             // Only products with exactly one of these names when not nil
+	CategoryIDs   []uint               // Only products in at least one of these categories when not nil, checked by the repositories
+	Tags          []string             // Only products with at least one of these normalized tags when not nil
+	AllTags       bool                 // Only products with all the Tags instead of at least one
+	Type          string               // Only products of this type when not empty
+	Attributes    []AttributeCondition // Only products satisfying every condition
+	Name          string               // Case-insensitive substring of the name
+	Description   string               // Case-insensitive substring of the description
+	MinPrice      *float64
+	MaxPrice      *float64
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	UpdatedSince  *time.Time
+	Trashed       bool       // Only soft-deleted products instead of the live ones
+	AsOf          *time.Time // The products that existed at this time, as they were then, instead of the live ones
+}
+
+// IsEmpty reports whether the filter has no conditions and therefore matches every product
+func (f ProductFilter) IsEmpty() bool {
+	return f.IDs == nil && f.Names == nil && f.CategoryIDs == nil && f.Tags == nil && f.Type == "" && f.Attributes == nil && f.Name == "" && f.Description == "" && f.MinPrice == nil && f.MaxPrice == nil &&
+		f.CreatedAfter == nil && f.CreatedBefore == nil && f.UpdatedSince == nil && !f.Trashed && f.AsOf == nil
+}
+
+// Matches reports whether the product satisfies every condition of the filter but CategoryIDs,
+// as the categories of a product are stored apart from it
+func (f ProductFilter) Matches(product models.Product) bool {
+	if product.DeletedAt.Valid != f.Trashed {
+		return false
+	}
+	if f.IDs != nil && !slices.Contains(f.IDs, product.ID) {
+		return false
+	}
+	if f.Names != nil && !slices.Contains(f.Names, product.Name) {
+		return false
+	}
+	if f.Tags != nil && !hasTags(product, f.Tags, f.AllTags) {
+		return false
+	}
+	if f.Type != "" && product.Type != f.Type {
+		return false
+	}
+	for _, condition := range f.Attributes {
+		if !condition.Matches(product.Attributes) {
+			return false
+		}
+	}
+	if f.Name != "" && !containsFold(product.Name, f.Name) {
+		return false
+	}
+	if f.Description != "" && !containsFold(product.Description, f.Description) {
+		return false
+	}
+	if f.MinPrice != nil && product.Price < *f.MinPrice {
+		return false
+	}
+	if f.MaxPrice != nil && product.Price > *f.MaxPrice {
+		return false
+	}
+	if f.CreatedAfter != nil && !product.CreatedAt.After(*f.CreatedAfter) {
+		return false
+	}
+	if f.CreatedBefore != nil && !product.CreatedAt.Before(*f.CreatedBefore) {
+		return false
+	}
+	if f.UpdatedSince != nil && product.UpdatedAt.Before(*f.UpdatedSince) {
+		return false
+	}
+	return true
+}
+
+// hasTags reports whether the product has any of the tags, or all of them when all is set
+func hasTags(product models.Product, tags []string, all bool) bool {
+	hasTag := func(tag string) bool { return slices.Contains(product.Tags, tag) }
+	if all {
+		return !slices.ContainsFunc(tags, func(tag string) bool { return !hasTag(tag) })
+	}
+	return slices.ContainsFunc(tags, hasTag)
+}
+
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
@@ -0,0 +1,99 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"products-api/models"
+	"time"
+)
+
+var (
+	// ErrProductNotFound is returned when a product with the requested ID does not exist
+	ErrProductNotFound = errors.New("product not found")
+	// ErrVersionConflict is returned when a product was modified since the expected version was read
+	ErrVersionConflict = errors.New("product version conflict")
+	// ErrVersionNotFound is returned when the requested version of a product does not exist
+	ErrVersionNotFound = errors.New("product version not found")
+)
+
+// Keyset positions a page relative to a boundary product instead of an offset
+type Keyset struct {
+	Key      models.Product // Boundary product, only the sort fields are used
+	Backward bool           // Return the products right before the boundary instead of after it
+}
+
+// ListOptions holds the parameters used to retrieve a page of products
+type ListOptions struct {
+	Filter ProductFilter
+	Sort   []SortField // Products are ordered by ID when empty
+	Keyset *Keyset     // Replaces the offset when set
+	Offset int
+	Limit  int // Every matching product is returned when not positive
+}
+
+// TagCount is a tag with the number of live products that have it
+type TagCount struct {
+	Tag   string `json:"tag"`
+	Count int64  `json:"count"`
+}
+
+// ProductRepository abstracts the storage of products
+type ProductRepository interface {
+	// Get returns the product with the given ID or ErrProductNotFound
+	Get(ctx context.Context, id uint64) (*models.Product, error)
+	// List returns the products matching the given options
+	List(ctx context.Context, opts ListOptions) ([]models.Product, error)
+	// Each calls fn for every product matching the options, in order, without loading them all at once,
+	// and stops at the first error returned by fn
+	Each(ctx context.Context, opts ListOptions, fn func(product models.Product) error) error
+	// Count returns the number of products matching the filter
+	Count(ctx context.Context, filter ProductFilter) (int64, error)
+	// Search returns the requested page of products matching the search terms, most relevant first, and the total number of matches
+	Search(ctx context.Context, opts SearchOptions) ([]SearchResult, int64, error)
+	// Create stores a new product at version 1 and fills in its generated fields, normalizing its tags
+	Create(ctx context.Context, product *models.Product) error
+	// CreateBatch stores all the products or none of them, filling in their generated fields
+	CreateBatch(ctx context.Context, products []models.Product) error
+	// Update persists the changes made to an existing product, including its normalized tags, and increments its version,
+	// or returns ErrVersionConflict when the stored version no longer matches product.Version
+	Update(ctx context.Context, product *models.Product) error
+	// Transaction runs fn with a repository whose changes are all committed when fn returns nil and all rolled back otherwise
+	Transaction(ctx context.Context, fn func(repo ProductRepository) error) error
+	// Delete moves the product with the given ID to the trash or returns ErrProductNotFound,
+	// an expectedVersion other than 0 makes it return ErrVersionConflict when the stored version differs
+	Delete(ctx context.Context, id uint64, expectedVersion uint) error
+	// Restore takes the product with the given ID out of the trash as a new version,
+	// or returns ErrProductNotFound when it is not in the trash
+	Restore(ctx context.Context, id uint64) (*models.Product, error)
+	// Purge permanently removes the product with the given ID, whether it is in the trash or not,
+	// with the same not found and version semantics as Delete. Its versions are kept for point-in-time reads,
+	// its links to categories are removed
+	Purge(ctx context.Context, id uint64, expectedVersion uint) error
+	// ListVersions returns the requested page of the versions of a product, oldest first, and their total number.
+	// Every change that increments the version of a product stores a snapshot of its fields, valid until the next
+	// change, deletion or purge of the product
+	ListVersions(ctx context.Context, id uint64, offset, limit int) ([]models.ProductVersion, int64, error)
+	// GetVersion returns the given version of a product or ErrVersionNotFound
+	GetVersion(ctx context.Context, id uint64, version uint) (*models.ProductVersion, error)
+	// ListTags returns the requested page of the tags of the live products, most used first, and the total number of tags
+	ListTags(ctx context.Context, offset, limit int) ([]TagCount, int64, error)
+	// PurgeDeleted permanently removes the products moved to the trash before the given time and returns their number
+	PurgeDeleted(ctx context.Context, before time.Time) (int64, error)
+}
+
+// normalizeProduct normalizes the tags of a product and gives it empty attributes when it has none
+func normalizeProduct(product *models.Product) {
+	product.Tags = models.NormalizeTags(product.Tags)
+	if product.Attributes == nil {
+		product.Attributes = map[string]interface{}{}
+	}
+}
+
+// ProductIDs returns the IDs of the products
+func ProductIDs(products []models.Product) []uint {
+	ids := make([]uint, len(products))
+	for i, product := range products {
+		ids[i] = product.ID
+	}
+	return ids
+}
@@ -0,0 +1,188 @@
+package repository
+
+import (
+	"html"
+	"products-api/models"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Markers wrapped around the matching words in search highlights, the rest of the highlighted text is HTML-escaped
+const (
+	HighlightStart = "<mark>"
+	HighlightStop  = "</mark>"
+)
+
+// Relevance weights of a match in the name and in the description, mirroring the tsvector weights A and B
+const (
+	nameWeight        = 1.0
+	descriptionWeight = 0.4
+)
+
+// snippetWords is the number of words of the description kept around the first match
+const snippetWords = 20
+
+var wordPattern = regexp.MustCompile(`[\p{L}\p{N}]+`)
+
+// SearchOptions holds the parameters of a full-text product search
+type SearchOptions struct {
+	Terms  []string // Lowercase words of the query, each matched as a prefix
+	Offset int
+	Limit  int
+}
+
+// SearchHighlights holds the matching fields as HTML, escaped and with the matched words wrapped in highlight markers
+type SearchHighlights struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+// SearchResult is a product matching a search with its relevance
+type SearchResult struct {
+	Product    models.Product   `json:"product"`
+	Rank       float64          `json:"rank"`
+	Highlights SearchHighlights `json:"highlights"`
+}
+
+// ParseSearchTerms splits a search query into lowercase words, dropping punctuation
+func ParseSearchTerms(query string) []string {
+	return wordPattern.FindAllString(strings.ToLower(query), -1)
+}
+
+// searchProducts ranks the candidates against the terms and returns the requested page of matches and their total,
+// it is used by the backends that have no native full-text search
+func searchProducts(candidates []models.Product, opts SearchOptions) ([]SearchResult, int64) {
+	var results []SearchResult
+	for _, product := range candidates {
+		if result, ok := rankProduct(product, opts.Terms); ok {
+			results = append(results, result)
+		}
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Rank != results[j].Rank {
+			return results[i].Rank > results[j].Rank
+		}
+		return results[i].Product.ID < results[j].Product.ID
+	})
+
+	total := int64(len(results))
+	if opts.Offset >= len(results) {
+		return []SearchResult{}, total
+	}
+	end := len(results)
+	if opts.Limit > 0 && opts.Offset+opts.Limit < end {
+		end = opts.Offset + opts.Limit
+	}
+	return results[opts.Offset:end], total
+}
+
+// rankProduct matches every term as a word prefix in the name or description and scores the matches
+func rankProduct(product models.Product, terms []string) (SearchResult, bool) {
+	if len(terms) == 0 {
+		return SearchResult{}, false
+	}
+
+	nameWords := wordPattern.FindAllString(strings.ToLower(product.Name), -1)
+	descriptionWords := wordPattern.FindAllString(strings.ToLower(product.Description), -1)
+
+	var rank float64
+	for _, term := range terms {
+		nameMatches, descriptionMatches := countPrefixMatches(nameWords, term), countPrefixMatches(descriptionWords, term)
+		if nameMatches == 0 && descriptionMatches == 0 {
+			return SearchResult{}, false
+		}
+		rank += nameWeight*float64(nameMatches) + descriptionWeight*float64(descriptionMatches)
+	}
+
+	// Normalize by the document length so that short, focused products rank first
+	rank /= float64(len(terms)) * float64(1+len(nameWords)+len(descriptionWords))
+
+	return SearchResult{
+		Product: product,
+		Rank:    rank,
+		Highlights: SearchHighlights{
+			Name:        highlight(product.Name, terms, 0),
+			Description: highlight(product.Description, terms, snippetWords),
+		},
+	}, true
+}
+
+func countPrefixMatches(words []string, term string) int {
+	var count int
+	for _, word := range words {
+		if strings.HasPrefix(word, term) {
+			count++
+		}
+	}
+	return count
+}
+
+// highlight HTML-escapes the text and wraps the words starting with any of the terms in highlight markers,
+// keeping at most maxWords words around the first match when maxWords is positive
+func highlight(text string, terms []string, maxWords int) string {
+	words := wordPattern.FindAllStringIndex(text, -1)
+	if len(words) == 0 {
+		return html.EscapeString(text)
+	}
+
+	matches := make([]bool, len(words))
+	firstMatch := -1
+	for i, word := range words {
+		lower := strings.ToLower(text[word[0]:word[1]])
+		for _, term := range terms {
+			if strings.HasPrefix(lower, term) {
+				matches[i] = true
+				if firstMatch < 0 {
+					firstMatch = i
+				}
+				break
+			}
+		}
+	}
+
+	// Pick the window of words to keep
+	first, last := 0, len(words)-1
+	if maxWords > 0 && len(words) > maxWords {
+		if firstMatch > 0 {
+			first = firstMatch - maxWords/4
+			if first < 0 {
+				first = 0
+			}
+		}
+		last = first + maxWords - 1
+		if last >= len(words) {
+			last = len(words) - 1
+			first = last - maxWords + 1
+		}
+	}
+
+	var builder strings.Builder
+	start, end := 0, len(text)
+	if first > 0 {
+		start = words[first][0]
+		builder.WriteString("... ")
+	}
+	if last < len(words)-1 {
+		end = words[last][1]
+	}
+
+	position := start
+	for i := first; i <= last; i++ {
+		builder.WriteString(html.EscapeString(text[position:words[i][0]]))
+		word := html.EscapeString(text[words[i][0]:words[i][1]])
+		if matches[i] {
+			builder.WriteString(HighlightStart + word + HighlightStop)
+		} else {
+			builder.WriteString(word)
+		}
+		position = words[i][1]
+	}
+	builder.WriteString(html.EscapeString(text[position:end]))
+
+	if end < len(text) {
+		builder.WriteString(" ...")
+	}
+	return builder.String()
+}
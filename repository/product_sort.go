@@ -0,0 +1,169 @@
+package repository
+
+import (
+	"cmp"
+	"fmt"
+	"products-api/models"
+	"sort"
+	"strings"
+)
+
+// SortableFields lists the product columns the list can be sorted by
+var SortableFields = []string{"id", "name", "price", "created_at", "updated_at"}
+
+// SortField orders products by a single column
+type SortField struct {
+	Field string
+	Desc  bool
+}
+
+// ParseSort parses a comma-separated sort expression such as "-price,name",
+// where a leading "-" sorts the field in descending order
+func ParseSort(expr string) ([]SortField, error) {
+	if expr == "" {
+		return nil, nil
+	}
+
+	var fields []SortField
+	seen := make(map[string]bool)
+	for _, part := range strings.Split(expr, ",") {
+		field := SortField{Field: strings.TrimSpace(part)}
+		if strings.HasPrefix(field.Field, "-") {
+			field.Field = field.Field[1:]
+			field.Desc = true
+		}
+
+		if !isSortable(field.Field) {
+			return nil, fmt.Errorf("unknown sort field %q, must be one of %s", field.Field, strings.Join(SortableFields, ", "))
+		}
+		if seen[field.Field] {
+			return nil, fmt.Errorf("duplicate sort field %q", field.Field)
+		}
+		seen[field.Field] = true
+		fields = append(fields, field)
+	}
+	return fields, nil
+}
+
+// FormatSort returns the canonical sort expression for the fields
+func FormatSort(fields []SortField) string {
+	parts := make([]string, 0, len(fields))
+	for _, field := range fields {
+		if field.Desc {
+			parts = append(parts, "-"+field.Field)
+		} else {
+			parts = append(parts, field.Field)
+		}
+	}
+	return strings.Join(parts, ",")
+}
+
+// withTiebreaker appends the ID to the sort fields so that the order is always deterministic
+func withTiebreaker(fields []SortField) []SortField {
+	for _, field := range fields {
+		if field.Field == "id" {
+			return fields
+		}
+	}
+	return append(append([]SortField{}, fields...), SortField{Field: "id"})
+}
+
+func isSortable(field string) bool {
+	for _, sortable := range SortableFields {
+		if field == sortable {
+			return true
+		}
+	}
+	return false
+}
+
+// reverseSort flips the direction of every field
+func reverseSort(fields []SortField) []SortField {
+	reversed := make([]SortField, len(fields))
+	for i, field := range fields {
+		reversed[i] = SortField{Field: field.Field, Desc: !field.Desc}
+	}
+	return reversed
+}
+
+// sortValue returns the value of the product column the field refers to
+func sortValue(product models.Product, field string) interface{} {
+	switch field {
+	case "name":
+		return product.Name
+	case "price":
+		return product.Price
+	case "created_at":
+		return product.CreatedAt
+	case "updated_at":
+		return product.UpdatedAt
+	default:
+		return product.ID
+	}
+}
+
+// compare orders two products by the field, honoring the direction
+func (s SortField) compare(a, b models.Product) int {
+	var result int
+	switch s.Field {
+	case "id":
+		result = cmp.Compare(a.ID, b.ID)
+	case "name":
+		result = strings.Compare(a.Name, b.Name)
+	case "price":
+		result = cmp.Compare(a.Price, b.Price)
+	case "created_at":
+		result = a.CreatedAt.Compare(b.CreatedAt)
+	case "updated_at":
+		result = a.UpdatedAt.Compare(b.UpdatedAt)
+	}
+	if s.Desc {
+		return -result
+	}
+	return result
+}
+
+// compareProducts orders two products by the fields, which must include the tiebreaker
+func compareProducts(a, b models.Product, fields []SortField) int {
+	for _, field := range fields {
+		if result := field.compare(a, b); result != 0 {
+			return result
+		}
+	}
+	return 0
+}
+
+// sortProducts sorts the products in place by the given fields
+func sortProducts(products []models.Product, fields []SortField) {
+	fields = withTiebreaker(fields)
+	sort.Slice(products, func(i, j int) bool {
+		return compareProducts(products[i], products[j], fields) < 0
+	})
+}
+
+// keysetPage returns up to limit products of the sorted slice that come right after, or right before, the keyset boundary
+func keysetPage(products []models.Product, fields []SortField, keyset Keyset, limit int) []models.Product {
+	fields = withTiebreaker(fields)
+
+	// Find the first product after the boundary, the slice is sorted so a binary search is enough
+	start := sort.Search(len(products), func(i int) bool {
+		return compareProducts(products[i], keyset.Key, fields) > 0
+	})
+	if !keyset.Backward {
+		end := len(products)
+		if limit > 0 && start+limit < end {
+			end = start + limit
+		}
+		return products[start:end]
+	}
+
+	// Products before the boundary end where those equal to it start
+	end := sort.Search(len(products), func(i int) bool {
+		return compareProducts(products[i], keyset.Key, fields) >= 0
+	})
+	begin := 0
+	if limit > 0 && end-limit > 0 {
+		begin = end - limit
+	}
+	return products[begin:end]
+}
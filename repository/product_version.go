@@ -0,0 +1,44 @@
+package repository
+
+import (
+	"maps"
+	"products-api/models"
+	"time"
+)
+
+// newProductVersion snapshots the current fields of a product, valid from its last update
+func newProductVersion(product *models.Product) models.ProductVersion {
+	return models.ProductVersion{
+		ProductID:   product.ID,
+		Version:     product.Version,
+		Name:        product.Name,
+		Description: product.Description,
+		Price:       product.Price,
+		Tags:        append([]string{}, product.Tags...),
+		Type:        product.Type,
+		Attributes:  maps.Clone(product.Attributes),
+		ValidFrom:   product.UpdatedAt.UTC(),
+	}
+}
+
+// versionTransition returns when a change of a product from before to after, either of which is nil when the
+// product is created or purged, ends the validity of its current version, if it does, and the version it starts
+func versionTransition(before, after *models.Product) (*time.Time, *models.ProductVersion) {
+	var validTo time.Time
+	switch {
+	case after == nil:
+		validTo = time.Now()
+	case after.DeletedAt.Valid:
+		validTo = after.DeletedAt.Time
+	case before == nil:
+		version := newProductVersion(after)
+		return nil, &version
+	case before.Version != after.Version:
+		version := newProductVersion(after)
+		return &version.ValidFrom, &version
+	default:
+		return nil, nil
+	}
+	validTo = validTo.UTC()
+	return &validTo, nil
+}
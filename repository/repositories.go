@@ -0,0 +1,39 @@
+package repository
+
+import "gorm.io/gorm"
+
+// Repositories groups the stores the API depends on
+type Repositories struct {
+	Products    ProductRepository
+	Idempotency IdempotencyRepository
+	Audit       AuditRepository
+	Categories  CategoryRepository
+	Variants    VariantRepository
+	Schemas     AttributeSchemaRepository
+}
+
+// NewGormRepositories creates every repository using the given database connection
+func NewGormRepositories(db *gorm.DB) Repositories {
+	return Repositories{
+		Products:    NewGormProductRepository(db),
+		Idempotency: NewGormIdempotencyRepository(db),
+		Audit:       NewGormAuditRepository(db),
+		Categories:  NewGormCategoryRepository(db),
+		Variants:    NewGormVariantRepository(db),
+		Schemas:     NewGormAttributeSchemaRepository(db),
+	}
+}
+
+// NewMemoryRepositories creates empty in-memory repositories
+func NewMemoryRepositories() Repositories {
+	products := NewMemoryProductRepository()
+	categories := NewMemoryCategoryRepository(products)
+	return Repositories{
+		Products:    products,
+		Idempotency: NewMemoryIdempotencyRepository(),
+		Audit:       NewMemoryAuditRepository(products),
+		Categories:  categories,
+		Variants:    NewMemoryVariantRepository(products),
+		Schemas:     NewMemoryAttributeSchemaRepository(categories),
+	}
+}
@@ -0,0 +1,87 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"products-api/models"
+	"slices"
+	"strings"
+)
+
+var (
+	// ErrVariantNotFound is returned when a product has no variant with the requested ID
+	ErrVariantNotFound = errors.New("variant not found")
+	// ErrDuplicateSKU is returned when a variant is given the SKU of another variant, of any product
+	ErrDuplicateSKU = errors.New("sku already used by another variant")
+	// ErrDuplicateVariantOptions is returned when a variant is given the options of another variant of the product
+	ErrDuplicateVariantOptions = errors.New("options already used by another variant of the product")
+)
+
+// VariantAxesError is returned when a variant does not have the same option axes as the other variants of its product
+type VariantAxesError struct {
+	Axes []string // Axes of the other variants
+}
+
+func (e *VariantAxesError) Error() string {
+	return fmt.Sprintf("variant options must use the axes %s", strings.Join(e.Axes, ", "))
+}
+
+// VariantRepository abstracts the storage of the variants of the products.
+// A change to a variant is a change to its product: it increments the version of the product, which must be live
+// and still at the version it was read at, and is recorded in the audit log as an update of the product
+type VariantRepository interface {
+	// ListByProduct returns the variants of the product in creation order
+	ListByProduct(ctx context.Context, productID uint64) ([]models.Variant, error)
+	// Get returns the variant of the product with the given ID or ErrVariantNotFound
+	Get(ctx context.Context, productID uint64, id uint64) (*models.Variant, error)
+	// Create stores a new variant of the product, fills in its generated fields and updates the version of the product,
+	// or returns ErrProductNotFound, ErrVersionConflict, ErrDuplicateSKU, ErrDuplicateVariantOptions or a VariantAxesError
+	Create(ctx context.Context, product *models.Product, variant *models.Variant) error
+	// Update persists the changes made to an existing variant of the product and updates the version of the product,
+	// or returns the errors of Create or ErrVariantNotFound
+	Update(ctx context.Context, product *models.Product, variant *models.Variant) error
+	// Delete removes the variant of the product with the given ID and updates the version of the product,
+	// or returns ErrProductNotFound, ErrVersionConflict or ErrVariantNotFound
+	Delete(ctx context.Context, product *models.Product, id uint64) error
+}
+
+// normalizeVariant normalizes the options of a variant and gives it empty attributes when it has none
+func normalizeVariant(variant *models.Variant) {
+	variant.Options = models.NormalizeOptions(variant.Options)
+	if variant.Attributes == nil {
+		variant.Attributes = map[string]interface{}{}
+	}
+}
+
+// checkVariant checks a new or changed variant against the other variants of its product
+func checkVariant(variant models.Variant, others []models.Variant) error {
+	for _, other := range others {
+		if other.ID == variant.ID {
+			continue
+		}
+		if !slices.Equal(other.Axes(), variant.Axes()) {
+			return &VariantAxesError{Axes: other.Axes()}
+		}
+		if maps.Equal(other.Options, variant.Options) {
+			return ErrDuplicateVariantOptions
+		}
+	}
+	return nil
+}
+
+// variantAuditRecord describes the change of a variant as an update of its product from before to after,
+// listing the variant before and after the change, either of which is nil when it is created or deleted
+func variantAuditRecord(ctx context.Context, before, after *models.Product, beforeVariant, afterVariant *models.Variant) models.AuditRecord {
+	record := newAuditRecord(ctx, models.AuditActionUpdate, before, after)
+	change := models.AuditChange{}
+	if beforeVariant != nil {
+		change.Before = *beforeVariant
+	}
+	if afterVariant != nil {
+		change.After = *afterVariant
+	}
+	record.Changes["variants"] = change
+	return record
+}
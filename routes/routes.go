@@ -3,12 +3,63 @@ package routes
 import (
 	"github.com/gin-gonic/gin"
 	"products-api/controllers"
+	"products-api/middleware"
+	"products-api/repository"
 )
 
-func SetupRoutes(r *gin.Engine) {
-	r.GET("/products", controllers.GetProducts)
-	r.GET("/products/:id", controllers.GetProductById)
-	r.POST("/products", controllers.CreateProduct)
-	r.PATCH("/products/:id", controllers.UpdateProduct)
-	r.DELETE("/products/:id", controllers.DeleteProduct)
+func SetupRoutes(r *gin.Engine, repos repository.Repositories, config controllers.Config) {
+	config = config.WithDefaults()
+	productController := controllers.NewProductController(repos, config)
+	auditController := controllers.NewAuditController(repos.Audit, repos.Products)
+	categoryController := controllers.NewCategoryController(repos.Categories, productController)
+	schemaController := controllers.NewAttributeSchemaController(repos.Schemas)
+
+	// Identify requests and their actor for the audit log
+	r.Use(middleware.RequestID(), middleware.Audit())
+
+	// Make POST and PATCH requests safe to retry
+	r.Use(middleware.Idempotency(repos.Idempotency, config.IdempotencyTTL))
+
+	r.GET("/products", productController.GetProducts)
+	r.GET("/products/export", productController.ExportProducts)
+	r.GET("/products/search", productController.SearchProducts)
+	r.GET("/products/trash", productController.GetTrash)
+	r.GET("/products/:id", productController.GetProductById)
+	r.POST("/products", productController.CreateProduct)
+	r.POST("/products/import", productController.ImportProducts)
+	r.POST("/products/bulk", productController.BulkCreateProducts)
+	r.PATCH("/products/bulk", productController.BulkUpdateProducts)
+	r.DELETE("/products/bulk", productController.BulkDeleteProducts)
+	r.PATCH("/products/:id", productController.UpdateProduct)
+	r.DELETE("/products/:id", productController.DeleteProduct)
+	r.POST("/products/:id/restore", productController.RestoreProduct)
+	r.POST("/products/:id/revert", productController.RevertProduct)
+	r.GET("/products/:id/versions", productController.GetProductVersions)
+	r.GET("/products/:id/versions/:a/diff/:b", productController.DiffProductVersions)
+	r.GET("/products/:id/history", auditController.GetProductHistory)
+	r.GET("/products/:id/categories", categoryController.GetProductCategories)
+	r.POST("/products/:id/tags", productController.AddProductTags)
+	r.DELETE("/products/:id/tags/:tag", productController.RemoveProductTag)
+	r.GET("/products/:id/variants", productController.GetProductVariants)
+	r.GET("/products/:id/variants/:variant_id", productController.GetProductVariant)
+	r.POST("/products/:id/variants", productController.CreateProductVariant)
+	r.PATCH("/products/:id/variants/:variant_id", productController.UpdateProductVariant)
+	r.DELETE("/products/:id/variants/:variant_id", productController.DeleteProductVariant)
+	r.GET("/tags", productController.GetTags)
+	r.GET("/audit", auditController.GetAuditLog)
+
+	r.GET("/categories", categoryController.GetCategories)
+	r.GET("/categories/:id", categoryController.GetCategoryById)
+	r.POST("/categories", categoryController.CreateCategory)
+	r.PATCH("/categories/:id", categoryController.UpdateCategory)
+	r.DELETE("/categories/:id", categoryController.DeleteCategory)
+	r.GET("/categories/:id/products", categoryController.GetCategoryProducts)
+	r.POST("/categories/:id/products", categoryController.AddCategoryProducts)
+	r.DELETE("/categories/:id/products/:product_id", categoryController.RemoveCategoryProduct)
+
+	r.GET("/attribute-schemas", schemaController.GetAttributeSchemas)
+	r.GET("/attribute-schemas/:id", schemaController.GetAttributeSchemaById)
+	r.POST("/attribute-schemas", schemaController.CreateAttributeSchema)
+	r.PUT("/attribute-schemas/:id", schemaController.UpdateAttributeSchema)
+	r.DELETE("/attribute-schemas/:id", schemaController.DeleteAttributeSchema)
 }
@@ -10,8 +10,8 @@ do
   sleep 2
 done
 
-# Run the tests
-go test ./... -v
+# Run the tests against the database
+STORAGE_BACKEND=database go test ./... -v
 
 # Stop the test database
 docker-compose -f docker-compose.test.yml down -v
\ No newline at end of file